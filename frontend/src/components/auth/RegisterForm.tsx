@@ -5,7 +5,7 @@ import { motion } from 'framer-motion';
 import Input from '../ui/Input';
 import Button from '../ui/Button';
 import Uploader from '../ui/uploadButton';
-import { api } from '@/lib/api';
+import { api, ValidationError } from '@/lib/api';
 import { useRouter } from 'next/navigation';
 import { toast } from 'react-hot-toast';
 import { useAuth } from '@/hooks/useAuth';
@@ -34,8 +34,8 @@ export default function RegisterForm() {
     if (!formData.email.includes('@')) {
       newErrors.email = 'Please enter a valid email';
     }
-    if (formData.password.length < 6) {
-      newErrors.password = 'Password must be at least 6 characters';
+    if (formData.password.length < 8 || !/[a-zA-Z]/.test(formData.password) || !/[0-9]/.test(formData.password)) {
+      newErrors.password = 'Password must be at least 8 characters with letters and digits';
     }
     if (!formData.username) {
       newErrors.username = 'Username is required';
@@ -82,6 +82,22 @@ export default function RegisterForm() {
       router.push('/feed');
     } catch (error) {
       console.error('Registration error:', error);
+      if (error instanceof ValidationError) {
+        // Show each problem next to its field
+        const fieldNames: Record<string, string> = {
+          first_name: 'firstName',
+          last_name: 'lastName',
+          date_of_birth: 'dateOfBirth',
+          about_me: 'aboutMe',
+        };
+        const fieldErrors: Record<string, string> = {};
+        for (const { field, message } of error.fields) {
+          const label = field.replace(/_/g, ' ');
+          fieldErrors[fieldNames[field] ?? field] = label.charAt(0).toUpperCase() + label.slice(1) + ' ' + message;
+        }
+        setErrors(fieldErrors);
+        return;
+      }
       toast.error(error instanceof Error ? error.message : 'Registration failed');
       setErrors({ submit: 'Registration failed. Please try again.' });
     } finally {
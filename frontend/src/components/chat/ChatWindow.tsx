@@ -40,6 +40,7 @@ export function ChatWindow({ user, websocket, onClose }: ChatWindowProps) {
   const [hasMore, setHasMore] = useState(true)
   const [isLoading, setIsLoading] = useState(false)
   const [showEmojiPicker, setShowEmojiPicker] = useState(false)
+  const [sendError, setSendError] = useState<string | null>(null)
   const messagesEndRef = useRef<HTMLDivElement>(null)
   const messageContainerRef = useRef<HTMLDivElement>(null)
   const typingTimeoutRef = useRef<NodeJS.Timeout>()
@@ -93,6 +94,8 @@ export function ChatWindow({ user, websocket, onClose }: ChatWindowProps) {
             (data.sender_id === user.id || data.recipient_id === user.id)) {
           setMessages(prev => [...prev, data])
           scrollToBottom('smooth')
+        } else if (data.type === 'error' && data.recipient_id === user.id) {
+          setSendError(data.content)
         }
       }
 
@@ -173,9 +176,10 @@ export function ChatWindow({ user, websocket, onClose }: ChatWindowProps) {
           content: newMessage.trim()
         }));
 
-        // Clear input and emoji picker
+        // Clear input, emoji picker and the last error
         setNewMessage('');
         setShowEmojiPicker(false);
+        setSendError(null);
         
         // Scroll to bottom
         scrollToBottom('smooth');
@@ -235,6 +239,9 @@ export function ChatWindow({ user, websocket, onClose }: ChatWindowProps) {
       </div>
 
       <div className="p-3">
+        {sendError && (
+          <p className="text-sm text-red-400 mb-2">{sendError}</p>
+        )}
         <div className="relative flex items-center">
           <button
             onClick={() => setShowEmojiPicker(!showEmojiPicker)}
@@ -4,6 +4,7 @@ import { useState, useEffect } from 'react';
 import { Bell, User, X } from 'lucide-react';
 import Link from 'next/link';
 import { useRouter } from 'next/router';
+import { registerPush } from '@/lib/push';
 
 interface CurrentUser {
   id: number;
@@ -20,6 +21,9 @@ interface Notification {
   type: string;
   read: boolean;
   group_id: number;
+  actors?: { id: number; username: string; avatar?: string }[];
+  actor_count?: number;
+  updated_at?: string;
 }
 
 export default function Header() {
@@ -47,6 +51,7 @@ export default function Header() {
     };
 
     fetchCurrentUser();
+    registerPush();
   }, []);
 
   useEffect(() => {
@@ -75,10 +80,53 @@ export default function Header() {
 
     // WebSocket connection handling
     let ws: WebSocket | null = null;
+    let events: EventSource | null = null;
     let reconnectAttempts = 0;
     const maxReconnectAttempts = 5;
     const reconnectDelay = 3000; // 3 seconds
 
+    // Frames look the same whether they come over the websocket or /events
+    const handleMessage = (event: MessageEvent) => {
+      console.log("WebSocket message received:", event.data);
+      try {
+        const data = JSON.parse(event.data);
+        if (data.type === 'notification') {
+          setNotifications(prev => {
+            const exists = prev.some(n => n.id === data.data.id);
+            if (!exists) {
+              console.log("Adding new notification:", data.data);
+              // Fetch notifications again to ensure we have the latest data
+              fetchNotifications();
+              return [data.data, ...prev];
+            }
+            // Aggregated notifications are updated in place and re-sent
+            return [data.data, ...prev.filter(n => n.id !== data.data.id)];
+          });
+        } else if (data.type === 'notification_removed') {
+          // Notifications about something that was undone, e.g. a withdrawn follow request
+          const removed: number[] = data.data.ids;
+          setNotifications(prev => prev.filter(n => !removed.includes(n.id)));
+        } else if (data.type === 'reset') {
+          // Too much was missed while the event stream was away to replay it
+          fetchNotifications();
+        }
+      } catch (error) {
+        console.error("Error processing WebSocket message:", error);
+      }
+    };
+
+    // Fall back to Server-Sent Events when websockets are blocked, e.g. by a
+    // proxy. The browser reconnects and resumes the stream by itself.
+    const connectEventStream = () => {
+      events = new EventSource('http://localhost:8080/events', { withCredentials: true });
+      events.onopen = () => {
+        console.log("Event stream connected");
+        setWsConnected(true);
+        setError(null);
+      };
+      events.onmessage = handleMessage;
+    };
+
     const connectWebSocket = () => {
       ws = new WebSocket('ws://localhost:8080/ws');
       
@@ -98,8 +146,9 @@ export default function Header() {
           console.log(`Attempting to reconnect (${reconnectAttempts}/${maxReconnectAttempts})...`);
           setTimeout(connectWebSocket, reconnectDelay);
         } else {
-          console.log("Max reconnection attempts reached");
+          console.log("Max reconnection attempts reached, using event stream");
           setError("Unable to maintain connection to notification service");
+          connectEventStream();
         }
       };
       
@@ -107,26 +156,7 @@ export default function Header() {
         console.error("WebSocket error:", error);
       };
       
-      ws.onmessage = (event) => {
-        console.log("WebSocket message received:", event.data);
-        try {
-          const data = JSON.parse(event.data);
-          if (data.type === 'notification') {
-            setNotifications(prev => {
-              const exists = prev.some(n => n.id === data.data.id);
-              if (!exists) {
-                console.log("Adding new notification:", data.data);
-                // Fetch notifications again to ensure we have the latest data
-                fetchNotifications();
-                return [data.data, ...prev];
-              }
-              return prev;
-            });
-          }
-        } catch (error) {
-          console.error("Error processing WebSocket message:", error);
-        }
-      };
+      ws.onmessage = handleMessage;
     };
 
     // Initial connection
@@ -135,8 +165,12 @@ export default function Header() {
     // Cleanup function
     return () => {
       if (ws) {
+        ws.onclose = null;
         ws.close();
       }
+      if (events) {
+        events.close();
+      }
     };
   }, []); // Empty dependency array to run only once on mount
 
@@ -155,8 +189,8 @@ export default function Header() {
     }
   };
 
-  const handleFollowRequest = async (notificationId: number, action: 'accept' | 'reject') => {
-    const response = await fetch(`http://localhost:8080/follow/request/${notificationId}`, {
+  const handleFollowRequest = async (notificationId: number, followerId: number, action: 'accept' | 'reject') => {
+    const response = await fetch(`http://localhost:8080/follow/requests/${followerId}`, {
       method: 'PATCH',
       credentials: 'include',
       headers: { 
@@ -344,13 +378,13 @@ export default function Header() {
                               {notification.type === 'follow_request' && (
                                 <div className="flex space-x-2 mt-2">
                                   <button
-                                    onClick={() => handleFollowRequest(notification.id, 'accept')}
+                                    onClick={() => handleFollowRequest(notification.id, notification.from_user_id, 'accept')}
                                     className="px-3 py-1 bg-blue-600 text-white rounded-md hover:bg-blue-700 text-sm"
                                   >
                                     Accept
                                   </button>
                                   <button
-                                    onClick={() => handleFollowRequest(notification.id, 'reject')}
+                                    onClick={() => handleFollowRequest(notification.id, notification.from_user_id, 'reject')}
                                     className="px-3 py-1 bg-red-600 text-white rounded-md hover:bg-red-700 text-sm"
                                   >
                                     Decline
@@ -104,6 +104,21 @@ const RightSidebar = () => {
       }
     };
   
+    // Stop suggesting a user
+    const handleDismiss = async (userId: number) => {
+      try {
+        const response = await fetch(`http://localhost:8080/users/suggested/${userId}/dismiss`, {
+          method: 'POST',
+          credentials: 'include',
+        });
+        if (response.ok) {
+          setSuggestedUsers(prev => prev.filter(user => user.id !== userId));
+        }
+      } catch (error) {
+        console.error('Error dismissing suggestion:', error);
+      }
+    };
+  
     // Fetch suggested users
     const fetchSuggestedUsers = async () => {
       try {
@@ -172,7 +187,12 @@ const RightSidebar = () => {
                         />
                       )}
                     </div>
-                    <p className="font-medium text-gray-300 truncate">{user.username}</p>
+                    <div className="min-w-0">
+                      <p className="font-medium text-gray-300 truncate">{user.username}</p>
+                      {user.reason && (
+                        <p className="text-xs text-gray-500 truncate">{user.reason}</p>
+                      )}
+                    </div>
                   </div>
                   <button
                     onClick={() => handleFollow(user.username)}
@@ -180,6 +200,13 @@ const RightSidebar = () => {
                   >
                     Follow
                   </button>
+                  <button
+                    onClick={() => handleDismiss(user.id)}
+                    aria-label={`Dismiss ${user.username}`}
+                    className="ml-2 text-gray-500 hover:text-gray-300 transition-colors flex-shrink-0"
+                  >
+                    ×
+                  </button>
                 </motion.div>
               ))}
             </div>
@@ -2,24 +2,17 @@
 
 import { useState, useEffect } from 'react';
 import Button from '@/components/ui/Button';
+import { api } from '@/lib/api';
 
 function DropDownCheck() {
-  const [followedUsers, setFollowedUsers] = useState<{ username: string }[]>([]);
-  const [selectedItems, setSelectedItems] = useState<string[]>([]);
+  const [followedUsers, setFollowedUsers] = useState<{ follower_id: number; username: string }[]>([]);
+  const [selectedItems, setSelectedItems] = useState<number[]>([]);
   const [isExpanded, setIsExpanded] = useState(false); // Track if the dropdown is expanded
 
   useEffect(() => {
     const fetchData = async () => {
       try {
-        const response = await fetch('http://localhost:8080/followers', {
-          credentials: 'include',
-        });
-
-        if (!response.ok) {
-          throw new Error('Failed to fetch followed users');
-        }
-
-        const data = await response.json();
+        const data = await api.fetchAllPages<{ follower_id: number; username: string }>('/followers');
         console.log('Fetched followed users:', data);
 
         if (Array.isArray(data)) {
@@ -35,12 +28,12 @@ function DropDownCheck() {
     fetchData();
   }, []);
 
-  const handleCheckboxChange = (name: string) => {
+  const handleCheckboxChange = (id: number) => {
     setSelectedItems((prev) => {
-      if (prev.includes(name)) {
-        return prev.filter(item => item !== name);
+      if (prev.includes(id)) {
+        return prev.filter(item => item !== id);
       } else {
-        return [...prev, name];
+        return [...prev, id];
       }
     });
   };
@@ -56,7 +49,7 @@ function DropDownCheck() {
           'Content-Type': 'application/json',
         },
         credentials: 'include', // Include cookies if necessary
-        body: JSON.stringify({ selectedUsers: selectedItems }), // Send selected users
+        body: JSON.stringify({ user_ids: selectedItems }), // Send selected user ids
       });
   
       // Log the response as text first to check its contents
@@ -87,7 +80,10 @@ function DropDownCheck() {
   };
 
   // Display the list of selected close friends (optional, for user feedback)
-  const selectedFriendsDisplay = selectedItems.join(', ');
+  const selectedFriendsDisplay = followedUsers
+    .filter(user => selectedItems.includes(user.follower_id))
+    .map(user => user.username)
+    .join(', ');
 
   return (
     <form onSubmit={handleSubmit} className="relative">
@@ -103,8 +99,8 @@ function DropDownCheck() {
                   <label className="flex items-center w-full">
                     <input
                       type="checkbox"
-                      checked={selectedItems.includes(user.username)}
-                      onChange={() => handleCheckboxChange(user.username)}
+                      checked={selectedItems.includes(user.follower_id)}
+                      onChange={() => handleCheckboxChange(user.follower_id)}
                       className="mr-2"
                     />
                     {user.username}
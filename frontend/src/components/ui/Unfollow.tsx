@@ -33,13 +33,13 @@ const UnfollowButton = ({ fetchProfile, followed_id }: UnfollowButtonProps) => {
     useEffect(() => {
         const fetchFollowers = async () => {
             try {
-                const response = await fetch('http://localhost:8080/following', {
+                const response = await fetch('http://localhost:8080/followStatus', {
                     method: 'GET',
                     credentials: 'include',
                 });
                 if (response.ok) {
-                    const followers = await response.json();
-                    const isFollowing = followers.some((follower: { followed_id: number }) => follower.followed_id === followed_id);
+                    const follows = await response.json();
+                    const isFollowing = follows.some((follow: { followed_id: number; status: string }) => follow.followed_id === followed_id && follow.status === 'accept');
                     setIsFollower(isFollowing);
                 }
             } catch (error) {
@@ -14,6 +14,21 @@ interface LoginResponse {
   username: string;
 }
 
+interface FieldError {
+  field: string;
+  message: string;
+}
+
+// Thrown when the server rejects some fields of a request
+export class ValidationError extends Error {
+  fields: FieldError[];
+
+  constructor(fields: FieldError[]) {
+    super(fields.map(f => `${f.field.replace(/_/g, ' ')} ${f.message}`).join(', '));
+    this.fields = fields;
+  }
+}
+
 const BASE_URL = 'http://localhost:8080';
 
 export const api = {
@@ -29,6 +44,12 @@ export const api = {
 
     if (!response.ok) {
       const errorData = await response.text();
+      try {
+        const { fields } = JSON.parse(errorData);
+        if (Array.isArray(fields)) throw new ValidationError(fields);
+      } catch (error) {
+        if (error instanceof ValidationError) throw error;
+      }
       throw new Error(errorData || 'Registration failed');
     }
 
@@ -53,6 +74,27 @@ export const api = {
     return response.json();
   },
 
+  // Loads every page of a list that pages with `before` and X-Next-Cursor
+  async fetchAllPages<T>(path: string): Promise<T[]> {
+    const items: T[] = [];
+    let cursor: string | null = null;
+    do {
+      const url = new URL(`${BASE_URL}${path}`);
+      url.searchParams.set('limit', '100');
+      if (cursor) {
+        url.searchParams.set('before', cursor);
+      }
+      const response = await fetch(url.toString(), { credentials: 'include' });
+      if (!response.ok) {
+        const errorData = await response.text();
+        throw new Error(errorData || 'Request failed');
+      }
+      items.push(...(await response.json()));
+      cursor = response.headers.get('X-Next-Cursor');
+    } while (cursor);
+    return items;
+  },
+
   async logout(): Promise<void> {
     const response = await fetch(`${BASE_URL}/logout`, {
       method: 'POST',
@@ -63,4 +105,4 @@ export const api = {
       throw new Error('Logout failed');
     }
   },
-}; 
\ No newline at end of file
+}; 
\ No newline at end of file
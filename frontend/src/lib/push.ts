@@ -0,0 +1,44 @@
+const BASE_URL = 'http://localhost:8080';
+
+// The VAPID public key comes base64url encoded, PushManager wants bytes
+function urlBase64ToUint8Array(base64String: string): Uint8Array {
+  const padding = '='.repeat((4 - (base64String.length % 4)) % 4);
+  const base64 = (base64String + padding).replace(/-/g, '+').replace(/_/g, '/');
+  const raw = window.atob(base64);
+  return Uint8Array.from(raw, (char) => char.charCodeAt(0));
+}
+
+// registerPush subscribes this browser to Web Push so notifications and
+// messages still arrive when the app is closed. It does nothing when the
+// browser doesn't support push or the user declines.
+export async function registerPush(): Promise<void> {
+  if (typeof window === 'undefined' || !('serviceWorker' in navigator) || !('PushManager' in window)) {
+    return;
+  }
+
+  try {
+    const permission = await Notification.requestPermission();
+    if (permission !== 'granted') return;
+
+    const keyResponse = await fetch(`${BASE_URL}/push/public-key`, { credentials: 'include' });
+    if (!keyResponse.ok) return;
+    const { public_key } = await keyResponse.json();
+
+    const registration = await navigator.serviceWorker.register('/push-sw.js');
+    const subscription =
+      (await registration.pushManager.getSubscription()) ||
+      (await registration.pushManager.subscribe({
+        userVisibleOnly: true,
+        applicationServerKey: urlBase64ToUint8Array(public_key),
+      }));
+
+    await fetch(`${BASE_URL}/push/subscriptions`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      credentials: 'include',
+      body: JSON.stringify(subscription.toJSON()),
+    });
+  } catch (error) {
+    console.error('Error registering for push notifications:', error);
+  }
+}
@@ -158,10 +158,10 @@ const Follow = () => {
     }
   }
 
-  const handleAcceptFollowRequest = async (requestId: number) => {
-    console.log(requestId, "accept", "this is handleAcceptFollowRequest")
+  const handleAcceptFollowRequest = async (followerId: number) => {
+    console.log(followerId, "accept", "this is handleAcceptFollowRequest")
     try {
-      const response = await fetch(`http://localhost:8080/follow/requestF/${requestId}`, {
+      const response = await fetch(`http://localhost:8080/follow/requests/${followerId}`, {
         method: 'PATCH',
         credentials: 'include',
         headers: { 
@@ -173,12 +173,12 @@ const Follow = () => {
 
       if (response.ok) {
         // Remove the request from followRequests
-        setFollowRequests(prev => prev.filter(req => req.id !== requestId))
+        setFollowRequests(prev => prev.filter(req => req.follower_id !== followerId))
 
         // Update the users list to reflect the new status
         setUsers(prevUsers => 
           prevUsers.map(user => {
-            const isRequestUser = user.id === requestId
+            const isRequestUser = user.id === followerId
             return isRequestUser
               ? {
                   ...user,
@@ -192,7 +192,7 @@ const Follow = () => {
         // Remove from pending IDs
         setPendingFollowIds(prev => {
           const newSet = new Set(prev)
-          newSet.delete(requestId)
+          newSet.delete(followerId)
           return newSet
         })
 
@@ -204,10 +204,10 @@ const Follow = () => {
     }
   }
 
-  const handleRejectFollowRequest = async (requestId: number) => {
-    console.log(requestId, "reject", "this is handleRejectFollowRequest")
+  const handleRejectFollowRequest = async (followerId: number) => {
+    console.log(followerId, "reject", "this is handleRejectFollowRequest")
     try {
-      const response = await fetch(`http://localhost:8080/follow/requestF/${requestId}`, {
+      const response = await fetch(`http://localhost:8080/follow/requests/${followerId}`, {
         method: 'PATCH',
         credentials: 'include',
         headers: { 
@@ -219,12 +219,12 @@ const Follow = () => {
 
       if (response.ok) {
         // Remove the request from followRequests
-        setFollowRequests(prev => prev.filter(req => req.id !== requestId))
+        setFollowRequests(prev => prev.filter(req => req.follower_id !== followerId))
 
         // Update the users list to reflect the new status
         setUsers(prevUsers => 
           prevUsers.map(user => {
-            const isRequestUser = user.id === requestId
+            const isRequestUser = user.id === followerId
             return isRequestUser
               ? {
                   ...user,
@@ -238,7 +238,7 @@ const Follow = () => {
         // Remove from pending IDs
         setPendingFollowIds(prev => {
           const newSet = new Set(prev)
-          newSet.delete(requestId)
+          newSet.delete(followerId)
           return newSet
         })
 
@@ -479,7 +479,7 @@ const Follow = () => {
                             <button
                             onClick={async () => {
                               console.log("Accept button clicked");
-                              await handleAcceptFollowRequest(request.id);
+                              await handleAcceptFollowRequest(request.follower_id);
                             }}
                             className="px-4 py-2 bg-blue-600 text-white rounded hover:bg-blue-700"
                             >
@@ -487,7 +487,7 @@ const Follow = () => {
                             </button>
 
                             <button
-                              onClick={() => handleRejectFollowRequest(request.id)}
+                              onClick={() => handleRejectFollowRequest(request.follower_id)}
                               className="px-4 py-2 bg-red-600 text-white rounded hover:bg-red-700"
                             >
                               Reject
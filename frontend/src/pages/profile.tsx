@@ -6,6 +6,7 @@ import { User, MapPin, Calendar, Mail, Users, UserPlus, UserMinus, Lock, Unlock,
 import { motion } from 'framer-motion'
 import Sidebar from '@/components/layout/Sidebar'
 import Header from '@/components/layout/Header'
+import { api } from '@/lib/api'
 
 interface UserProfile {
   id: number
@@ -18,8 +19,14 @@ interface UserProfile {
   date_of_birth: string
   created_at: string
   is_private: boolean
+  email_visibility?: Visibility
+  birthday_visibility?: Visibility
+  about_me_visibility?: Visibility
 }
 
+type Visibility = 'public' | 'followers' | 'only_me'
+type VisibilityField = 'email_visibility' | 'birthday_visibility' | 'about_me_visibility'
+
 interface Post {
   id: number
   title: string
@@ -84,36 +91,21 @@ export default function Profile() {
             break
 
           case 'followers':
-            const followersRes = await fetch(`http://localhost:8080/followers`, {
-              credentials: 'include',
-            })
-            if (followersRes.ok) {
-              const followersData = await followersRes.json()
-              setFollowers(Array.isArray(followersData) ? followersData : [])
-            }
+            setFollowers(await api.fetchAllPages<Follower>('/followers'))
             break
 
           case 'following':
             try {
-              const followingRes = await fetch(`http://localhost:8080/following/${userId}`, {
-                credentials: 'include',
-              })
-              if (followingRes.ok) {
-                const followingData = await followingRes.json()
-                setFollowing(
-                  Array.isArray(followingData) 
-                    ? followingData
-                        .filter(follow => follow.status === 'accept')
-                        .map(follow => ({
-                          id: follow.id,
-                          username: follow.username,
-                          avatar: follow.avatar,
-                          status: follow.status,
-                          is_following: true
-                        }))
-                    : []
-                )
-              }
+              const followingData = await api.fetchAllPages<Follower>(`/following/${userId}`)
+              setFollowing(
+                followingData.map(follow => ({
+                  id: follow.id,
+                  username: follow.username,
+                  avatar: follow.avatar,
+                  status: follow.status,
+                  is_following: true
+                }))
+              )
             } catch (error) {
               console.error('Error fetching following:', error)
             }
@@ -287,6 +279,22 @@ export default function Profile() {
     }
   }
 
+  const updateFieldVisibility = async (field: VisibilityField, visibility: Visibility) => {
+    try {
+      const response = await fetch('http://localhost:8080/user/profile', {
+        method: 'PATCH',
+        credentials: 'include',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ [field]: visibility }),
+      })
+      if (response.ok) {
+        setProfile(prev => prev ? { ...prev, [field]: visibility } : null)
+      }
+    } catch (error) {
+      console.error('Error updating field visibility:', error)
+    }
+  }
+
   if (!profile) {
     return <div>Profile not found</div>
   }
@@ -388,6 +396,27 @@ export default function Profile() {
                           </span>
                         </button>
                       </div>
+                      <h3 className="text-gray-200 font-semibold mt-6 mb-2">Who can see</h3>
+                      <div className="space-y-2">
+                        {([
+                          ['email_visibility', 'Email'],
+                          ['birthday_visibility', 'Birthday'],
+                          ['about_me_visibility', 'About me'],
+                        ] as [VisibilityField, string][]).map(([field, label]) => (
+                          <label key={field} className="flex items-center justify-between text-sm text-gray-300">
+                            {label}
+                            <select
+                              value={profile[field] ?? 'public'}
+                              onChange={(e) => updateFieldVisibility(field, e.target.value as Visibility)}
+                              className="ml-2 bg-gray-700 text-gray-200 rounded p-1"
+                            >
+                              <option value="public">Everyone</option>
+                              <option value="followers">Followers</option>
+                              <option value="only_me">Only me</option>
+                            </select>
+                          </label>
+                        ))}
+                      </div>
                     </div>
                   )}
                 </div>
@@ -12,9 +12,9 @@ interface Profile {
   username: string
   first_name: string
   last_name: string
-  email: string
-  date_of_birth: string
-  about_me: string
+  email?: string
+  date_of_birth?: string
+  about_me?: string
   avatar: string
   is_private: boolean
   is_following: boolean
@@ -22,6 +22,16 @@ interface Profile {
   posts: Post[]
   followers_count: number
   following_count: number
+  relationship?: Relationship
+}
+
+interface Relationship {
+  follows_you: boolean
+  is_close_friend: boolean
+  mutual_followers: { id: number; username: string; avatar?: string }[]
+  mutual_followers_count: number
+  shared_groups: { id: number; title: string }[]
+  shared_groups_count: number
 }
 
 interface Post {
@@ -255,7 +265,31 @@ export default function UserProfile() {
                   <Lock size={16} className="text-yellow-500" />
                 )}
               </div>
-              <p className="text-gray-400">@{profile.username}</p>
+              <div className="flex items-center space-x-2">
+                <p className="text-gray-400">@{profile.username}</p>
+                {profile.relationship?.follows_you && (
+                  <span className="px-2 py-0.5 text-xs text-gray-300 bg-gray-700 rounded">Follows you</span>
+                )}
+                {profile.relationship?.is_close_friend && (
+                  <span className="px-2 py-0.5 text-xs text-green-300 bg-green-900/40 rounded">Close friend</span>
+                )}
+              </div>
+
+              {/* Mutual connections */}
+              {profile.relationship && profile.relationship.mutual_followers_count > 0 && (
+                <p className="text-sm text-gray-400 mt-2">
+                  Followed by {profile.relationship.mutual_followers.map(user => user.username).join(', ')}
+                  {profile.relationship.mutual_followers_count > profile.relationship.mutual_followers.length &&
+                    ` and ${profile.relationship.mutual_followers_count - profile.relationship.mutual_followers.length} others you follow`}
+                </p>
+              )}
+              {profile.relationship && profile.relationship.shared_groups_count > 0 && (
+                <p className="text-sm text-gray-400 mb-2">
+                  Also in {profile.relationship.shared_groups.map(group => group.title).join(', ')}
+                  {profile.relationship.shared_groups_count > profile.relationship.shared_groups.length &&
+                    ` and ${profile.relationship.shared_groups_count - profile.relationship.shared_groups.length} more groups`}
+                </p>
+              )}
 
               {/* Stats */}
               <div className="flex space-x-6 mb-6">
@@ -270,21 +304,27 @@ export default function UserProfile() {
               </div>
 
               {/* About */}
-              <div className="mb-6">
-                <h2 className="text-xl font-semibold text-gray-200 mb-2">About</h2>
-                <p className="text-gray-300">{profile.about_me}</p>
-              </div>
+              {profile.about_me && (
+                <div className="mb-6">
+                  <h2 className="text-xl font-semibold text-gray-200 mb-2">About</h2>
+                  <p className="text-gray-300">{profile.about_me}</p>
+                </div>
+              )}
 
-              {/* Contact Info */}
+              {/* Contact Info, only the fields the user shares with us */}
               <div className="grid grid-cols-2 gap-4 mb-8">
-                <div className="flex items-center text-gray-300">
-                  <Mail className="mr-2" size={20} />
-                  <span>{profile.email}</span>
-                </div>
-                <div className="flex items-center text-gray-300">
-                  <Calendar className="mr-2" size={20} />
-                  <span>{new Date(profile.date_of_birth).toLocaleDateString()}</span>
-                </div>
+                {profile.email && (
+                  <div className="flex items-center text-gray-300">
+                    <Mail className="mr-2" size={20} />
+                    <span>{profile.email}</span>
+                  </div>
+                )}
+                {profile.date_of_birth && (
+                  <div className="flex items-center text-gray-300">
+                    <Calendar className="mr-2" size={20} />
+                    <span>{new Date(profile.date_of_birth).toLocaleDateString()}</span>
+                  </div>
+                )}
               </div>
 
               {/* Posts */}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/notifications"
+)
+
+// notifyPostLike tells the author of a post that actorID liked it. Liking the
+// same post again after unliking it does not notify twice.
+func notifyPostLike(postID int64, actorID uint64) {
+	var authorID int64
+	var actorName string
+	err := sqlite.DB.QueryRow(`
+		SELECT p.author, u.username
+		FROM posts p, users u
+		WHERE p.id = ? AND u.id = ?`,
+		postID, actorID,
+	).Scan(&authorID, &actorName)
+	if err != nil {
+		log.Printf("Error looking up post %d for like notification: %v", postID, err)
+		return
+	}
+	if authorID == int64(actorID) {
+		return
+	}
+
+	notification := m.Notification{
+		ToUserID:       int(authorID),
+		FromUserID:     int(actorID),
+		Content:        fmt.Sprintf("%s liked your post", actorName),
+		Type:           m.NotificationPostLike,
+		CreatedAt:      time.Now(),
+		IdempotencyKey: notifications.Key(m.NotificationPostLike, postID, actorID),
+		TargetType:     m.SourcePost,
+		TargetID:       int(postID),
+	}
+	if err := notifications.Send(&notification); err != nil {
+		log.Printf("Error creating like notification: %v", err)
+	}
+}
+
+// notifyPostComment tells the author of a post that actorID commented on it
+func notifyPostComment(postID, commentID int64, actorID uint64) {
+	var authorID int64
+	var actorName string
+	err := sqlite.DB.QueryRow(`
+		SELECT p.author, u.username
+		FROM posts p, users u
+		WHERE p.id = ? AND u.id = ?`,
+		postID, actorID,
+	).Scan(&authorID, &actorName)
+	if err != nil {
+		log.Printf("Error looking up post %d for comment notification: %v", postID, err)
+		return
+	}
+	if authorID == int64(actorID) {
+		return
+	}
+
+	notification := m.Notification{
+		ToUserID:       int(authorID),
+		FromUserID:     int(actorID),
+		Content:        fmt.Sprintf("%s commented on your post", actorName),
+		Type:           m.NotificationPostComment,
+		CreatedAt:      time.Now(),
+		IdempotencyKey: notifications.Key(m.NotificationPostComment, commentID),
+		TargetType:     m.SourcePost,
+		TargetID:       int(postID),
+	}
+	if err := notifications.Send(&notification); err != nil {
+		log.Printf("Error creating comment notification: %v", err)
+	}
+}
+
+// notifyGroupPostComment tells the author of a group post that actorID
+// commented on it
+func notifyGroupPostComment(groupID, postID, commentID int64, actorID uint64) {
+	var authorID int64
+	var actorName, groupTitle string
+	err := sqlite.DB.QueryRow(`
+		SELECT gp.author, u.username, g.title
+		FROM group_posts gp
+		JOIN groups g ON g.id = gp.group_id
+		JOIN users u ON u.id = ?
+		WHERE gp.id = ? AND gp.group_id = ?`,
+		actorID, postID, groupID,
+	).Scan(&authorID, &actorName, &groupTitle)
+	if err != nil {
+		log.Printf("Error looking up group post %d for comment notification: %v", postID, err)
+		return
+	}
+	if authorID == int64(actorID) {
+		return
+	}
+
+	notification := m.Notification{
+		ToUserID:       int(authorID),
+		FromUserID:     int(actorID),
+		Content:        fmt.Sprintf("%s commented on your post in %s", actorName, groupTitle),
+		Type:           m.NotificationGroupPostComment,
+		GroupID:        int(groupID),
+		CreatedAt:      time.Now(),
+		IdempotencyKey: notifications.Key(m.NotificationGroupPostComment, commentID),
+		TargetType:     m.SourceGroupPost,
+		TargetID:       int(postID),
+	}
+	if err := notifications.Send(&notification); err != nil {
+		log.Printf("Error creating group comment notification: %v", err)
+	}
+}
+
+// notifyGroupPost tells every other member of a group that actorID posted in
+// it. Unread group post notifications of a group are folded into one.
+func notifyGroupPost(groupID, postID int64, actorID uint64) {
+	var actorName, groupTitle string
+	err := sqlite.DB.QueryRow(`
+		SELECT u.username, g.title
+		FROM users u, groups g
+		WHERE u.id = ? AND g.id = ?`,
+		actorID, groupID,
+	).Scan(&actorName, &groupTitle)
+	if err != nil {
+		log.Printf("Error looking up group %d for post notification: %v", groupID, err)
+		return
+	}
+
+	rows, err := sqlite.DB.Query(`
+		SELECT user_id FROM group_members
+		WHERE group_id = ? AND user_id != ?
+		AND status IN ('member', 'creator')`,
+		groupID, actorID,
+	)
+	if err != nil {
+		log.Printf("Error fetching members of group %d: %v", groupID, err)
+		return
+	}
+	var members []int
+	for rows.Next() {
+		var memberID int
+		if err := rows.Scan(&memberID); err == nil {
+			members = append(members, memberID)
+		}
+	}
+	rows.Close()
+
+	for _, memberID := range members {
+		notification := m.Notification{
+			ToUserID:       memberID,
+			FromUserID:     int(actorID),
+			Content:        fmt.Sprintf("%s posted in %s", actorName, groupTitle),
+			Type:           m.NotificationGroupPost,
+			GroupID:        int(groupID),
+			CreatedAt:      time.Now(),
+			IdempotencyKey: notifications.Key(m.NotificationGroupPost, postID, memberID),
+			TargetType:     m.NotificationTargetGroup,
+			TargetID:       int(groupID),
+		}
+		if err := notifications.Send(&notification); err != nil {
+			log.Printf("Error creating group post notification: %v", err)
+		}
+	}
+}
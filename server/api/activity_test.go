@@ -0,0 +1,90 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"testing"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+)
+
+// notificationsOf counts the notifications of a type a user has, and the
+// actors folded into them
+func notificationsOf(t *testing.T, userID int64, notificationType string) (rows, actors int) {
+	t.Helper()
+	err := sqlite.DB.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(actor_count), 0) FROM notifications WHERE to_user_id = ? AND type = ?",
+		userID, notificationType,
+	).Scan(&rows, &actors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows, actors
+}
+
+func TestLikeNotifications(t *testing.T) {
+	sqlitetest.Open(t)
+
+	author := newTestUser(t, "author", false)
+	postID := postBy(t, author, time.Now())
+
+	notifyPostLike(postID, 2)
+	// Liking again after an unlike doesn't notify twice
+	notifyPostLike(postID, 2)
+	notifyPostLike(postID, 3)
+	// Nor does liking your own post
+	notifyPostLike(postID, uint64(author))
+
+	if rows, actors := notificationsOf(t, author, m.NotificationPostLike); rows != 1 || actors != 2 {
+		t.Errorf("author has %d like notifications with %d actors, want 1 with 2", rows, actors)
+	}
+}
+
+func TestCommentNotifications(t *testing.T) {
+	sqlitetest.Open(t)
+
+	author := newTestUser(t, "author", false)
+	postID := postBy(t, author, time.Now())
+
+	notifyPostComment(postID, 100, 2)
+	notifyPostComment(postID, 100, 2)
+	notifyPostComment(postID, 101, uint64(author))
+
+	if rows, actors := notificationsOf(t, author, m.NotificationPostComment); rows != 1 || actors != 1 {
+		t.Errorf("author has %d comment notifications with %d actors, want 1 with 1", rows, actors)
+	}
+}
+
+func TestGroupPostNotifications(t *testing.T) {
+	sqlitetest.Open(t)
+
+	member := newTestUser(t, "member", false)
+	poster := newTestUser(t, "poster", false)
+	outsider := newTestUser(t, "outsider", false)
+	groupID := newGroup(t, 1, member, poster)
+
+	result, err := sqlite.DB.Exec(
+		"INSERT INTO group_posts (title, content, author, group_id) VALUES ('Hello', 'First post', ?, ?)",
+		poster, groupID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postID, _ := result.LastInsertId()
+	notifyGroupPost(groupID, postID, uint64(poster))
+
+	for userID, want := range map[int64]int{1: 1, member: 1, poster: 0, outsider: 0} {
+		if rows, _ := notificationsOf(t, userID, m.NotificationGroupPost); rows != want {
+			t.Errorf("user %d has %d group post notifications, want %d", userID, rows, want)
+		}
+	}
+
+	notifyGroupPostComment(groupID, postID, 200, uint64(member))
+	notifyGroupPostComment(groupID, postID, 201, uint64(poster))
+	if rows, _ := notificationsOf(t, poster, m.NotificationGroupPostComment); rows != 1 {
+		t.Errorf("poster has %d group comment notifications, want 1", rows)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"social-network/models"
 	"social-network/pkg/db/sqlite"
+	"social-network/pkg/loginlimit"
 	"social-network/util"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -25,25 +27,19 @@ type RegisterRequest struct {
 }
 
 func GetUserIDBY(w http.ResponseWriter, r *http.Request) {
-    username, err := util.GetUsernameFromSession(r)  
+    userID, err := util.GetUserID(r, w)
     if err != nil {
-        http.Error(w, "Unauthorized: no session cookie", http.StatusUnauthorized)
-        return
-    }
-
-    var userID int
-    err = sqlite.DB.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID)
-    if err != nil {
-        http.Error(w, "Unauthorized: user not found", http.StatusUnauthorized)
         return
     }
 
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(map[string]int{"id": userID})
+    json.NewEncoder(w).Encode(map[string]uint64{"id": userID})
 }
 
 
 // func for endpoint :
+// GetUserIDED looks a user up by username. Old usernames still resolve during
+// their grace period, so the response also holds the current one.
 func GetUserIDED(w http.ResponseWriter, r *http.Request) {
 
     var requestData struct {
@@ -55,14 +51,22 @@ func GetUserIDED(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    var userID uint64
-    err = sqlite.DB.QueryRow("SELECT id FROM users WHERE username = ?", requestData.Username).Scan(&userID)
+    userID, err := resolveUsername(sqlite.DB, requestData.Username)
     if err != nil {
         http.Error(w, "User not found", http.StatusNotFound)
         return
     }
 
-    response := map[string]uint64{"userID": userID}
+    var username string
+    if err := sqlite.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+        http.Error(w, "User not found", http.StatusNotFound)
+        return
+    }
+
+    response := struct {
+        UserID   int64  `json:"userID"`
+        Username string `json:"username"`
+    }{userID, username}
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(response)
 }
@@ -81,26 +85,58 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Basic validation
-	if req.Email == "" || req.Password == "" || req.Username == "" {
-		http.Error(w, "Email, password and username are required", http.StatusBadRequest)
+	// Validate every field, so the form can show all problems at once
+	req.Email = strings.TrimSpace(req.Email)
+	req.FirstName = strings.TrimSpace(req.FirstName)
+	req.LastName = strings.TrimSpace(req.LastName)
+	req.AboutMe = strings.TrimSpace(req.AboutMe)
+
+	v := util.Validator{}
+	v.Email("email", req.Email)
+	v.Username("username", req.Username)
+	v.Password("password", req.Password)
+	v.Length("first_name", req.FirstName, 1, maxNameLength)
+	v.Length("last_name", req.LastName, 1, maxNameLength)
+	v.Length("about_me", req.AboutMe, 0, maxAboutMeLength)
+	v.MinAge("date_of_birth", v.Date("date_of_birth", req.DateOfBirth), minimumAge)
+	if req.Avatar != "" {
+		validateAvatar(&v, "avatar", req.Avatar)
+	}
+	if !v.Valid() {
+		v.Write(w, http.StatusBadRequest)
 		return
 	}
 
-	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	var emailTaken bool
+	if err := sqlite.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE email = ?)", req.Email).Scan(&emailTaken); err != nil {
+		http.Error(w, "Error checking email", http.StatusInternalServerError)
+		return
+	}
+	v.Check(!emailTaken, "email", "is already registered")
+
+	// Usernames given up recently are reserved for their previous owner
+	usernameInUse, err := usernameTaken(sqlite.DB, req.Username, 0)
 	if err != nil {
-		http.Error(w, "Error processing password", http.StatusInternalServerError)
+		http.Error(w, "Error checking username", http.StatusInternalServerError)
+		return
+	}
+	v.Check(!usernameInUse, "username", "is already taken")
+
+	if !v.Valid() {
+		v.Write(w, http.StatusConflict)
 		return
 	}
 
-	// Parse date of birth
-	dateOfBirth, err := time.Parse("2006-01-02", req.DateOfBirth)
+	// Hash the password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Invalid date format for date of birth", http.StatusBadRequest)
+		http.Error(w, "Error processing password", http.StatusInternalServerError)
 		return
 	}
 
+	// Already validated
+	dateOfBirth, _ := time.Parse("2006-01-02", req.DateOfBirth)
+
 	// Create user model
 	user := models.User{
 		Email:       req.Email,
@@ -121,7 +157,16 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		user.Email, user.Password, user.Username, user.FirstName, user.LastName, user.DateOfBirth, user.AboutMe, user.Avatar, user.CreatedAt)
 	
 	if err != nil {
-		http.Error(w, "The user already exists. Please log in or use a different email/username to register.", http.StatusInternalServerError)
+		// Lost a race against another registration
+		switch {
+		case strings.Contains(err.Error(), "users.email"):
+			util.WriteFieldError(w, http.StatusConflict, "email", "is already registered")
+		case strings.Contains(err.Error(), "users.username"):
+			util.WriteFieldError(w, http.StatusConflict, "username", "is already taken")
+		default:
+			log.Printf("Error creating user: %v", err)
+			http.Error(w, "Error creating user", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -132,19 +177,13 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create session
-	sessionToken := util.GenerateSessionToken()
-	util.UserSession[sessionToken] = uint(id)
+	// The account is restricted once the grace period ends unverified
+	if err := sendEmailVerification(id, user.Email, user.Username); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", id, err)
+	}
 
-	// Set cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "AccessToken",
-		Value:    sessionToken,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   false, // Set to true in production with HTTPS
-		SameSite: http.SameSiteLaxMode,
-	})
+	// Create session
+	util.StartSession(w, uint(id))
 
 	// Return response
 	w.Header().Set("Content-Type", "application/json")
@@ -154,6 +193,10 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// dummyPasswordHash is compared against when no account has the email, so
+// logging in takes as long whether or not the email is registered
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -170,12 +213,27 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Checked before the password so a locked account can't be probed
+	ip := clientIP(r)
+	accountKey := loginlimit.AccountKey(req.Email)
+	wait, err := loginlimit.RetryAfter(accountKey, loginlimit.IPKey(ip))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		tooManyLogins(w, wait)
+		return
+	}
+
 	var user models.User
-	err := sqlite.DB.QueryRow("SELECT id, email, password, username FROM users WHERE email = ?", req.Email).
+	err = sqlite.DB.QueryRow("SELECT id, email, password, username FROM users WHERE email = ?", req.Email).
 		Scan(&user.ID, &user.Email, &user.Password, &user.Username)
 	
 	if err != nil {
 		if err == sql.ErrNoRows {
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+			loginFailed(req.Email, ip)
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
@@ -184,21 +242,15 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		loginFailed(req.Email, ip)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	sessionToken := util.GenerateSessionToken()
-	util.UserSession[sessionToken] = user.ID
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "AccessToken",
-		Value:    sessionToken,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   false, // Set to true in production with HTTPS
-		SameSite: http.SameSiteLaxMode,
-	})
+	if err := loginlimit.Reset(accountKey); err != nil {
+		log.Printf("Error resetting failed logins of user %d: %v", user.ID, err)
+	}
+	util.StartSession(w, user.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(models.UserResponse{
@@ -215,7 +267,7 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete the session
-	delete(util.UserSession, cookie.Value)
+	util.EndSession(cookie.Value)
 
 	// Expire the cookie
 	http.SetCookie(w, &http.Cookie{
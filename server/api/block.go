@@ -0,0 +1,199 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/notifications"
+	"social-network/util"
+)
+
+// notBlockedClause is true when neither the user in column nor viewer has
+// blocked the other. viewer is an SQL expression such as ":viewer" or "?";
+// a "?" must be bound twice.
+func notBlockedClause(column, viewer string) string {
+	return `NOT EXISTS (
+		SELECT 1 FROM blocks b
+		WHERE (b.blocker_id = ` + viewer + ` AND b.blocked_id = ` + column + `)
+		OR (b.blocker_id = ` + column + ` AND b.blocked_id = ` + viewer + `)
+	)`
+}
+
+// isBlocked reports whether either of two users has blocked the other
+func isBlocked(userA, userB int64) (bool, error) {
+	var blocked bool
+	err := sqlite.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)
+		)`,
+		userA, userB, userB, userA,
+	).Scan(&blocked)
+	return blocked, err
+}
+
+// isBlockedByAuthor reports whether the author of a post in table (posts or
+// group_posts) and userID have blocked one another
+func isBlockedByAuthor(table string, postID int64, userID uint64) (bool, error) {
+	var blocked bool
+	err := sqlite.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM `+table+` p
+			WHERE p.id = ? AND NOT `+notBlockedClause("p.author", "?")+`
+		)`,
+		postID, userID, userID,
+	).Scan(&blocked)
+	return blocked, err
+}
+
+// BlockUser blocks {id} for the caller. Follows between the two users are
+// removed in both directions, along with their pending follow requests.
+func BlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	blockedID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if blockedID == int64(userID) {
+		http.Error(w, "You can't block yourself", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := m.DoesUserExist(uint(blockedID), sqlite.DB)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT OR IGNORE INTO blocks (blocker_id, blocked_id) VALUES (?, ?)",
+		userID, blockedID,
+	); err != nil {
+		log.Printf("Error blocking user %d: %v", blockedID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM followers
+		WHERE (follower_id = ? AND followed_id = ?) OR (follower_id = ? AND followed_id = ?)`,
+		userID, blockedID, blockedID, userID,
+	); err != nil {
+		log.Printf("Error removing follows of blocked user %d: %v", blockedID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Follow requests and acceptances between them no longer lead anywhere
+	if _, err := tx.Exec(`
+		DELETE FROM notifications
+		WHERE type IN (?, ?)
+		AND ((to_user_id = ? AND from_user_id = ?) OR (to_user_id = ? AND from_user_id = ?))`,
+		m.NotificationTypeFollow, m.NotificationTypeAccept, userID, blockedID, blockedID, userID,
+	); err != nil {
+		log.Printf("Error removing follow notifications of blocked user %d: %v", blockedID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	notifications.PublishUnreadCount(int(userID))
+	notifications.PublishUnreadCount(int(blockedID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnblockUser removes {id} from the caller's block list. Follows removed by
+// the block are not restored.
+func UnblockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	blockedID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := sqlite.DB.Exec(
+		"DELETE FROM blocks WHERE blocker_id = ? AND blocked_id = ?",
+		userID, blockedID,
+	)
+	if err != nil {
+		log.Printf("Error unblocking user %d: %v", blockedID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		http.Error(w, "User is not blocked", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBlockedUsers lists the users the caller has blocked, most recent first
+func GetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	rows, err := sqlite.DB.Query(`
+		SELECT u.id, u.username, u.avatar, b.created_at
+		FROM blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = ?
+		ORDER BY b.created_at DESC, b.id DESC`,
+		userID,
+	)
+	if err != nil {
+		log.Printf("Error fetching blocked users: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	users := []m.BlockedUser{}
+	for rows.Next() {
+		var user m.BlockedUser
+		var avatar sql.NullString
+		if err := rows.Scan(&user.ID, &user.Username, &avatar, &user.BlockedAt); err != nil {
+			log.Printf("Error scanning blocked user: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		user.Avatar = avatar.String
+		users = append(users, user)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
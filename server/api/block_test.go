@@ -0,0 +1,135 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+	"social-network/util"
+
+	"github.com/gorilla/websocket"
+)
+
+// block has blockerID block blockedID through the endpoint
+func block(t *testing.T, blockerID, blockedID int64) {
+	t.Helper()
+	login := httptest.NewRecorder()
+	util.StartSession(login, uint(blockerID))
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/users/%d/block", blockedID), nil)
+	req.AddCookie(login.Result().Cookies()[0])
+	req.SetPathValue("id", fmt.Sprint(blockedID))
+	rec := httptest.NewRecorder()
+	BlockUser(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("blocking user %d returned %d: %s", blockedID, rec.Code, rec.Body)
+	}
+}
+
+func TestBlockRemovesFollowsBothWays(t *testing.T) {
+	sqlitetest.Open(t)
+
+	blocker := newTestUser(t, "blocker", false)
+	blocked := newTestUser(t, "blocked", false)
+	addFollow(t, blocker, blocked)
+	addFollow(t, blocked, blocker)
+
+	block(t, blocker, blocked)
+
+	var follows int
+	sqlite.DB.QueryRow(
+		"SELECT COUNT(*) FROM followers WHERE follower_id IN (?, ?) AND followed_id IN (?, ?)",
+		blocker, blocked, blocker, blocked,
+	).Scan(&follows)
+	if follows != 0 {
+		t.Errorf("%d follows are left between the two users", follows)
+	}
+	for _, pair := range [][2]int64{{blocker, blocked}, {blocked, blocker}} {
+		if blocked, err := isBlocked(pair[0], pair[1]); err != nil || !blocked {
+			t.Errorf("isBlocked(%d, %d) = %v, %v, want true", pair[0], pair[1], blocked, err)
+		}
+	}
+}
+
+func TestBlockedDirectMessagesAreDropped(t *testing.T) {
+	sqlitetest.Open(t)
+
+	blocker := newTestUser(t, "blocker", false)
+	blocked := newTestUser(t, "blocked", false)
+	block(t, blocker, blocked)
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		handleDirectMessage(conn, uint64(blocked), blocker, "hello")
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-done
+
+	var stored int
+	sqlite.DB.QueryRow("SELECT COUNT(*) FROM chat_messages WHERE sender_id = ?", blocked).Scan(&stored)
+	if stored != 0 {
+		t.Errorf("stored %d messages sent to the user who blocked the sender", stored)
+	}
+}
+
+func TestBlockedUsersCantBeInvitedToGroups(t *testing.T) {
+	sqlitetest.Open(t)
+
+	blocker := newTestUser(t, "blocker", false)
+	blocked := newTestUser(t, "blocked", false)
+	groupID := newGroup(t, blocker)
+	block(t, blocked, blocker)
+
+	body := fmt.Sprintf(`{"groupId": %d, "reciver_id": %d}`, groupID, blocked)
+	if rec := postAs(blocker, GroupInvitation, "/groups/invite", body); rec.Code != http.StatusForbidden {
+		t.Errorf("inviting a user who blocked you returned %d, want 403", rec.Code)
+	}
+	var members int
+	sqlite.DB.QueryRow("SELECT COUNT(*) FROM group_members WHERE group_id = ? AND user_id = ?", groupID, blocked).Scan(&members)
+	if members != 0 {
+		t.Error("the blocked user was added to the group")
+	}
+}
+
+func TestBlockedUsersAreHiddenFromSearchAndSuggestions(t *testing.T) {
+	sqlitetest.Open(t)
+
+	viewer := newTestUser(t, "viewer", false)
+	friend := newTestUser(t, "friend", false)
+	visible := newTestUser(t, "zanzibar_one", false)
+	hidden := newTestUser(t, "zanzibar_two", false)
+	addFollow(t, viewer, friend)
+	addFollow(t, friend, visible)
+	addFollow(t, friend, hidden)
+	block(t, hidden, viewer)
+
+	if ids := searchUserIDs(t, viewer, "zanzibar"); !slices.Equal(ids, []int{int(visible)}) {
+		t.Errorf("search found %v, want only %d", ids, visible)
+	}
+	if ids, _ := suggestionPage(t, viewer, 20, ""); !slices.Equal(ids, []int{int(visible)}) {
+		t.Errorf("suggestions = %v, want only %d", ids, visible)
+	}
+
+	// The block hides the viewer from the blocker too
+	if ids := searchUserIDs(t, hidden, "viewer"); slices.Contains(ids, int(viewer)) {
+		t.Errorf("the blocker found the user they blocked: %v", ids)
+	}
+}
@@ -6,6 +6,7 @@ import (
     "net/http"
     "sync"
     "time"
+    m "social-network/models"
     "social-network/pkg/db/sqlite"
     "social-network/util"
 
@@ -17,6 +18,7 @@ const (
     MessageTypeChat       = "chat"
     MessageTypeGroupChat  = "groupChat"
     MessageTypeTyping     = "typing"
+    MessageTypeError      = "error"
 )
 
 // Add this type definition at the top of the file, after the constants
@@ -140,11 +142,43 @@ func HandleChatMessages(conn *websocket.Conn, userID uint64, msg []byte) {
     }
 }
 
+// writeChatError tells the sender that their message to recipientID was not
+// sent
+func writeChatError(conn *websocket.Conn, recipientID int64, content string) {
+    conn.WriteJSON(struct {
+        Type        string `json:"type"`
+        RecipientID int64  `json:"recipient_id"`
+        Content     string `json:"content"`
+    }{
+        Type:        MessageTypeError,
+        RecipientID: recipientID,
+        Content:     content,
+    })
+}
+
 func handleDirectMessage(conn *websocket.Conn, senderID uint64, recipientID int64, content string) {
     if content == "" {
         return
     }
 
+    // Unverified accounts can't send direct messages once the grace period ends
+    allowed, err := emailVerifiedOrInGrace(senderID)
+    if err != nil {
+        log.Printf("Error checking email verification of user %d: %v", senderID, err)
+        writeChatError(conn, recipientID, "Your message could not be sent")
+        return
+    }
+    if !allowed {
+        writeChatError(conn, recipientID, "Verify your email to send direct messages")
+        return
+    }
+
+    // Messages between users who blocked one another are dropped
+    if blocked, err := isBlocked(int64(senderID), recipientID); err != nil || blocked {
+        log.Printf("Not delivering message from user %d to user %d: blocked", senderID, recipientID)
+        return
+    }
+
     now := time.Now()
 
     // Save message to database
@@ -154,11 +188,14 @@ func handleDirectMessage(conn *websocket.Conn, senderID uint64, recipientID int6
     `, senderID, recipientID, content, now)
     if err != nil {
         log.Printf("Error saving chat message: %v", err)
+        writeChatError(conn, recipientID, "Your message could not be sent")
         return
     }
 
     msgID, _ := result.LastInsertId()
 
+    indexContent(m.SourceChatMessage, msgID, senderID, 0, content)
+
     // Prepare response
     response := struct {
         Type        string    `json:"type"`
@@ -184,6 +221,9 @@ func handleDirectMessage(conn *websocket.Conn, senderID uint64, recipientID int6
         }
     }
 
+    // Reach the recipient through Web Push when they are away
+    webPushMessage(senderID, recipientID, content)
+
     // Send confirmation back to sender
     if err := conn.WriteJSON(response); err != nil {
         log.Printf("Error sending confirmation to sender: %v", err)
@@ -231,6 +271,8 @@ func handleGroupMessage(conn *websocket.Conn, senderID uint64, msg GroupChatMess
         return
     }
 
+    indexContent(m.SourceGroupChatMessage, msgID, senderID, int64(msg.Content.GroupID), msg.Content.Message)
+
     // Prepare response
     response := struct {
         Type      string    `json:"type"`
@@ -280,6 +322,10 @@ func handleGroupMessage(conn *websocket.Conn, senderID uint64, msg GroupChatMess
 }
 
 func handleTypingStatus(senderID uint64, recipientID int64, isTyping bool) {
+    if blocked, err := isBlocked(int64(senderID), recipientID); err != nil || blocked {
+        return
+    }
+
     response := struct {
         Type        string `json:"type"`
         SenderID    int64  `json:"sender_id"`
@@ -325,51 +371,3 @@ func RemoveChatConnection(sm *ChatSocketManager, userID uint64) {
         log.Printf("Removed chat connection for user %d", userID)
     }
 }
-
-func GetGroupChatMessages(w http.ResponseWriter, r *http.Request) {
-    groupID := r.URL.Query().Get("groupId")
-    if groupID == "" {
-        http.Error(w, "Missing group ID", http.StatusBadRequest)
-        return
-    }
-
-    // Get messages from database
-    rows, err := sqlite.DB.Query(`
-        SELECT gcm.id, gcm.sender_id, gcm.content, gcm.created_at, u.username
-        FROM group_chat_messages gcm
-        JOIN users u ON gcm.sender_id = u.id
-        WHERE gcm.group_id = ?
-        ORDER BY gcm.created_at DESC
-        LIMIT 50
-    `, groupID)
-    if err != nil {
-        http.Error(w, "Database error", http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-
-    var messages []struct {
-        ID        int64     `json:"id"`
-        SenderID  int64     `json:"sender_id"`
-        Content   string    `json:"content"`
-        CreatedAt time.Time `json:"created_at"`
-        Username  string    `json:"username"`
-    }
-
-    for rows.Next() {
-        var msg struct {
-            ID        int64     `json:"id"`
-            SenderID  int64     `json:"sender_id"`
-            Content   string    `json:"content"`
-            CreatedAt time.Time `json:"created_at"`
-            Username  string    `json:"username"`
-        }
-        if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.Content, &msg.CreatedAt, &msg.Username); err != nil {
-            continue
-        }
-        messages = append(messages, msg)
-    }
-
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(messages)
-} 
\ No newline at end of file
@@ -65,11 +65,25 @@ func CreateComment(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    blocked, err := isBlockedByAuthor("posts", int64(commentInput.PostID), currentUserID)
+    if err != nil {
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    if blocked {
+        http.Error(w, "You can't comment on this post", http.StatusForbidden)
+        return
+    }
+
     // Log the parsed input
     log.Printf("Parsed comment input: %+v", commentInput)
 
-    if strings.TrimSpace(commentInput.Content) == "" && commentInput.Media == "" {
-        http.Error(w, "Comment must have either content or media", http.StatusBadRequest)
+    v := util.Validator{}
+    v.Length("content", commentInput.Content, 0, maxCommentLength)
+    v.Check(strings.TrimSpace(commentInput.Content) != "" || commentInput.Media != "",
+        "content", "is required when there is no media")
+    if !v.Valid() {
+        v.Write(w, http.StatusBadRequest)
         return
     }
 
@@ -80,8 +94,8 @@ func CreateComment(w http.ResponseWriter, r *http.Request) {
     if commentInput.Media != "" {
         parts := strings.Split(commentInput.Media, ";base64,")
         if len(parts) != 2 {
-            log.Printf("Invalid media format: %s", commentInput.Media[:100])
-            http.Error(w, "Invalid media format", http.StatusBadRequest)
+            log.Printf("Invalid media format: %s", commentInput.Media[:min(len(commentInput.Media), 100)])
+            util.WriteFieldError(w, http.StatusBadRequest, "media", "must be a base64 data URL")
             return
         }
 
@@ -89,7 +103,7 @@ func CreateComment(w http.ResponseWriter, r *http.Request) {
         mediaBytes, err = base64.StdEncoding.DecodeString(parts[1])
         if err != nil {
             log.Printf("Base64 decode error: %v", err)
-            http.Error(w, "Invalid media encoding", http.StatusBadRequest)
+            util.WriteFieldError(w, http.StatusBadRequest, "media", "must be base64 encoded")
             return
         }
     }
@@ -116,6 +130,9 @@ func CreateComment(w http.ResponseWriter, r *http.Request) {
 
     commentID, _ := result.LastInsertId()
 
+    indexContent(m.SourceComment, commentID, currentUserID, 0, commentInput.Content)
+    notifyPostComment(int64(commentInput.PostID), commentID, currentUserID)
+
     // Fetch the complete comment data including author information
     var comment m.CommentResponse
     err = sqlite.DB.QueryRow(`
@@ -162,6 +179,11 @@ func CreateComment(w http.ResponseWriter, r *http.Request) {
 
 
 func GetComments(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
 	postIDString := r.PathValue("postID")
 
 	postID, err := strconv.Atoi(postIDString)
@@ -183,11 +205,11 @@ func GetComments(w http.ResponseWriter, r *http.Request) {
 			u.avatar as author_avatar
 		FROM comments c
 		JOIN users u ON c.author = u.id
-		WHERE c.post_id = ?
+		WHERE c.post_id = ? AND ` + notBlockedClause("c.author", "?") + `
 		ORDER BY c.created_at DESC
 	`
 
-	rows, err := sqlite.DB.Query(query, postID)
+	rows, err := sqlite.DB.Query(query, postID, userID, userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Post does not exist", http.StatusBadRequest)
@@ -290,6 +312,15 @@ func CreateGroupPostComment(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    v := util.Validator{}
+    v.Length("content", commentInput.Content, 0, maxCommentLength)
+    v.Check(strings.TrimSpace(commentInput.Content) != "" || commentInput.Media != "",
+        "content", "is required when there is no media")
+    if !v.Valid() {
+        v.Write(w, http.StatusBadRequest)
+        return
+    }
+
     // Verify user is a member of the group
     var isMember bool
     err = sqlite.DB.QueryRow(`
@@ -312,20 +343,30 @@ func CreateGroupPostComment(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    blocked, err := isBlockedByAuthor("group_posts", int64(postID), currentUserID)
+    if err != nil {
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    if blocked {
+        http.Error(w, "You can't comment on this post", http.StatusForbidden)
+        return
+    }
+
     var mediaBytes []byte
     var mediaType string
 
     if commentInput.Media != "" {
         parts := strings.Split(commentInput.Media, ";base64,")
         if len(parts) != 2 {
-            http.Error(w, "Invalid media format", http.StatusBadRequest)
+            util.WriteFieldError(w, http.StatusBadRequest, "media", "must be a base64 data URL")
             return
         }
 
         mediaType = strings.TrimPrefix(parts[0], "data:")
         mediaBytes, err = base64.StdEncoding.DecodeString(parts[1])
         if err != nil {
-            http.Error(w, "Invalid media encoding", http.StatusBadRequest)
+            util.WriteFieldError(w, http.StatusBadRequest, "media", "must be base64 encoded")
             return
         }
     }
@@ -349,6 +390,9 @@ func CreateGroupPostComment(w http.ResponseWriter, r *http.Request) {
 
     commentID, _ := result.LastInsertId()
 
+    indexContent(m.SourceGroupPostComment, commentID, currentUserID, int64(groupID), commentInput.Content)
+    notifyGroupPostComment(int64(groupID), int64(postID), commentID, currentUserID)
+
     // Fetch the created comment with user information
     var comment m.CommentResponse
     err = sqlite.DB.QueryRow(`
@@ -389,6 +433,11 @@ func CreateGroupPostComment(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetGroupPostComments(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
     postIDStr := r.PathValue("postId")
     groupIDStr := r.PathValue("groupId")
 
@@ -421,11 +470,11 @@ func GetGroupPostComments(w http.ResponseWriter, r *http.Request) {
             u.avatar as author_avatar
         FROM group_post_comments c
         JOIN users u ON c.author = u.id
-        WHERE c.post_id = ? AND c.group_id = ?
+        WHERE c.post_id = ? AND c.group_id = ? AND ` + notBlockedClause("c.author", "?") + `
         ORDER BY c.created_at DESC
     `
 
-    rows, err := sqlite.DB.Query(query, postID, groupID)
+    rows, err := sqlite.DB.Query(query, postID, groupID, userID, userID)
     if err != nil {
         log.Printf("Database error: %v", err)
         http.Error(w, "Database error", http.StatusInternalServerError)
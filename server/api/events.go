@@ -0,0 +1,305 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/notifications"
+	"social-network/util"
+)
+
+const (
+	// sseHeartbeat keeps idle streams from being closed by proxies
+	sseHeartbeat = 25 * time.Second
+
+	// sseReplayLimit caps how many missed notifications are sent on resume.
+	// Clients that missed more get a frameReset instead.
+	sseReplayLimit = 100
+
+	// frameReset tells a resuming client that it missed too much to be
+	// replayed and should reload its notifications
+	frameReset = "reset"
+)
+
+// sseEvent is one message on an event stream. Data is the same JSON that is
+// sent over /ws. Notifications carry their seq so clients can resume.
+type sseEvent struct {
+	ID   int
+	Data []byte
+}
+
+// eventHub tracks the open /events streams of every user
+type eventHub struct {
+	mu      sync.Mutex
+	streams map[int]map[chan sseEvent]struct{}
+}
+
+var eventStreams = &eventHub{streams: make(map[int]map[chan sseEvent]struct{})}
+
+// add opens a stream for a user and reports whether it is their first one
+func (h *eventHub) add(userID int) (chan sseEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan sseEvent, 32)
+	if h.streams[userID] == nil {
+		h.streams[userID] = make(map[chan sseEvent]struct{})
+	}
+	h.streams[userID][ch] = struct{}{}
+	return ch, len(h.streams[userID]) == 1
+}
+
+// remove closes a stream and reports whether it was the user's last one
+func (h *eventHub) remove(userID int, ch chan sseEvent) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.streams[userID], ch)
+	if len(h.streams[userID]) > 0 {
+		return false
+	}
+	delete(h.streams, userID)
+	return true
+}
+
+// send queues an event on every stream of a user. Streams that fall behind
+// miss the event rather than blocking the sender.
+func (h *eventHub) send(userID int, event sseEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.streams[userID] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Event stream of user %d is full, dropping event", userID)
+		}
+	}
+}
+
+// broadcast queues an event on every open stream
+func (h *eventHub) broadcast(event sseEvent) {
+	h.mu.Lock()
+	users := make([]int, 0, len(h.streams))
+	for userID := range h.streams {
+		users = append(users, userID)
+	}
+	h.mu.Unlock()
+
+	for _, userID := range users {
+		h.send(userID, event)
+	}
+}
+
+// online reports whether a user has an open stream
+func (h *eventHub) online(userID int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.streams[userID]) > 0
+}
+
+// users lists everyone with an open stream
+func (h *eventHub) users() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	users := make([]int, 0, len(h.streams))
+	for userID := range h.streams {
+		users = append(users, userID)
+	}
+	return users
+}
+
+// EventsHandler streams the caller's notifications and everyone's presence
+// as Server-Sent Events, for clients that can't open /ws. Each event's data
+// is the JSON frame /ws would send. After a reconnect, the notifications
+// created or updated since the Last-Event-ID are replayed, or a reset frame
+// is sent when there are more than sseReplayLimit of them.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	var resumeFrom int
+	if lastEventID != "" {
+		resumeFrom, err = strconv.Atoi(lastEventID)
+		if err != nil || resumeFrom < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Subscribe before replaying so nothing created in between is lost
+	events, first := eventStreams.add(int(userID))
+	defer func() {
+		if eventStreams.remove(int(userID), events) && !isOnlineOverSocket(userID) {
+			BroadcastUserStatus(socketManager, userID, false)
+		}
+	}()
+	if first && !isOnlineOverSocket(userID) {
+		go BroadcastUserStatus(socketManager, userID, true)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+
+	if resumeFrom > 0 {
+		missed, err := notificationsSince(int(userID), resumeFrom)
+		if err != nil {
+			log.Printf("Error replaying notifications for user %d: %v", userID, err)
+		}
+		if len(missed) > sseReplayLimit {
+			// The reset carries the newest seq so the next resume starts there
+			latest, err := latestNotificationSeq(int(userID))
+			if err != nil {
+				log.Printf("Error loading the latest notification of user %d: %v", userID, err)
+			}
+			writeFrame(w, latest, notifications.Frame{Type: frameReset, Data: map[string]int{"seq": latest}})
+		} else {
+			for _, n := range missed {
+				writeFrame(w, n.Seq, notifications.Frame{Type: notifications.FrameNotification, Data: n})
+			}
+		}
+	}
+
+	count, err := notifications.UnreadCount(sqlite.DB, int(userID))
+	if err == nil {
+		writeFrame(w, 0, notifications.Frame{Type: notifications.FrameUnreadCount, Data: map[string]int{"count": count}})
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			writeEvent(w, event)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// writeFrame writes a notification package frame as an event
+func writeFrame(w http.ResponseWriter, id int, frame notifications.Frame) {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		log.Printf("Error marshaling %s frame: %v", frame.Type, err)
+		return
+	}
+	writeEvent(w, sseEvent{ID: id, Data: data})
+}
+
+func writeEvent(w http.ResponseWriter, event sseEvent) {
+	if event.ID > 0 {
+		fmt.Fprintf(w, "id: %d\n", event.ID)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", event.Data)
+}
+
+// notificationEventID is the event id of a frame: notifications use their seq
+// so streams can resume from them, everything else has none. Unlike the row
+// id, the seq grows when a notification is updated by a fold.
+func notificationEventID(frame notifications.Frame) int {
+	if n, ok := frame.Data.(m.Notification); ok && frame.Type == notifications.FrameNotification {
+		return n.Seq
+	}
+	return 0
+}
+
+// isOnlineOverSocket reports whether a user has /ws open
+func isOnlineOverSocket(userID uint64) bool {
+	socketManager.Mu.Lock()
+	defer socketManager.Mu.Unlock()
+	_, online := socketManager.Sockets[userID]
+	return online
+}
+
+// notificationsSince loads the notifications of a user created or updated
+// after seq, in the order of their changes and in the shape they are pushed in.
+// It loads one more than sseReplayLimit so callers can tell the replay would
+// be cut short.
+func notificationsSince(userID, seq int) ([]m.Notification, error) {
+	rows, err := sqlite.DB.Query(`
+		SELECT id, to_user_id, content, from_user_id, read, created_at, type, group_id,
+			target_type, target_id, actor_count, updated_at, seq
+		FROM notifications
+		WHERE to_user_id = ? AND seq > ?
+		ORDER BY seq
+		LIMIT ?`,
+		userID, seq, sseReplayLimit+1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []m.Notification
+	var ids []int
+	for rows.Next() {
+		var n m.Notification
+		var fromUserID, groupID, targetID sql.NullInt64
+		var targetType sql.NullString
+		if err := rows.Scan(
+			&n.ID, &n.ToUserID, &n.Content, &fromUserID, &n.Read, &n.CreatedAt, &n.Type, &groupID,
+			&targetType, &targetID, &n.ActorCount, &n.UpdatedAt, &n.Seq,
+		); err != nil {
+			return nil, err
+		}
+		n.FromUserID = int(fromUserID.Int64)
+		n.GroupID = int(groupID.Int64)
+		n.TargetType = targetType.String
+		n.TargetID = int(targetID.Int64)
+		list = append(list, n)
+		ids = append(ids, n.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	actors, err := notifications.Actors(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Actors = actors[list[i].ID]
+	}
+	return list, nil
+}
+
+// latestNotificationSeq is the seq of the last change to a user's notifications
+func latestNotificationSeq(userID int) (int, error) {
+	var seq int
+	err := sqlite.DB.QueryRow(
+		"SELECT COALESCE(MAX(seq), 0) FROM notifications WHERE to_user_id = ?", userID,
+	).Scan(&seq)
+	return seq, err
+}
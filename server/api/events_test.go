@@ -0,0 +1,193 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite/sqlitetest"
+	"social-network/pkg/notifications"
+	"social-network/util"
+)
+
+// like notifies user 1 that actorID liked postID
+func like(t *testing.T, actorID, postID int) m.Notification {
+	t.Helper()
+	n := m.Notification{
+		ToUserID:       1,
+		FromUserID:     actorID,
+		Content:        "liked your post",
+		Type:           m.NotificationPostLike,
+		CreatedAt:      time.Now(),
+		IdempotencyKey: notifications.Key(m.NotificationPostLike, postID, actorID),
+		TargetType:     m.SourcePost,
+		TargetID:       postID,
+	}
+	if err := notifications.Send(&n); err != nil {
+		t.Fatalf("sending like notification: %v", err)
+	}
+	return n
+}
+
+// streamEvents runs /events for user 1 with lastEventID until the replay is
+// written, and returns the ids and data of the events sent. Presence frames
+// are left out.
+func streamEvents(t *testing.T, lastEventID int) (ids []string, data []string) {
+	t.Helper()
+
+	login := httptest.NewRecorder()
+	util.StartSession(login, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(ctx)
+	req.AddCookie(login.Result().Cookies()[0])
+	req.Header.Set("Last-Event-ID", fmt.Sprint(lastEventID))
+
+	rec := httptest.NewRecorder()
+	EventsHandler(rec, req)
+
+	for _, block := range strings.Split(rec.Body.String(), "\n\n") {
+		var id, payload string
+		for _, line := range strings.Split(block, "\n") {
+			if value, ok := strings.CutPrefix(line, "id: "); ok {
+				id = value
+			}
+			if value, ok := strings.CutPrefix(line, "data: "); ok {
+				payload = value
+			}
+		}
+		if payload != "" && !strings.Contains(payload, `"type":"user_status"`) {
+			ids = append(ids, id)
+			data = append(data, payload)
+		}
+	}
+	return ids, data
+}
+
+func TestEventIDsGrowWhenNotificationsFold(t *testing.T) {
+	sqlitetest.Open(t)
+	notifications.SetPublisher(SendToUser)
+	defer notifications.SetPublisher(nil)
+
+	first := like(t, 2, 10)
+	second := like(t, 2, 11)
+	folded := like(t, 3, 10)
+
+	if folded.ID != first.ID {
+		t.Fatalf("second like of post 10 created notification %d, want it folded into %d", folded.ID, first.ID)
+	}
+	if !(first.Seq < second.Seq && second.Seq < folded.Seq) {
+		t.Errorf("seqs = %d, %d, %d, want them increasing", first.Seq, second.Seq, folded.Seq)
+	}
+
+	frame := notifications.Frame{Type: notifications.FrameNotification, Data: folded}
+	if got := notificationEventID(frame); got != folded.Seq {
+		t.Errorf("event id of the folded notification = %d, want its seq %d", got, folded.Seq)
+	}
+}
+
+func TestEventsResumeReplaysFoldedNotifications(t *testing.T) {
+	sqlitetest.Open(t)
+	notifications.SetPublisher(SendToUser)
+	defer notifications.SetPublisher(nil)
+
+	// The client saw the first like, then went away while another post was
+	// liked and a second actor was folded into the first notification
+	first := like(t, 2, 10)
+	second := like(t, 2, 11)
+	like(t, 3, 10)
+
+	missed, err := notificationsSince(1, first.Seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missed) != 2 {
+		t.Fatalf("replayed %d notifications, want 2", len(missed))
+	}
+	if missed[0].ID != second.ID || missed[1].ID != first.ID {
+		t.Errorf("replayed ids %d, %d, want %d then the folded %d", missed[0].ID, missed[1].ID, second.ID, first.ID)
+	}
+	if missed[1].ActorCount != 2 || len(missed[1].Actors) != 2 {
+		t.Errorf("folded notification has %d actors (%d listed), want 2", missed[1].ActorCount, len(missed[1].Actors))
+	}
+
+	ids, data := streamEvents(t, first.Seq)
+	if len(ids) != 3 {
+		t.Fatalf("stream sent %d events, want 2 replayed notifications and the unread count: %v", len(ids), data)
+	}
+	if ids[0] != fmt.Sprint(missed[0].Seq) || ids[1] != fmt.Sprint(missed[1].Seq) {
+		t.Errorf("replayed event ids %q, %q, want %d, %d", ids[0], ids[1], missed[0].Seq, missed[1].Seq)
+	}
+	if ids[2] != "" || !strings.Contains(data[2], `"unread_count"`) {
+		t.Errorf("last event = id %q data %s, want an unread count without id", ids[2], data[2])
+	}
+
+	// Resuming from the newest id replays nothing, not the folded one again
+	ids, _ = streamEvents(t, missed[1].Seq)
+	if len(ids) != 1 {
+		t.Errorf("resuming from the latest event sent %d events, want only the unread count", len(ids))
+	}
+}
+
+func TestEventsLiveIDsMatchReplay(t *testing.T) {
+	sqlitetest.Open(t)
+	notifications.SetPublisher(SendToUser)
+	defer notifications.SetPublisher(nil)
+
+	events, _ := eventStreams.add(1)
+	defer eventStreams.remove(1, events)
+
+	first := like(t, 2, 10)
+	folded := like(t, 3, 10)
+
+	var live []int
+	for len(live) < 2 {
+		select {
+		case event := <-events:
+			if event.ID > 0 {
+				live = append(live, event.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("got live event ids %v, want 2", live)
+		}
+	}
+	if live[0] != first.Seq || live[1] != folded.Seq || live[1] <= live[0] {
+		t.Errorf("live event ids = %v, want %d then %d", live, first.Seq, folded.Seq)
+	}
+}
+
+func TestEventsResetWhenTooMuchWasMissed(t *testing.T) {
+	sqlitetest.Open(t)
+
+	first := like(t, 2, 1000)
+	second := like(t, 2, 1001)
+	var last m.Notification
+	for post := 1002; post <= 1001+sseReplayLimit; post++ {
+		last = like(t, 2, post)
+	}
+
+	ids, data := streamEvents(t, first.Seq)
+	if len(ids) != 2 {
+		t.Fatalf("stream sent %d events, want a reset and the unread count", len(ids))
+	}
+	if !strings.Contains(data[0], `"type":"reset"`) {
+		t.Errorf("first event = %s, want a reset", data[0])
+	}
+	if ids[0] != fmt.Sprint(last.Seq) {
+		t.Errorf("reset event id = %q, want the latest seq %d", ids[0], last.Seq)
+	}
+
+	// Exactly the limit is still replayed in full
+	ids, _ = streamEvents(t, second.Seq)
+	if len(ids) != sseReplayLimit+1 {
+		t.Errorf("stream sent %d events, want %d replayed notifications and the unread count", len(ids), sseReplayLimit)
+	}
+}
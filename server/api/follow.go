@@ -3,27 +3,26 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"social-network/models"
 	"social-network/pkg/db/sqlite"
+	"social-network/pkg/follow"
+	"social-network/pkg/notifications"
 	"social-network/util"
 )
 
 // subject to change might be changed to websockets
 func RequestFollowUser(w http.ResponseWriter, r *http.Request) {
-	log.Println("RequestFollowUser called")
-	
 	// Get the current user's ID from the session
 	currentUserID, err := util.GetUserID(r, w)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -36,106 +35,44 @@ func RequestFollowUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if followed user exists and get their privacy status
-	var isPrivate bool
-	err = sqlite.DB.QueryRow(`
-		SELECT is_private FROM users WHERE id = ?
-	`, request.FollowedID).Scan(&isPrivate)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "User you are trying to follow does not exist", http.StatusBadRequest)
-			return
-		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	if uint64(request.FollowedID) == currentUserID {
+		http.Error(w, "You can't follow yourself", http.StatusBadRequest)
 		return
 	}
 
-	// Get follower's username for notifications
-	var followerUsername string
-	err = sqlite.DB.QueryRow(`
-		SELECT username FROM users WHERE id = ?
-	`, currentUserID).Scan(&followerUsername)
+	exists, err := models.DoesUserExist(request.FollowedID, sqlite.DB)
 	if err != nil {
-		log.Printf("Error getting username: %v", err)
-		followerUsername = "Someone" // Fallback username
-	}
-
-	// Check if follow relationship already exists
-	var existingStatus string
-	err = sqlite.DB.QueryRow(`
-			SELECT status FROM followers 
-			WHERE follower_id = ? AND followed_id = ?
-	`, currentUserID, request.FollowedID).Scan(&existingStatus)
-	if err == nil {
-		// Follow relationship exists
-		response := models.FollowResponse{
-			Status:  existingStatus,
-			Message: fmt.Sprintf("Follow request already exists with status: %s", existingStatus),
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
-		return
-	} else if err != sql.ErrNoRows {
-		// Unexpected error
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-
-	// Set initial status based on privacy
-	status := "accept"
-	if isPrivate {
-		status = "pending"
+	if !exists {
+		http.Error(w, "User you are trying to follow does not exist", http.StatusBadRequest)
+		return
 	}
 
-	// Insert follow request
-	_, err = sqlite.DB.Exec(`
-		INSERT INTO followers (follower_id, followed_id, status, created_at) 
-		VALUES (?, ?, ?, ?)
-	`, currentUserID, request.FollowedID, status, time.Now())
+	blocked, err := isBlocked(int64(currentUserID), int64(request.FollowedID))
 	if err != nil {
-		http.Error(w, "Error creating follow request", http.StatusInternalServerError)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "You can't follow this user", http.StatusForbidden)
 		return
 	}
 
-	// If the profile is private, create a notification
-	if isPrivate {
-		notification := models.Notification{
-			ToUserID:   int(request.FollowedID),
-			FromUserID: int(currentUserID),
-			Content:    fmt.Sprintf("%s wants to follow you", followerUsername),
-			Type:       models.NotificationTypeFollow,
-			CreatedAt:  time.Now(),
-			Read:       false,
-		}
-
-		result, err := sqlite.DB.Exec(`
-			INSERT INTO notifications 
-			(to_user_id, from_user_id, content, type, read, created_at) 
-			VALUES (?, ?, ?, ?, ?, ?)
-		`, 
-		notification.ToUserID, 
-		notification.FromUserID, 
-		notification.Content,
-		notification.Type,
-		notification.Read,
-		notification.CreatedAt)
-
-		if err != nil {
-			log.Printf("Error creating notification: %v", err)
-		} else {
-			id, _ := result.LastInsertId()
-			notification.ID = int(id)
-			// Broadcast the notification
-			BroadcastNotification(notification)
-		}
+	res, ok := applyFollow(w, int(currentUserID), int(request.FollowedID), follow.ActionRequest, "Follow request not possible")
+	if !ok {
+		return
 	}
 
 	// Send response
 	response := models.FollowResponse{
-		Status:  status,
-		Message: fmt.Sprintf("Follow request %s", status),
+		Status:  res.To,
+		Message: fmt.Sprintf("Follow request %s", res.To),
+	}
+	if res.From == res.To {
+		response.Message = fmt.Sprintf("Follow request already exists with status: %s", res.To)
 	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -144,7 +81,6 @@ func UnfollowUser(w http.ResponseWriter, r *http.Request) {
 	// Get the current user's ID from the session
 	currentUserID, err := util.GetUserID(r, w)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -158,13 +94,8 @@ func UnfollowUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error reading json", http.StatusBadRequest)
 		return
 	}
-	
-	//query to delete the follow row
-	query := `DELETE FROM followers WHERE follower_id = ? AND followed_id = ?`
-	_, err = sqlite.DB.Exec(query, currentUserID, request.FollowedID)
 
-	if err != nil {
-		http.Error(w, "Error deleting follow request", http.StatusInternalServerError)
+	if _, ok := applyFollow(w, int(currentUserID), int(request.FollowedID), follow.ActionUnfollow, "You don't follow this user"); !ok {
 		return
 	}
 
@@ -173,129 +104,70 @@ func UnfollowUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Unfollow DONE"})
 }
 
-func HandelAcceptOrRejectRequest(w http.ResponseWriter, r *http.Request) {
-    requestIdStr := r.PathValue("id")
-    log.Printf("Handling follow request: %s", requestIdStr)
-
-    requestId, err := strconv.Atoi(requestIdStr)
-    if err != nil {
-        log.Printf("Invalid request ID: %v", err)
-        http.Error(w, "Invalid request ID", http.StatusBadRequest)
-        return
-    }
+// CancelFollowRequest withdraws the caller's pending request to follow {id}
+// and retracts the follow request notification it produced
+func CancelFollowRequest(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
 
-    // Get the current user's ID
-    currentUserID, err := util.GetUserID(r, w)
-    if err != nil {
-        log.Printf("Auth error: %v", err)
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
-        return
-    }
+	followedID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
 
-    var req struct {
-        Status string `json:"status"`
-    }
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        log.Printf("Error decoding request body: %v", err)
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
-        return
-    }
+	if _, ok := applyFollow(w, int(userID), followedID, follow.ActionCancel, "Follow request not found"); !ok {
+		return
+	}
 
-    // Start a transaction
-    tx, err := sqlite.DB.Begin()
-    if err != nil {
-        http.Error(w, "Database error", http.StatusInternalServerError)
-        return
-    }
-    defer tx.Rollback()
-
-    // Get the follower ID from the followers table
-    var followerID int
-    err = tx.QueryRow(`
-        SELECT follower_id
-        FROM followers
-        WHERE id = ? AND followed_id = ? AND status = 'pending'
-    `, requestId, currentUserID).Scan(&followerID)
-    if err != nil {
-        log.Printf("Error getting follow request: %v", err)
-        http.Error(w, "Follow request not found", http.StatusNotFound)
-        return
-    }
+	SendToUser(followedID, notifications.Frame{
+		Type: MessageTypeFollowUpdate,
+		Data: models.FollowUpdate{FollowerID: int(userID), FollowedID: followedID, Status: models.FollowCancelled},
+	})
 
-    if req.Status == "accept" {
-        // Update the follow request to "accept"
-        _, err := tx.Exec(`
-            UPDATE followers 
-            SET status = 'accept'
-            WHERE id = ? AND followed_id = ?
-        `, requestId, currentUserID)
-        if err != nil {
-            log.Printf("Error updating follow status: %v", err)
-            http.Error(w, "Error updating follow status", http.StatusInternalServerError)
-            return
-        }
+	w.WriteHeader(http.StatusNoContent)
+}
 
-        // Create a notification for the acceptance
-        _, err = tx.Exec(`
-            INSERT INTO notifications (
-                to_user_id,
-                from_user_id,
-                content,
-                type,
-                read,
-                created_at
-            ) VALUES (?, ?, ?, ?, false, ?)
-        `, followerID, currentUserID,
-            fmt.Sprintf("User %d accepted your follow request", currentUserID),
-            "follow_accept", time.Now())
-        if err != nil {
-            log.Printf("Error creating acceptance notification: %v", err)
-        }
-    } else if req.Status == "reject" {
-        // Delete the follow request
-        _, err := tx.Exec(`
-            DELETE FROM followers 
-            WHERE id = ? AND followed_id = ?
-        `, requestId, currentUserID)
-        if err != nil {
-            log.Printf("Error deleting follow request: %v", err)
-            http.Error(w, "Error deleting follow request", http.StatusInternalServerError)
-            return
-        }
-    }
+// RemoveFollower stops {id} from following the caller. The follower's
+// notification that their request was accepted is retracted as well.
+func RemoveFollower(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
 
-    // Commit the transaction
-    if err := tx.Commit(); err != nil {
-        log.Printf("Error committing transaction: %v", err)
-        http.Error(w, "Error committing transaction", http.StatusInternalServerError)
-        return
-    }
+	followerID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
 
-    // Send success response
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{
-        "status": "success",
-        "message": fmt.Sprintf("Follow request %sed", req.Status),
-    })
-}
+	if _, ok := applyFollow(w, followerID, int(userID), follow.ActionRemove, "Follower not found"); !ok {
+		return
+	}
 
+	SendToUser(followerID, notifications.Frame{
+		Type: MessageTypeFollowUpdate,
+		Data: models.FollowUpdate{FollowerID: followerID, FollowedID: int(userID), Status: models.FollowRemoved},
+	})
 
-func AcceptOrRejectRequest(w http.ResponseWriter, r *http.Request) {
-	requestIdStr := r.PathValue("id")
-	log.Printf("Handling follow request: %s", requestIdStr)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	requestId, err := strconv.Atoi(requestIdStr)
+// RespondToFollowRequest accepts or rejects the pending request of user {id}
+// to follow the caller. A rejected user can ask again after
+// follow.RequestCooldown.
+func RespondToFollowRequest(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
 	if err != nil {
-		log.Printf("Invalid request ID: %v", err)
-		http.Error(w, "Invalid request ID", http.StatusBadRequest)
 		return
 	}
 
-	// Get the current user's ID
-	currentUserID, err := util.GetUserID(r, w)
+	followerID, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		log.Printf("Auth error: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 
@@ -303,174 +175,219 @@ func AcceptOrRejectRequest(w http.ResponseWriter, r *http.Request) {
 		Status string `json:"status"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request body: %v", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if req.Status != follow.ActionAccept && req.Status != follow.ActionReject {
+		http.Error(w, "status must be accept or reject", http.StatusBadRequest)
+		return
+	}
 
-	// Start a transaction
+	if _, ok := applyFollow(w, followerID, int(userID), req.Status, "Follow request not found"); !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": fmt.Sprintf("Follow request %sed", req.Status),
+	})
+}
+
+// applyFollow takes a follow action in its own transaction and publishes its
+// notifications. When the action is not possible in the current state it
+// responds 404 with notFound, and 429 while a rejected request cools down.
+// Requesting a follow that already exists is not an error: the result then
+// has the same From and To state.
+func applyFollow(w http.ResponseWriter, followerID, followedID int, action, notFound string) (*follow.Result, bool) {
 	tx, err := sqlite.DB.Begin()
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 	defer tx.Rollback()
 
-	// Get the follower ID and notification ID
-	var followerID int
-	var notificationID int
-	err = tx.QueryRow(`
-		SELECT from_user_id, id
-		FROM notifications 
-		WHERE id = ? AND to_user_id = ? AND type = 'follow_request' AND read = false
-	`, requestId, currentUserID).Scan(&followerID, &notificationID)
-	if err != nil {
-		log.Printf("Error getting follower ID: %v", err)
-		http.Error(w, "Follow request not found", http.StatusNotFound)
-		return
+	res, err := follow.Apply(tx, followerID, followedID, action)
+	var cooldown *follow.CooldownError
+	switch {
+	case err == follow.ErrAlreadyRequested:
+		return res, true
+	case err == follow.ErrInvalidTransition:
+		http.Error(w, notFound, http.StatusNotFound)
+		return nil, false
+	case errors.As(err, &cooldown):
+		w.Header().Set("Retry-After", strconv.Itoa(int(cooldown.RetryAfter.Seconds())+1))
+		http.Error(w, "Your follow request was rejected recently, try again later", http.StatusTooManyRequests)
+		return nil, false
+	case err != nil:
+		log.Printf("Error applying follow %s from %d to %d: %v", action, followerID, followedID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil, false
 	}
 
-	// Get usernames for notification before creating notifications
-	var followerUsername, currentUsername string
-	err = tx.QueryRow("SELECT username FROM users WHERE id = ?", followerID).Scan(&followerUsername)
-	if err != nil {
-		log.Printf("Error getting follower username: %v", err)
-		followerUsername = "Someone"
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil, false
 	}
-	err = tx.QueryRow("SELECT username FROM users WHERE id = ?", currentUserID).Scan(&currentUsername)
-	if err != nil {
-		log.Printf("Error getting current username: %v", err)
-		currentUsername = "Someone"
-	}
-
-	// Update the follow request status in followers table for both users
-	if req.Status == "accept" {
-		// Update the original follow request status
-		result, err := tx.Exec(`
-			UPDATE followers 
-			SET status = ? 
-			WHERE follower_id = ? AND followed_id = ? AND status = 'pending'
-		`, req.Status, followerID, currentUserID)
-		if err != nil {
-			log.Printf("Error updating follow status: %v", err)
-			http.Error(w, "Error updating follow status", http.StatusInternalServerError)
-			return
-		}
+	res.Publish()
+	return res, true
+}
 
-		rowsAffected, _ := result.RowsAffected()
-		log.Printf("Updated %d rows in followers table for original request", rowsAffected)
+const (
+	defaultFollowPageSize = 50
+	maxFollowPageSize     = 100
+)
 
-		// Create reciprocal follow relationship
-		_, err = tx.Exec(`
-			INSERT OR IGNORE INTO followers (follower_id, followed_id, status, created_at)
-			VALUES (?, ?, 'accept', ?)
-		`, currentUserID, followerID, time.Now())
-		if err != nil {
-			log.Printf("Error creating reciprocal follow: %v", err)
-			http.Error(w, "Error creating reciprocal follow", http.StatusInternalServerError)
-			return
-		}
+// GetFollowers lists the users following {userId}, or the caller when it is
+// missing or "current"
+func GetFollowers(w http.ResponseWriter, r *http.Request) {
+	followList(w, r, true)
+}
 
-		// Create acceptance notification
-		_, err = tx.Exec(`
-			INSERT INTO notifications (
-				to_user_id, 
-				from_user_id, 
-				content, 
-				type, 
-				read, 
-				created_at
-			) VALUES (?, ?, ?, ?, false, ?)
-		`, followerID, currentUserID, 
-		   fmt.Sprintf("%s accepted your follow request", currentUsername),
-		   models.NotificationTypeAccept, time.Now())
+// GetFollowing lists the users {userId} follows, or the caller when it is
+// missing or "current"
+func GetFollowing(w http.ResponseWriter, r *http.Request) {
+	followList(w, r, false)
+}
 
+// followList writes a page of accepted follows of the user in the path, most
+// recent first. A private account's lists are only shown to the account and
+// its followers. `q` keeps users whose username starts with it. A full page
+// sets X-Next-Cursor to the cursor to pass as `before` for the next one.
+func followList(w http.ResponseWriter, r *http.Request, followers bool) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	targetID := int64(userID)
+	if value := r.PathValue("userId"); value != "" && value != "current" {
+		targetID, err = strconv.ParseInt(value, 10, 64)
 		if err != nil {
-			log.Printf("Error creating acceptance notification: %v", err)
-		}
-	} else {
-		// If rejecting, just delete the follow request
-		_, err = tx.Exec(`
-			DELETE FROM followers 
-			WHERE follower_id = ? AND followed_id = ? AND status = 'pending'
-		`, followerID, currentUserID)
-		if err != nil {
-			log.Printf("Error deleting follow request: %v", err)
-			http.Error(w, "Error deleting follow request", http.StatusInternalServerError)
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
 			return
 		}
 	}
 
-	// Delete all follow request notifications
-	_, err = tx.Exec(`
-		DELETE FROM notifications 
-		WHERE to_user_id = ? 
-		AND from_user_id = ? 
-		AND type = 'follow_request'
-	`, currentUserID, followerID)
+	beforeDay, beforeID, err := util.ParseTimeCursor(r)
 	if err != nil {
-		log.Printf("Error deleting follow request notifications: %v", err)
-	}
-
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Send success response
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "success",
-		"message": fmt.Sprintf("Follow request %sed", req.Status),
-	})
-}
-
-func GetFollowers(w http.ResponseWriter, r *http.Request) {
-	// Get the user ID from the request
-	userId, err := util.GetUserID(r, w)
+	limit, err := util.PageSize(r, defaultFollowPageSize, maxFollowPageSize)
 	if err != nil {
-		http.Error(w, "problem in getting user id", http.StatusUnauthorized)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var followers []models.Follow
+	if targetID != int64(userID) {
+		visible, err := followsVisible(int64(userID), targetID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
 
-	// Modify the query to join the `followers` table with the `users` table
-	query := `
-        SELECT f.id, f.follower_id, f.followed_id, f.status, f.created_at, u.username
-        FROM followers f
-        JOIN users u ON u.id = f.follower_id
-        WHERE f.followed_id = ? AND f.status = 'accept'`
+		blocked, err := isBlocked(int64(userID), targetID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
 
-	rows, err := sqlite.DB.Query(query, userId)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "No followers found", http.StatusBadRequest)
+		if !visible {
+			http.Error(w, "This account is private", http.StatusForbidden)
 			return
 		}
-		http.Error(w, "Something went wrong", http.StatusInternalServerError)
-		log.Printf("Error getting followers: %v", err)
+	}
+
+	// The list is of the users on the other side of the follow
+	ownColumn, otherColumn := "f.follower_id", "f.followed_id"
+	if followers {
+		ownColumn, otherColumn = "f.followed_id", "f.follower_id"
+	}
+
+	prefix := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(r.URL.Query().Get("q")) + "%"
+
+	rows, err := sqlite.DB.Query(`
+		SELECT
+			f.id,
+			f.follower_id,
+			f.followed_id,
+			u.username,
+			COALESCE(u.avatar, '') as avatar,
+			f.status,
+			f.created_at,
+			f.responded_at,
+			julianday(COALESCE(f.responded_at, f.created_at))
+		FROM followers f
+		JOIN users u ON u.id = `+otherColumn+`
+		WHERE `+ownColumn+` = :user AND f.status = 'accept'
+		AND u.username LIKE :prefix ESCAPE '\'
+		AND `+notBlockedClause("u.id", ":viewer")+`
+		AND (
+			:before_id = 0
+			OR (julianday(COALESCE(f.responded_at, f.created_at)), f.id) < (:before_day, :before_id)
+		)
+		ORDER BY julianday(COALESCE(f.responded_at, f.created_at)) DESC, f.id DESC
+		LIMIT :limit`,
+		sql.Named("user", targetID),
+		sql.Named("viewer", userID),
+		sql.Named("prefix", prefix),
+		sql.Named("before_day", beforeDay),
+		sql.Named("before_id", beforeID),
+		sql.Named("limit", limit),
+	)
+	if err != nil {
+		log.Printf("Error listing follows: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
+	defer rows.Close()
 
-	// Iterate over the rows to fetch the follower information
+	follows := []models.Follow{}
+	var lastDay float64
 	for rows.Next() {
-		var follower models.Follow
-		if err := rows.Scan(&follower.ID, &follower.FollowerID, &follower.FollowedID, &follower.Status, &follower.CreatedAt, &follower.Username); err != nil {
-			http.Error(w, "Something went wrong", http.StatusInternalServerError)
-			log.Printf("Error scanning follower: %v", err)
+		var follow models.Follow
+		var respondedAt sql.NullTime
+		if err := rows.Scan(
+			&follow.ID,
+			&follow.FollowerID,
+			&follow.FollowedID,
+			&follow.Username,
+			&follow.Avatar,
+			&follow.Status,
+			&follow.CreatedAt,
+			&respondedAt,
+			&lastDay,
+		); err != nil {
+			log.Printf("Error scanning follow row: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
-
-		followers = append(followers, follower)
+		// An approved request was followed when it was accepted
+		if respondedAt.Valid {
+			follow.CreatedAt = respondedAt.Time
+		}
+		follows = append(follows, follow)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
 	}
 
-	// Send the followers data back as a JSON response
-	if err := json.NewEncoder(w).Encode(&followers); err != nil {
-		http.Error(w, "Error sending data", http.StatusInternalServerError)
+	if len(follows) == limit {
+		w.Header().Set("X-Next-Cursor", util.TimeCursor(lastDay, int64(follows[len(follows)-1].ID)))
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(follows)
 }
 
 func CloseFriend(w http.ResponseWriter, r *http.Request) {
@@ -494,65 +411,34 @@ func CloseFriend(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	closeFriendsStr := strings.Join(closeFriend.Usernames, ",")
-
-	// Check if the user has an existing entry in post_PrivateViews
-	var existingCloseFriends string
-	query := `SELECT close_friends FROM post_PrivateViews WHERE user_id = ?`
-	err = sqlite.DB.QueryRow(query, userId).Scan(&existingCloseFriends)
-
-	if err == sql.ErrNoRows {
-		log.Printf("No existing entry found for user_id %d. Inserting new entry.", userId)
-
-		// Insert a new entry for the user if no row exists
-		insertQuery := `INSERT INTO post_PrivateViews (user_id, close_friends) VALUES (?, ?)`
-		_, insertErr := sqlite.DB.Exec(insertQuery, userId, closeFriendsStr)
-		if insertErr != nil {
-			log.Printf("Failed to insert close friends for new user_id %d: %v", userId, insertErr)
-			http.Error(w, "failed to insert close friends for new user", http.StatusInternalServerError)
-			return
-		}
-
-		response := map[string]string{"message": "Close friends added successfully"}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(response)
-		return
-
-	} else if err != nil {
-		log.Printf("Error retrieving close friends for user_id %d: %v", userId, err)
-		http.Error(w, "failed to retrieve existing close friends", http.StatusInternalServerError)
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		http.Error(w, "failed to update close friends", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	// updating if existing close friends are found
-	existingList := strings.Split(existingCloseFriends, ",")
-	for i, user := range existingList {
-		existingList[i] = strings.TrimSpace(user)
-	}
-
-	// check selected usernames and update list
-	friendMap := make(map[string]bool)
-	for _, user := range closeFriend.Usernames {
-		friendMap[user] = true
+	if _, err := tx.Exec(`DELETE FROM close_friends WHERE user_id = ?`, userId); err != nil {
+		log.Printf("Error clearing close friends for user_id %d: %v", userId, err)
+		http.Error(w, "failed to update close friends", http.StatusInternalServerError)
+		return
 	}
 
-	updatedList := make([]string, 0)
-	for _, user := range existingList {
-		if friendMap[user] {
-			updatedList = append(updatedList, user)
-			delete(friendMap, user)
+	// Unknown users and the caller themselves are skipped
+	for _, friendID := range closeFriend.UserIDs {
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO close_friends (user_id, friend_id, created_at)
+			SELECT ?, id, CURRENT_TIMESTAMP FROM users WHERE id = ? AND id != ?`,
+			userId, friendID, userId,
+		)
+		if err != nil {
+			log.Printf("Error adding close friend %d for user_id %d: %v", friendID, userId, err)
+			http.Error(w, "failed to update close friends", http.StatusInternalServerError)
+			return
 		}
 	}
 
-	for user := range friendMap {
-		updatedList = append(updatedList, user)
-	}
-
-	updatedCloseFriendsStr := strings.Join(updatedList, ",")
-	updateQuery := `UPDATE post_PrivateViews SET close_friends = ? WHERE user_id = ?`
-	_, err = sqlite.DB.Exec(updateQuery, updatedCloseFriendsStr, userId)
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		log.Printf("Error updating close friends for user_id %d: %v", userId, err)
 		http.Error(w, "failed to update close friends", http.StatusInternalServerError)
 		return
@@ -622,7 +508,7 @@ func FollowRequestHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     query := `
-    SELECT followers.id, followers.follower_id, users.username, COALESCE(users.avatar, '') as avatar
+    SELECT followers.id, followers.follower_id, followers.followed_id, users.username, COALESCE(users.avatar, '') as avatar
     FROM followers 
     JOIN users ON followers.follower_id = users.id
     WHERE followers.followed_id = ? 
@@ -640,7 +526,7 @@ func FollowRequestHandler(w http.ResponseWriter, r *http.Request) {
 
     for rows.Next() {
         var followRequest models.FollowRequest
-        if err := rows.Scan(&followRequest.ID, &followRequest.FollowedID, &followRequest.Username, &followRequest.Avatar); err != nil {
+        if err := rows.Scan(&followRequest.ID, &followRequest.FollowerID, &followRequest.FollowedID, &followRequest.Username, &followRequest.Avatar); err != nil {
             log.Printf("Error scanning row: %v", err)
             continue // Skip this row but continue processing others
         }
@@ -729,105 +615,3 @@ func AreFriends(userID1, userID2 uint64) (bool, error) {
 	}
 	return count > 0, nil
 }
-
-func GetFollowingBYIt(w http.ResponseWriter, r *http.Request){
-	userId, err := util.GetUserID(r, w)
-	if err != nil {
-		http.Error(w, "problem in getting user id", http.StatusUnauthorized)
-		return
-	}
-
-	query := `
-		SELECT 
-			f.id, 
-			f.followed_id, 
-			u.username, 
-			COALESCE(u.avatar, '') as avatar, 
-			f.status,
-			f.created_at
-		FROM followers f
-		JOIN users u ON u.id = f.followed_id
-		WHERE f.follower_id = ? AND f.status = 'accept'
-	`
-
-	rows, err := sqlite.DB.Query(query, userId)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var following []models.Follow
-	for rows.Next() {
-		var follow models.Follow
-		if err := rows.Scan(
-			&follow.ID,
-			&follow.FollowedID,
-			&follow.Username,
-			&follow.Avatar,
-			&follow.Status,
-			&follow.CreatedAt,
-		); err != nil {
-			log.Printf("Error scanning follow row: %v", err)
-			continue
-		}
-		following = append(following, follow)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(following)
-
-}
-
-func GetFollowing(w http.ResponseWriter, r *http.Request) {
-	userId := r.PathValue("userId")
-	if userId == "current" {
-		var err error
-		currentUserID, err := util.GetUserID(r, w)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		userId = fmt.Sprintf("%d", currentUserID)
-	}
-
-	query := `
-		SELECT 
-			f.id, 
-			f.followed_id, 
-			u.username, 
-			COALESCE(u.avatar, '') as avatar, 
-			f.status,
-			f.created_at
-		FROM followers f
-		JOIN users u ON u.id = f.followed_id
-		WHERE f.follower_id = ? AND f.status = 'accept'
-	`
-
-	rows, err := sqlite.DB.Query(query, userId)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var following []models.Follow
-	for rows.Next() {
-		var follow models.Follow
-		if err := rows.Scan(
-			&follow.ID,
-			&follow.FollowedID,
-			&follow.Username,
-			&follow.Avatar,
-			&follow.Status,
-			&follow.CreatedAt,
-		); err != nil {
-			log.Printf("Error scanning follow row: %v", err)
-			continue
-		}
-		following = append(following, follow)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(following)
-}
@@ -0,0 +1,173 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+	"social-network/util"
+)
+
+func TestFollowersCursorSurvivesRemovedFollow(t *testing.T) {
+	sqlitetest.Open(t)
+	owner := newTestUser(t, "owner_test", false)
+
+	// Five followers, a minute apart, the newest last
+	start := time.Now().Add(-time.Hour)
+	var followers []int64
+	for i := 0; i < 5; i++ {
+		follower := newTestUser(t, fmt.Sprintf("follower%d_test", i), false)
+		_, err := sqlite.DB.Exec(
+			"INSERT INTO followers (follower_id, followed_id, status, created_at) VALUES (?, ?, 'accept', ?)",
+			follower, owner, start.Add(time.Duration(i)*time.Minute),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		followers = append(followers, follower)
+	}
+
+	page := func(before string) ([]models.Follow, string) {
+		target := "/followers/current?limit=2"
+		if before != "" {
+			target += "&before=" + url.QueryEscape(before)
+		}
+		rec := getAs(owner, GetFollowers, target, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", target, rec.Code, rec.Body)
+		}
+		var follows []models.Follow
+		json.NewDecoder(rec.Body).Decode(&follows)
+		return follows, rec.Header().Get("X-Next-Cursor")
+	}
+
+	first, cursor := page("")
+	if len(first) != 2 || int64(first[0].FollowerID) != followers[4] || int64(first[1].FollowerID) != followers[3] {
+		t.Fatalf("first page = %+v, want the two newest followers", first)
+	}
+	if cursor == "" {
+		t.Fatal("full page has no X-Next-Cursor")
+	}
+
+	// The last follower on the page unfollows before the next page is asked for
+	if _, err := sqlite.DB.Exec("DELETE FROM followers WHERE id = ?", first[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	second, cursor := page(cursor)
+	if len(second) != 2 || int64(second[0].FollowerID) != followers[2] || int64(second[1].FollowerID) != followers[1] {
+		t.Fatalf("second page = %+v, want the next two followers", second)
+	}
+	third, cursor := page(cursor)
+	if len(third) != 1 || int64(third[0].FollowerID) != followers[0] || cursor != "" {
+		t.Errorf("third page = %+v with cursor %q, want the oldest follower and no cursor", third, cursor)
+	}
+
+	rec := getAs(owner, GetFollowers, "/followers/current?before=17", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("a bare follow id as cursor = %d, want 400", rec.Code)
+	}
+}
+
+// deleteAs runs handler for a DELETE of target as userID
+func deleteAs(userID int64, handler http.HandlerFunc, target string, pathValues map[string]string) *httptest.ResponseRecorder {
+	login := httptest.NewRecorder()
+	util.StartSession(login, uint(userID))
+
+	req := httptest.NewRequest(http.MethodDelete, target, nil)
+	req.AddCookie(login.Result().Cookies()[0])
+	for name, value := range pathValues {
+		req.SetPathValue(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// followUpdate waits for the follow_update frame sent to a user's event stream
+func followUpdate(t *testing.T, events chan sseEvent) models.FollowUpdate {
+	t.Helper()
+	for {
+		select {
+		case event := <-events:
+			var frame struct {
+				Type string              `json:"type"`
+				Data models.FollowUpdate `json:"data"`
+			}
+			if json.Unmarshal(event.Data, &frame) == nil && frame.Type == MessageTypeFollowUpdate {
+				return frame.Data
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no follow_update frame was sent")
+		}
+	}
+}
+
+func TestWithdrawFollowRequest(t *testing.T) {
+	sqlitetest.Open(t)
+	requester := newTestUser(t, "requester_test", false)
+	target := newTestUser(t, "target_test", true)
+
+	body := fmt.Sprintf(`{"followed_id": %d}`, target)
+	if rec := postAs(requester, RequestFollowUser, "/follow", body); rec.Code >= 300 {
+		t.Fatalf("follow request returned %d: %s", rec.Code, rec.Body)
+	}
+	if rows, _ := notificationsOf(t, target, models.NotificationTypeFollow); rows != 1 {
+		t.Fatalf("target has %d follow requests, want 1", rows)
+	}
+
+	events, _ := eventStreams.add(int(target))
+	defer eventStreams.remove(int(target), events)
+
+	path := map[string]string{"id": fmt.Sprint(target)}
+	if rec := deleteAs(requester, CancelFollowRequest, "/follow/requests/", path); rec.Code != http.StatusNoContent {
+		t.Fatalf("withdrawing returned %d: %s", rec.Code, rec.Body)
+	}
+	if update := followUpdate(t, events); update.Status != models.FollowCancelled || update.FollowerID != int(requester) {
+		t.Errorf("target was sent %+v, want the request from %d cancelled", update, requester)
+	}
+	if rows, _ := notificationsOf(t, target, models.NotificationTypeFollow); rows != 0 {
+		t.Errorf("target still has %d follow requests", rows)
+	}
+
+	if rec := deleteAs(requester, CancelFollowRequest, "/follow/requests/", path); rec.Code != http.StatusNotFound {
+		t.Errorf("withdrawing twice returned %d, want 404", rec.Code)
+	}
+}
+
+func TestRemoveFollower(t *testing.T) {
+	sqlitetest.Open(t)
+	owner := newTestUser(t, "owner_test", false)
+	follower := newTestUser(t, "follower_test", false)
+	addFollow(t, follower, owner)
+
+	events, _ := eventStreams.add(int(follower))
+	defer eventStreams.remove(int(follower), events)
+
+	path := map[string]string{"id": fmt.Sprint(follower)}
+	if rec := deleteAs(owner, RemoveFollower, "/followers/", path); rec.Code != http.StatusNoContent {
+		t.Fatalf("removing the follower returned %d: %s", rec.Code, rec.Body)
+	}
+	if update := followUpdate(t, events); update.Status != models.FollowRemoved || update.FollowedID != int(owner) {
+		t.Errorf("follower was sent %+v, want their follow of %d removed", update, owner)
+	}
+
+	var follows int
+	sqlite.DB.QueryRow("SELECT COUNT(*) FROM followers WHERE follower_id = ? AND followed_id = ?", follower, owner).Scan(&follows)
+	if follows != 0 {
+		t.Error("the follow is still stored")
+	}
+
+	if rec := deleteAs(owner, RemoveFollower, "/followers/", path); rec.Code != http.StatusNotFound {
+		t.Errorf("removing someone who doesn't follow you returned %d, want 404", rec.Code)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	m "social-network/models"
 	"social-network/pkg/db/sqlite"
+	"social-network/pkg/notifications"
 	"social-network/util"
 	"strconv"
 	"strings"
@@ -16,6 +17,13 @@ import (
 	// "golang.org/x/mod/module"
 )
 
+const (
+	maxGroupTitleLength       = 100
+	maxGroupDescriptionLength = 1000
+	maxEventTitleLength       = 100
+	maxEventDescriptionLength = 1000
+)
+
 func CreateGroup(w http.ResponseWriter, r *http.Request) {
 	var group m.Group
 
@@ -30,8 +38,18 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if strings.TrimSpace(group.Description) == "" || strings.TrimSpace(group.Title) == "" {
-		http.Error(w, "Please Provide all fields", http.StatusBadRequest)
+	if !requireVerifiedEmail(w, userID, "create groups") {
+		return
+	}
+
+	group.Title = strings.TrimSpace(group.Title)
+	group.Description = strings.TrimSpace(group.Description)
+
+	v := util.Validator{}
+	v.Length("title", group.Title, 1, maxGroupTitleLength)
+	v.Length("description", group.Description, 1, maxGroupDescriptionLength)
+	if !v.Valid() {
+		v.Write(w, http.StatusBadRequest)
 		return
 	}
 
@@ -116,8 +134,14 @@ query := `SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND (st
 	}	
 
     // Validate privacy value
-    if postInput.Privacy != 1 && postInput.Privacy != 2 && postInput.Privacy != 3 {
-        http.Error(w, "Invalid privacy type", http.StatusBadRequest)
+    v := util.Validator{}
+    v.Length("title", postInput.Title, 0, maxPostTitleLength)
+    v.Length("content", postInput.Content, 0, maxPostContentLength)
+    v.Check(strings.TrimSpace(postInput.Title) != "" || strings.TrimSpace(postInput.Content) != "" || postInput.Media != "",
+        "content", "is required when there is no title or media")
+    v.Check(postInput.Privacy >= 1 && postInput.Privacy <= 3, "privacy", privacyProblem)
+    if !v.Valid() {
+        v.Write(w, http.StatusBadRequest)
         return
     }
 
@@ -129,14 +153,14 @@ query := `SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND (st
         // Split the base64 string to get the media type
         parts := strings.Split(postInput.Media, ";base64,")
         if len(parts) != 2 {
-            http.Error(w, "Invalid media format", http.StatusBadRequest)
+            util.WriteFieldError(w, http.StatusBadRequest, "media", "must be a base64 data URL")
             return
         }
 
         mediaType = strings.TrimPrefix(parts[0], "data:")
         mediaBytes, err = base64.StdEncoding.DecodeString(parts[1])
         if err != nil {
-            http.Error(w, "Invalid media encoding", http.StatusBadRequest)
+            util.WriteFieldError(w, http.StatusBadRequest, "media", "must be base64 encoded")
             return
         }
     }
@@ -161,6 +185,9 @@ query := `SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND (st
 
     postID, _ := result.LastInsertId()
 
+    indexContent(m.SourceGroupPost, postID, userID, *postInput.GroupID, postInput.Title+"\n"+postInput.Content)
+    notifyGroupPost(*postInput.GroupID, postID, userID)
+
     // Return the created post
     response := m.PostResponse{
         ID:        postID,
@@ -183,6 +210,11 @@ query := `SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND (st
 		var groupPosts []m.Post
 		groupIDString := r.PathValue("id")
 
+		userID, err := util.GetUserID(r, w)
+		if err != nil {
+			return
+		}
+
 		// convert the string into a number
 		if groupIDString == "" {
 			http.Error(w, "group id is null", http.StatusBadRequest)
@@ -209,9 +241,9 @@ query := `SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND (st
 				   u.username as author_name
 			FROM group_posts gp
 			LEFT JOIN users u ON gp.author = u.id
-			WHERE gp.group_id = ? 
+			WHERE gp.group_id = ? AND `+notBlockedClause("gp.author", "?")+`
 			ORDER BY gp.created_at DESC`,
-			groupID,
+			groupID, userID, userID,
 		)
 		if err != nil {
 			if err == sql.ErrNoRows {
@@ -346,6 +378,16 @@ func GroupInvitation(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    blocked, err := isBlocked(int64(senderID), int64(inviteRequest.ReciverID))
+    if err != nil {
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    if blocked {
+        http.Error(w, "You can't invite this user", http.StatusForbidden)
+        return
+    }
+
     // Start transaction
     tx, err := sqlite.DB.Begin()
     if err != nil {
@@ -395,7 +437,7 @@ func GroupInvitation(w http.ResponseWriter, r *http.Request) {
     }
 
     // Insert the new member record
-    _, err = tx.Exec(
+    memberResult, err := tx.Exec(
         "INSERT INTO group_members (group_id, user_id, status) VALUES (?, ?, ?)",
         inviteRequest.GroupID, inviteRequest.ReciverID, "pendingInvitation",
     )
@@ -403,43 +445,35 @@ func GroupInvitation(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
         return
     }
+    memberID, _ := memberResult.LastInsertId()
 
     // Create notification for the invited user
     notification := m.Notification{
-        ToUserID:   int(inviteRequest.ReciverID),
-        FromUserID: int(senderID),
-        Content:    fmt.Sprintf("%s invited you to join the group: %s", senderUsername, groupName),
-        Type:       m.NotificationGroupInvite,
-        GroupID:    inviteRequest.GroupID,
-        CreatedAt:  time.Now(),
+        ToUserID:       int(inviteRequest.ReciverID),
+        FromUserID:     int(senderID),
+        Content:        fmt.Sprintf("%s invited you to join the group: %s", senderUsername, groupName),
+        Type:           m.NotificationGroupInvite,
+        GroupID:        inviteRequest.GroupID,
+        CreatedAt:      time.Now(),
+        IdempotencyKey: notifications.Key(m.NotificationGroupInvite, memberID),
     }
 
     // Insert notification
-    result, err := tx.Exec(`
-        INSERT INTO notifications (to_user_id, from_user_id, content, type, group_id, created_at) 
-        VALUES (?, ?, ?, ?, ?, ?)`,
-        notification.ToUserID,
-        notification.FromUserID,
-        notification.Content,
-        notification.Type,
-        notification.GroupID,
-        notification.CreatedAt,
-    )
+    deliver, err := notifications.Persist(tx, &notification)
     if err != nil {
         http.Error(w, "Failed to create notification", http.StatusInternalServerError)
         return
     }
 
-    notificationID, _ := result.LastInsertId()
-    notification.ID = int(notificationID)
-
     if err := tx.Commit(); err != nil {
         http.Error(w, "Failed to complete the invitation process", http.StatusInternalServerError)
         return
     }
 
     // Broadcast the notification through WebSocket
-    BroadcastNotification(notification)
+    if deliver {
+        notifications.Push(notification)
+    }
 
     // Return success response
     w.WriteHeader(http.StatusCreated)
@@ -513,7 +547,7 @@ func GroupJoinRequest(w http.ResponseWriter, r *http.Request) {
     }
 
     // Insert the pending member record
-    _, err = tx.Exec(
+    memberResult, err := tx.Exec(
         "INSERT INTO group_members (group_id, user_id, status, created_at) VALUES (?, ?, ?, ?)",
         inviteRequest.GroupID, userID, "pending", time.Now(),
     )
@@ -522,6 +556,7 @@ func GroupJoinRequest(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "Failed to create join request", http.StatusInternalServerError)
         return
     }
+    memberID, _ := memberResult.LastInsertId()
 
     // Get the username of the requesting user
     var username string
@@ -534,40 +569,25 @@ func GroupJoinRequest(w http.ResponseWriter, r *http.Request) {
 
     // Create notification for group creator
     notification := m.Notification{
-        ToUserID:   creatorID,
-        FromUserID: int(userID),
-        Content:    fmt.Sprintf("%s has requested to join your group: %s", username, groupName),
-        Type:       m.NotificationGroupRequest,
-        GroupID:    inviteRequest.GroupID,
-        CreatedAt:  time.Now(),
+        ToUserID:       creatorID,
+        FromUserID:     int(userID),
+        Content:        fmt.Sprintf("%s has requested to join your group: %s", username, groupName),
+        Type:           m.NotificationGroupRequest,
+        GroupID:        inviteRequest.GroupID,
+        CreatedAt:      time.Now(),
+        IdempotencyKey: notifications.Key(m.NotificationGroupRequest, memberID),
     }
 
     log.Printf("Creating notification for creator: %+v", notification)
 
     // Insert notification
-    result, err := tx.Exec(`
-        INSERT INTO notifications (to_user_id, from_user_id, content, type, group_id, created_at) 
-        VALUES (?, ?, ?, ?, ?, ?)`,
-        notification.ToUserID,
-        notification.FromUserID,
-        notification.Content,
-        notification.Type,
-        notification.GroupID,
-        notification.CreatedAt,
-    )
+    deliver, err := notifications.Persist(tx, &notification)
     if err != nil {
         log.Printf("Error creating notification: %v", err)
         http.Error(w, "Failed to create notification", http.StatusInternalServerError)
         return
     }
 
-    notificationID, err := result.LastInsertId()
-    if err != nil {
-        log.Printf("Error getting notification ID: %v", err)
-    } else {
-        notification.ID = int(notificationID)
-    }
-
     if err := tx.Commit(); err != nil {
         log.Printf("Error committing transaction: %v", err)
         http.Error(w, "Failed to complete the request", http.StatusInternalServerError)
@@ -575,8 +595,10 @@ func GroupJoinRequest(w http.ResponseWriter, r *http.Request) {
     }
 
     // Broadcast the notification through WebSocket
-    log.Printf("Broadcasting notification to creator (ID: %d)", creatorID)
-    BroadcastNotification(notification)
+    if deliver {
+        log.Printf("Broadcasting notification to creator (ID: %d)", creatorID)
+        notifications.Push(notification)
+    }
 
     w.WriteHeader(http.StatusCreated)
     json.NewEncoder(w).Encode(map[string]string{"message": "Group join request sent successfully"})
@@ -599,14 +621,20 @@ func GroupAccept(w http.ResponseWriter, r *http.Request) {
     }
     defer tx.Rollback()
 
-    // Get group name
+    // Get group name and creator, whose request notification gets cleared
     var groupName string
-    err = tx.QueryRow("SELECT title FROM groups WHERE id = ?", inviteRequest.GroupID).Scan(&groupName)
+    var creatorID int
+    err = tx.QueryRow("SELECT title, creator_id FROM groups WHERE id = ?", inviteRequest.GroupID).Scan(&groupName, &creatorID)
     if err != nil {
         http.Error(w, "Group not found", http.StatusNotFound)
         return
     }
 
+    // Remember which membership row is being answered for the notification
+    var memberID int64
+    tx.QueryRow("SELECT id FROM group_members WHERE group_id = ? AND user_id = ?",
+        inviteRequest.GroupID, inviteRequest.UserID).Scan(&memberID)
+
     // Update member status
     result, err := tx.Exec("UPDATE group_members SET status = 'member' WHERE group_id = ? AND user_id = ?", 
         inviteRequest.GroupID, inviteRequest.UserID)
@@ -636,15 +664,15 @@ func GroupAccept(w http.ResponseWriter, r *http.Request) {
     }
 
     // Create notification for accepted user
-    _, err = tx.Exec(`
-        INSERT INTO notifications (to_user_id, content, type, group_id, created_at) 
-        VALUES (?, ?, ?, ?, ?)`,
-        inviteRequest.UserID,
-        fmt.Sprintf("Your request to join %s has been accepted", groupName),
-        m.NotificationGroupAccept,
-        inviteRequest.GroupID,
-        time.Now(),
-    )
+    notification := m.Notification{
+        ToUserID:       int(inviteRequest.UserID),
+        Content:        fmt.Sprintf("Your request to join %s has been accepted", groupName),
+        Type:           m.NotificationGroupAccept,
+        GroupID:        int(inviteRequest.GroupID),
+        CreatedAt:      time.Now(),
+        IdempotencyKey: notifications.Key(m.NotificationGroupAccept, memberID),
+    }
+    deliver, err := notifications.Persist(tx, &notification)
     if err != nil {
         http.Error(w, "Failed to create notification", http.StatusInternalServerError)
         return
@@ -655,6 +683,11 @@ func GroupAccept(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    if deliver {
+        notifications.Push(notification)
+    }
+    notifications.PublishUnreadCount(creatorID)
+
     w.WriteHeader(http.StatusOK)
     json.NewEncoder(w).Encode(map[string]string{"message": "Group invitation accepted successfully"})
 }
@@ -675,6 +708,11 @@ func GroupReject(w http.ResponseWriter, r *http.Request) {
     }
     defer tx.Rollback()
 
+    // Remember which membership row is being answered for the notification
+    var memberID int64
+    tx.QueryRow("SELECT id FROM group_members WHERE group_id = ? AND user_id = ? AND status = 'pending'",
+        inviteRequest.GroupID, inviteRequest.UserID).Scan(&memberID)
+
     // Delete the member request
     result, err := tx.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ? AND status = 'pending'", 
         inviteRequest.GroupID, inviteRequest.UserID)
@@ -705,18 +743,21 @@ func GroupReject(w http.ResponseWriter, r *http.Request) {
 
     // Get group name for rejection notification
     var groupName string
-    err = tx.QueryRow("SELECT title FROM groups WHERE id = ?", inviteRequest.GroupID).Scan(&groupName)
+    var creatorID int
+    var notification m.Notification
+    deliver := false
+    err = tx.QueryRow("SELECT title, creator_id FROM groups WHERE id = ?", inviteRequest.GroupID).Scan(&groupName, &creatorID)
     if err == nil {
         // Create rejection notification for the user
-        _, err = tx.Exec(`
-            INSERT INTO notifications (to_user_id, content, type, group_id, created_at) 
-            VALUES (?, ?, ?, ?, ?)`,
-            inviteRequest.UserID,
-            fmt.Sprintf("Your request to join %s has been rejected", groupName),
-            m.NotificationGroupReject,
-            inviteRequest.GroupID,
-            time.Now(),
-        )
+        notification = m.Notification{
+            ToUserID:       int(inviteRequest.UserID),
+            Content:        fmt.Sprintf("Your request to join %s has been rejected", groupName),
+            Type:           m.NotificationGroupReject,
+            GroupID:        int(inviteRequest.GroupID),
+            CreatedAt:      time.Now(),
+            IdempotencyKey: notifications.Key(m.NotificationGroupReject, memberID),
+        }
+        deliver, err = notifications.Persist(tx, &notification)
         if err != nil {
             log.Printf("Error creating rejection notification: %v", err)
         }
@@ -727,6 +768,13 @@ func GroupReject(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    if deliver {
+        notifications.Push(notification)
+    }
+    if creatorID != 0 {
+        notifications.PublishUnreadCount(creatorID)
+    }
+
     w.WriteHeader(http.StatusOK)
     json.NewEncoder(w).Encode(map[string]string{"message": "Group invitation rejected successfully"})
 }
@@ -882,6 +930,11 @@ func Members(w http.ResponseWriter, r *http.Request) {
 
 // to get all members for a praticular group
 func GetMembers(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
 	type GroupID struct {
 		ID string `json:"group_id"`
 	}
@@ -908,9 +961,10 @@ func GetMembers(w http.ResponseWriter, r *http.Request) {
 		FROM group_members gm
 		INNER JOIN users u ON gm.user_id = u.id
 		WHERE gm.group_id = ? AND (gm.status = ? OR gm.status = ?)
+		AND ` + notBlockedClause("gm.user_id", "?") + `
 	`
 
-	rows, err := sqlite.DB.Query(query, groupIDInt, "member", "creator")
+	rows, err := sqlite.DB.Query(query, groupIDInt, "member", "creator", userID, userID)
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("Error querying database: %v", err)
@@ -1036,6 +1090,19 @@ func CreateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	event.Title = strings.TrimSpace(event.Title)
+	event.Description = strings.TrimSpace(event.Description)
+
+	v := util.Validator{}
+	v.Length("title", event.Title, 1, maxEventTitleLength)
+	v.Length("description", event.Description, 0, maxEventDescriptionLength)
+	v.Check(!event.EventDate.IsZero(), "event_date", "is required")
+	v.Check(event.EventDate.After(time.Now()), "event_date", "must be in the future")
+	if !v.Valid() {
+		v.Write(w, http.StatusBadRequest)
+		return
+	}
+
 	// Check if group exists
 	var exists bool
 	err := sqlite.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM groups WHERE id = ?)", event.GroupID).Scan(&exists)
@@ -1084,22 +1151,30 @@ func CreateEvent(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	var notifications []m.Notification
+	var eventNotifications []m.Notification
 	for rows.Next() {
 		var userID int
 		if err := rows.Scan(&userID); err != nil {
 			log.Printf("Error scanning user_id: %v", err)
 			continue
 		}
+		if userID == int(event.CreatorID) {
+			continue
+		}
 
-		// Construct the message
-		notifications = append(notifications, m.Notification{
-			ToUserID:  userID,
-			GroupID:   int(event.GroupID),
-			Content:   fmt.Sprintf("%s invites you to join %s ! RSVP now to save your spot!", groupTitle, event.Title),
-			Type:      m.NotificationEvent,
-			CreatedAt: time.Now(),
-			Read:      false,
+		// Construct the message. Unread event notifications of a group are
+		// folded into one per member.
+		eventNotifications = append(eventNotifications, m.Notification{
+			ToUserID:       userID,
+			FromUserID:     int(event.CreatorID),
+			GroupID:        int(event.GroupID),
+			Content:        fmt.Sprintf("%s invites you to join %s ! RSVP now to save your spot!", groupTitle, event.Title),
+			Type:           m.NotificationEvent,
+			CreatedAt:      time.Now(),
+			Read:           false,
+			IdempotencyKey: notifications.Key(m.NotificationEvent, eventID, userID),
+			TargetType:     m.NotificationTargetGroup,
+			TargetID:       int(event.GroupID),
 		})
 	}
 
@@ -1108,33 +1183,18 @@ func CreateEvent(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error starting transaction: %v", err)
 		return
 	}
-	stmt, err := tx.Prepare(`
-        INSERT INTO notifications (to_user_id, group_id, content, type, read, created_at) 
-        VALUES (?, ?, ?, ?, ?, ?)
-    `)
-	if err != nil {
-		log.Printf("Error preparing statement: %v", err)
-		tx.Rollback()
-		return
-	}
-	defer stmt.Close()
 
-	for _, notification := range notifications {
-		_, err := stmt.Exec(
-			notification.ToUserID,
-			notification.GroupID,
-			notification.Content,
-			notification.Type,
-			notification.Read,
-			notification.CreatedAt,
-		)
+	var deliverable []m.Notification
+	for i := range eventNotifications {
+		deliver, err := notifications.Persist(tx, &eventNotifications[i])
 		if err != nil {
 			log.Printf("Error inserting notification: %v", err)
 			tx.Rollback()
 			return
 		}
-		BroadcastNotification(notification)
-
+		if deliver {
+			deliverable = append(deliverable, eventNotifications[i])
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -1142,6 +1202,10 @@ func CreateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, notification := range deliverable {
+		notifications.Push(notification)
+	}
+
 
 	
 	w.WriteHeader(http.StatusCreated)
@@ -1156,6 +1220,13 @@ func RSVPEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	v := util.Validator{}
+	v.OneOf("rsvp_status", rsvp.RSVPStatus, "going", "not going")
+	if !v.Valid() {
+		v.Write(w, http.StatusBadRequest)
+		return
+	}
+
 	// Set CreatedAt to the current time if it's not provided
 	if rsvp.CreatedAt.IsZero() {
 		rsvp.CreatedAt = time.Now()
@@ -1360,6 +1431,19 @@ func getGroupTitleByID(groupID uint) (string, error) {
 }
 
 
+// isGroupMember reports whether the user is an active member or the creator of the group
+func isGroupMember(groupID int64, userID uint64) (bool, error) {
+	var isMember bool
+	err := sqlite.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM group_members
+			WHERE group_id = ? AND user_id = ?
+			AND status IN ('member', 'creator')
+		)`, groupID, userID).Scan(&isMember)
+	return isMember, err
+}
+
+
 func GetnonMembers(w http.ResponseWriter, r *http.Request) {
 	// Check if it's a POST request
 	if r.Method != "POST" {
@@ -1367,12 +1451,17 @@ func GetnonMembers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
 	// Read the request body
 	var reqBody struct {
 		GroupID int `json:"group_id"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	err = json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
 		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
 		return
@@ -1395,11 +1484,12 @@ func GetnonMembers(w http.ResponseWriter, r *http.Request) {
 			SELECT gm.user_id
 			FROM group_members gm
 			WHERE gm.group_id = ?
-		);
+		)
+		AND ` + notBlockedClause("u.id", "?") + `;
 	`
 
 	// Execute the query
-	rows, err := sqlite.DB.Query(query, reqBody.GroupID)
+	rows, err := sqlite.DB.Query(query, reqBody.GroupID, userID, userID)
 	if err != nil {
 		http.Error(w, "Database query error: "+err.Error(), http.StatusInternalServerError)
 		return
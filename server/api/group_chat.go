@@ -4,7 +4,9 @@ import (
     "encoding/json"
     "log"
     "net/http"
+    "strconv"
     "time"
+    m "social-network/models"
     "social-network/pkg/db/sqlite"
     "social-network/util"
     "github.com/gorilla/websocket"
@@ -116,6 +118,8 @@ func HandleGroupChatMessages(conn *websocket.Conn, userID uint64, msg []byte) {
         return
     }
 
+    indexContent(m.SourceGroupChatMessage, msgID, userID, int64(groupMsg.Content.GroupID), groupMsg.Content.Message)
+
     // Prepare response
     response := struct {
         Type      string    `json:"type"`
@@ -164,4 +168,259 @@ func HandleGroupChatMessages(conn *websocket.Conn, userID uint64, msg []byte) {
             }
         }
     }
-} 
\ No newline at end of file
+}
+
+const (
+    defaultGroupChatPageSize = 50
+    maxGroupChatPageSize     = 100
+)
+
+// GetGroupChatMessages returns one page of a group's chat history, newest first.
+// Without a cursor the latest messages are returned. `before` walks back in
+// history and `after` walks forward from a message id the client already has.
+func GetGroupChatMessages(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    groupID, err := strconv.ParseInt(r.URL.Query().Get("groupId"), 10, 64)
+    if err != nil || groupID < 1 {
+        http.Error(w, "Invalid group ID", http.StatusBadRequest)
+        return
+    }
+
+    before, err := util.QueryID(r, "before")
+    if err != nil {
+        http.Error(w, "Invalid before cursor", http.StatusBadRequest)
+        return
+    }
+    after, err := util.QueryID(r, "after")
+    if err != nil {
+        http.Error(w, "Invalid after cursor", http.StatusBadRequest)
+        return
+    }
+    if before > 0 && after > 0 {
+        http.Error(w, "Use either before or after, not both", http.StatusBadRequest)
+        return
+    }
+
+    limit, err := util.PageSize(r, defaultGroupChatPageSize, maxGroupChatPageSize)
+    if err != nil {
+        http.Error(w, "Invalid limit", http.StatusBadRequest)
+        return
+    }
+
+    if !requireGroupMember(w, groupID, userID) {
+        return
+    }
+
+    var messages []m.GroupChatMessage
+    if after > 0 {
+        // Take the messages right after the cursor, then flip them to newest first
+        messages, err = queryGroupChatMessages(`
+            WHERE gcm.group_id = ? AND gcm.id > ?
+            ORDER BY gcm.id ASC
+            LIMIT ?
+        `, groupID, after, limit)
+        reverseGroupChatMessages(messages)
+    } else if before > 0 {
+        messages, err = queryGroupChatMessages(`
+            WHERE gcm.group_id = ? AND gcm.id < ?
+            ORDER BY gcm.id DESC
+            LIMIT ?
+        `, groupID, before, limit)
+    } else {
+        messages, err = queryGroupChatMessages(`
+            WHERE gcm.group_id = ?
+            ORDER BY gcm.id DESC
+            LIMIT ?
+        `, groupID, limit)
+    }
+    if err != nil {
+        log.Printf("Error fetching group chat messages: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(messages)
+}
+
+// GetGroupChatContext jumps to a single message and returns it together with
+// the messages surrounding it, newest first, so a client can open the chat at
+// that point and keep paginating in both directions with before/after.
+func GetGroupChatContext(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    messageID, err := strconv.ParseInt(r.URL.Query().Get("messageId"), 10, 64)
+    if err != nil || messageID < 1 {
+        http.Error(w, "Invalid message ID", http.StatusBadRequest)
+        return
+    }
+
+    limit, err := util.PageSize(r, 20, maxGroupChatPageSize/2)
+    if err != nil {
+        http.Error(w, "Invalid limit", http.StatusBadRequest)
+        return
+    }
+
+    var groupID int64
+    err = sqlite.DB.QueryRow("SELECT group_id FROM group_chat_messages WHERE id = ?", messageID).Scan(&groupID)
+    if err == sql.ErrNoRows {
+        http.Error(w, "Message not found", http.StatusNotFound)
+        return
+    } else if err != nil {
+        log.Printf("Error looking up group chat message: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    if !requireGroupMember(w, groupID, userID) {
+        return
+    }
+
+    newer, err := queryGroupChatMessages(`
+        WHERE gcm.group_id = ? AND gcm.id > ?
+        ORDER BY gcm.id ASC
+        LIMIT ?
+    `, groupID, messageID, limit)
+    if err != nil {
+        log.Printf("Error fetching newer group chat messages: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    reverseGroupChatMessages(newer)
+
+    // The target itself is the first row of the older half
+    older, err := queryGroupChatMessages(`
+        WHERE gcm.group_id = ? AND gcm.id <= ?
+        ORDER BY gcm.id DESC
+        LIMIT ?
+    `, groupID, messageID, limit+1)
+    if err != nil {
+        log.Printf("Error fetching older group chat messages: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    response := struct {
+        GroupID  int64                `json:"group_id"`
+        TargetID int64                `json:"target_id"`
+        Messages []m.GroupChatMessage `json:"messages"`
+    }{
+        GroupID:  groupID,
+        TargetID: messageID,
+        Messages: append(newer, older...),
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(response)
+}
+
+// SearchGroupChatMessages runs a full-text search over one group's chat history.
+// Matches are returned newest first and can be paged with the before cursor.
+func SearchGroupChatMessages(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    groupID, err := strconv.ParseInt(r.URL.Query().Get("groupId"), 10, 64)
+    if err != nil || groupID < 1 {
+        http.Error(w, "Invalid group ID", http.StatusBadRequest)
+        return
+    }
+
+    match := util.FTSQuery(r.URL.Query().Get("q"))
+    if match == "" {
+        http.Error(w, "Missing search query", http.StatusBadRequest)
+        return
+    }
+
+    before, err := util.QueryID(r, "before")
+    if err != nil {
+        http.Error(w, "Invalid before cursor", http.StatusBadRequest)
+        return
+    }
+
+    limit, err := util.PageSize(r, 20, maxGroupChatPageSize)
+    if err != nil {
+        http.Error(w, "Invalid limit", http.StatusBadRequest)
+        return
+    }
+
+    if !requireGroupMember(w, groupID, userID) {
+        return
+    }
+
+    tail := `
+        JOIN group_chat_messages_fts fts ON fts.rowid = gcm.id
+        WHERE group_chat_messages_fts MATCH ? AND gcm.group_id = ?`
+    args := []interface{}{match, groupID}
+    if before > 0 {
+        tail += ` AND gcm.id < ?`
+        args = append(args, before)
+    }
+    tail += ` ORDER BY gcm.id DESC LIMIT ?`
+    args = append(args, limit)
+
+    messages, err := queryGroupChatMessages(tail, args...)
+    if err != nil {
+        log.Printf("Error searching group chat messages: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(messages)
+}
+
+// queryGroupChatMessages runs the shared message SELECT with the given
+// WHERE/ORDER/LIMIT tail. It always returns a non-nil slice.
+func queryGroupChatMessages(tail string, args ...interface{}) ([]m.GroupChatMessage, error) {
+    rows, err := sqlite.DB.Query(`
+        SELECT gcm.id, gcm.group_id, gcm.sender_id, gcm.content, gcm.created_at, u.username
+        FROM group_chat_messages gcm
+        JOIN users u ON gcm.sender_id = u.id
+    `+tail, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    messages := []m.GroupChatMessage{}
+    for rows.Next() {
+        var msg m.GroupChatMessage
+        if err := rows.Scan(&msg.ID, &msg.GroupID, &msg.SenderID, &msg.Content, &msg.CreatedAt, &msg.Username); err != nil {
+            return nil, err
+        }
+        messages = append(messages, msg)
+    }
+    return messages, rows.Err()
+}
+
+func reverseGroupChatMessages(messages []m.GroupChatMessage) {
+    for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+        messages[i], messages[j] = messages[j], messages[i]
+    }
+}
+
+// requireGroupMember writes a 403 and returns false unless the user is an
+// active member (or the creator) of the group.
+func requireGroupMember(w http.ResponseWriter, groupID int64, userID uint64) bool {
+    isMember, err := isGroupMember(groupID, userID)
+    if err != nil {
+        log.Printf("Error checking group membership: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return false
+    }
+    if !isMember {
+        http.Error(w, "You are not a member of this group", http.StatusForbidden)
+        return false
+    }
+    return true
+}
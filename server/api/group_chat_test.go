@@ -0,0 +1,181 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+)
+
+// newGroup creates a group of creatorID with the given members
+func newGroup(t *testing.T, creatorID int64, memberIDs ...int64) int64 {
+	t.Helper()
+	result, err := sqlite.DB.Exec("INSERT INTO groups (title, description, creator_id) VALUES ('Group', 'Test group', ?)", creatorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupID, _ := result.LastInsertId()
+
+	add := func(userID int64, status string) {
+		if _, err := sqlite.DB.Exec(
+			"INSERT INTO group_members (group_id, user_id, status) VALUES (?, ?, ?)", groupID, userID, status,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(creatorID, "creator")
+	for _, userID := range memberIDs {
+		add(userID, "member")
+	}
+	return groupID
+}
+
+// groupMessage posts content to a group's chat and returns the message id
+func groupMessage(t *testing.T, groupID, senderID int64, content string) int64 {
+	t.Helper()
+	result, err := sqlite.DB.Exec(
+		"INSERT INTO group_chat_messages (group_id, sender_id, content) VALUES (?, ?, ?)",
+		groupID, senderID, content,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+// messageIDs decodes a list of group chat messages into their ids
+func messageIDs(t *testing.T, body []byte) []int64 {
+	t.Helper()
+	var messages []m.GroupChatMessage
+	if err := json.Unmarshal(body, &messages); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	ids := []int64{}
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+func TestGroupChatCursors(t *testing.T) {
+	sqlitetest.Open(t)
+
+	member := newTestUser(t, "member", false)
+	outsider := newTestUser(t, "outsider", false)
+	groupID := newGroup(t, 1, member)
+
+	var ids []int64
+	for _, content := range []string{"one", "two", "three", "four", "five"} {
+		ids = append(ids, groupMessage(t, groupID, 1, content))
+	}
+	page := func(userID int64, query string) *httptest.ResponseRecorder {
+		return getAs(userID, GetGroupChatMessages, "/groups/messages?groupId="+fmt.Sprint(groupID)+query, nil)
+	}
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"&limit=2", []int64{ids[4], ids[3]}},
+		{"&limit=2&before=" + fmt.Sprint(ids[3]), []int64{ids[2], ids[1]}},
+		{"&limit=2&after=" + fmt.Sprint(ids[1]), []int64{ids[3], ids[2]}},
+		{"&after=" + fmt.Sprint(ids[4]), []int64{}},
+	}
+	for _, tt := range tests {
+		rec := page(member, tt.query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s returned %d: %s", tt.query, rec.Code, rec.Body)
+		}
+		if got := messageIDs(t, rec.Body.Bytes()); !slices.Equal(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if rec := page(member, "&before=2&after=1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("before and after together returned %d, want 400", rec.Code)
+	}
+	if rec := page(outsider, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("outsider got %d, want 403", rec.Code)
+	}
+}
+
+func TestGroupChatJumpToMessage(t *testing.T) {
+	sqlitetest.Open(t)
+
+	outsider := newTestUser(t, "outsider", false)
+	groupID := newGroup(t, 1)
+	var ids []int64
+	for _, content := range []string{"one", "two", "three", "four", "five"} {
+		ids = append(ids, groupMessage(t, groupID, 1, content))
+	}
+
+	rec := getAs(1, GetGroupChatContext, "/groups/messages/around?limit=1&messageId="+fmt.Sprint(ids[2]), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("jump returned %d: %s", rec.Code, rec.Body)
+	}
+	var response struct {
+		GroupID  int64           `json:"group_id"`
+		TargetID int64           `json:"target_id"`
+		Messages json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.GroupID != groupID || response.TargetID != ids[2] {
+		t.Errorf("jump answered group %d target %d, want %d and %d", response.GroupID, response.TargetID, groupID, ids[2])
+	}
+	if got, want := messageIDs(t, response.Messages), []int64{ids[3], ids[2], ids[1]}; !slices.Equal(got, want) {
+		t.Errorf("messages around %d = %v, want %v", ids[2], got, want)
+	}
+
+	if rec := getAs(1, GetGroupChatContext, "/groups/messages/around?messageId=999999", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("jumping to a missing message returned %d, want 404", rec.Code)
+	}
+	if rec := getAs(outsider, GetGroupChatContext, "/groups/messages/around?messageId="+fmt.Sprint(ids[2]), nil); rec.Code != http.StatusForbidden {
+		t.Errorf("outsider jumping into the group got %d, want 403", rec.Code)
+	}
+}
+
+func TestGroupChatSearchStaysInTheGroup(t *testing.T) {
+	sqlitetest.Open(t)
+
+	groupID := newGroup(t, 1)
+	otherGroupID := newGroup(t, 1)
+
+	first := groupMessage(t, groupID, 1, "The zebra crossing")
+	groupMessage(t, groupID, 1, "Nothing to see")
+	second := groupMessage(t, groupID, 1, "Another zebra")
+	groupMessage(t, otherGroupID, 1, "A zebra elsewhere")
+
+	search := func(query string) []int64 {
+		rec := getAs(1, SearchGroupChatMessages, "/groups/messages/search?groupId="+fmt.Sprint(groupID)+query, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("search %s returned %d: %s", query, rec.Code, rec.Body)
+		}
+		return messageIDs(t, rec.Body.Bytes())
+	}
+
+	if got, want := search("&q=zebra"), []int64{second, first}; !slices.Equal(got, want) {
+		t.Errorf("search = %v, want %v", got, want)
+	}
+	if got, want := search("&q=zebra&before="+fmt.Sprint(second)), []int64{first}; !slices.Equal(got, want) {
+		t.Errorf("search before %d = %v, want %v", second, got, want)
+	}
+
+	// Editing a message updates the index
+	if _, err := sqlite.DB.Exec("UPDATE group_chat_messages SET content = 'A horse' WHERE id = ?", first); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := search("&q=zebra"), []int64{second}; !slices.Equal(got, want) {
+		t.Errorf("search after an edit = %v, want %v", got, want)
+	}
+}
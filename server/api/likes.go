@@ -11,7 +11,8 @@ import (
 
 func LikeHandler(w http.ResponseWriter, r *http.Request) {
     cookie, _ := r.Cookie("AccessToken")
-    userID := int(util.UserSession[cookie.Value])
+    sessionUserID, _ := util.SessionUser(cookie.Value)
+    userID := int(sessionUserID)
 
     var like models.Likes
     if err := json.NewDecoder(r.Body).Decode(&like); err != nil {
@@ -37,11 +38,13 @@ func LikeHandler(w http.ResponseWriter, r *http.Request) {
     if err == nil {
         // Update existing like
         newLikeState = !existingLike.Like
-        _, err = tx.Exec(`UPDATE likes SET is_like = ? WHERE id = ?`, newLikeState, existingLike.ID)
+        // Liking again counts as a new like for suggestions
+        _, err = tx.Exec(`UPDATE likes SET is_like = ?, liked_at = CASE WHEN ? THEN CURRENT_TIMESTAMP ELSE liked_at END WHERE id = ?`,
+            newLikeState, newLikeState, existingLike.ID)
     } else {
         // Create new like
         newLikeState = true
-        _, err = tx.Exec(`INSERT INTO likes (user_id, post_id, is_like) VALUES (?, ?, ?)`,
+        _, err = tx.Exec(`INSERT INTO likes (user_id, post_id, is_like, liked_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)`,
             like.UserID, like.PostID, newLikeState)
     }
 
@@ -73,6 +76,10 @@ func LikeHandler(w http.ResponseWriter, r *http.Request) {
     }
     go broadcastLikeUpdate(update)
 
+    if newLikeState {
+        notifyPostLike(int64(like.PostID), uint64(userID))
+    }
+
     json.NewEncoder(w).Encode(update)
 }
 
@@ -84,7 +91,8 @@ func GetPostLikes(w http.ResponseWriter, r *http.Request) {
     }
 
     cookie, _ := r.Cookie("AccessToken")
-    userID := int(util.UserSession[cookie.Value])
+    sessionUserID, _ := util.SessionUser(cookie.Value)
+    userID := int(sessionUserID)
 
     var response struct {
         LikeCount int  `json:"like_count"`
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/loginlimit"
+	"social-network/pkg/mailer"
+	"social-network/pkg/notifications"
+	"social-network/util"
+)
+
+// clientIP is the address a request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// tooManyLogins rejects a login attempt that came before wait was over
+func tooManyLogins(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	http.Error(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+}
+
+// loginFailed counts a failed login against the account with email and the
+// address it came from. The owner of the account is told when it gets locked.
+func loginFailed(email, ip string) {
+	locked, err := loginlimit.Fail(loginlimit.AccountKey(email), loginlimit.Account)
+	if err != nil {
+		log.Printf("Error recording failed login for %s: %v", email, err)
+	}
+	if _, err := loginlimit.Fail(loginlimit.IPKey(ip), loginlimit.IP); err != nil {
+		log.Printf("Error recording failed login from %s: %v", ip, err)
+	}
+	if locked {
+		notifyAccountLocked(email, ip)
+	}
+}
+
+// notifyAccountLocked tells the owner of the account with email, if there is
+// one, that it was locked, both in the app and by email. email is matched
+// however it was typed, like the lock itself.
+func notifyAccountLocked(typedEmail, ip string) {
+	var userID int64
+	var username, email string
+	err := sqlite.DB.QueryRow(
+		"SELECT id, username, email FROM users WHERE lower(email) = ? ORDER BY id LIMIT 1",
+		util.NormalizeEmail(typedEmail),
+	).Scan(&userID, &username, &email)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up locked account %s: %v", typedEmail, err)
+		return
+	}
+
+	minutes := int(loginlimit.Account.Lockout.Minutes())
+	now := time.Now()
+	notification := m.Notification{
+		ToUserID: int(userID),
+		Content: fmt.Sprintf(
+			"Your account was locked for %d minutes after too many failed logins", minutes,
+		),
+		Type:           m.NotificationAccountLocked,
+		CreatedAt:      now,
+		IdempotencyKey: notifications.Key(m.NotificationAccountLocked, userID, now.Unix()),
+	}
+	if err := notifications.Send(&notification); err != nil {
+		log.Printf("Error creating account locked notification: %v", err)
+	}
+
+	err = accountMailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Your account was locked",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nThere were %d failed attempts to log in to your account, the last from %s, "+
+				"so logging in is blocked for %d minutes.\n\n"+
+				"If this wasn't you, consider resetting your password.\n",
+			username, loginlimit.Account.LockoutAfter, ip, minutes,
+		),
+	})
+	if err != nil {
+		log.Printf("Error emailing user %d about their locked account: %v", userID, err)
+	}
+}
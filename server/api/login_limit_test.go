@@ -0,0 +1,36 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"testing"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+	"social-network/pkg/loginlimit"
+)
+
+func TestLockNotifiesOwnerHoweverTheEmailIsTyped(t *testing.T) {
+	sqlitetest.Open(t)
+	mail := recordMail(t)
+	owner := newTestUser(t, "locked_test", false)
+
+	for i := 0; i < loginlimit.Account.LockoutAfter; i++ {
+		loginFailed(" Locked_Test@EXAMPLE.com", "10.0.0.1")
+	}
+
+	var locked int
+	sqlite.DB.QueryRow(
+		"SELECT COUNT(*) FROM notifications WHERE to_user_id = ? AND type = ?",
+		owner, m.NotificationAccountLocked,
+	).Scan(&locked)
+	if locked != 1 {
+		t.Errorf("owner got %d account_locked notifications, want 1", locked)
+	}
+
+	sent := mail.messages()
+	if len(sent) != 1 || sent[0].To != "locked_test@example.com" {
+		t.Errorf("sent %+v, want one email to the stored address", sent)
+	}
+}
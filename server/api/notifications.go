@@ -6,11 +6,24 @@ import (
 	//"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 	"social-network/models"
 	"social-network/pkg/db/sqlite"
+	"social-network/pkg/digest"
+	"social-network/pkg/notifications"
 	"social-network/util"
 )
 
+const (
+    defaultNotificationPageSize = 50
+    maxNotificationPageSize     = 100
+)
+
+// GetNotifications lists the caller's notifications, most recently updated
+// first. A full page sets X-Next-Cursor to the cursor to pass as `before` for
+// the next one.
+
 func GetNotifications(w http.ResponseWriter, r *http.Request) {
     userID, err := util.GetUserID(r, w)
     if err != nil {
@@ -18,6 +31,18 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    beforeDay, beforeID, err := util.ParseTimeCursor(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    limit, err := util.PageSize(r, defaultNotificationPageSize, maxNotificationPageSize)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
     rows, err := sqlite.DB.Query(`
         SELECT 
             n.id, 
@@ -28,6 +53,11 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
             n.created_at, 
             n.type, 
             n.group_id,
+            n.target_type,
+            n.target_id,
+            n.actor_count,
+            n.updated_at,
+            julianday(n.updated_at),
             CASE 
                 WHEN n.type = 'follow_request' THEN EXISTS(
                     SELECT 1 FROM followers 
@@ -39,6 +69,10 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
             END as has_pending_request
         FROM notifications n
         WHERE n.to_user_id = ?
+        AND (
+            ? = 0
+            OR (julianday(n.updated_at), n.id) < (?, ?)
+        )
         AND (
             n.type != 'follow_request' 
             OR (
@@ -51,11 +85,9 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
                 )
             )
         )
-        ORDER BY 
-            n.created_at DESC,
-            CASE WHEN n.type = 'follow_request' THEN 0 ELSE 1 END
-        LIMIT 50;
-    `, userID)
+        ORDER BY julianday(n.updated_at) DESC, n.id DESC
+        LIMIT ?;
+    `, userID, beforeID, beforeDay, beforeID, limit)
     if err != nil {
         log.Printf("Database error: %v", err)
         http.Error(w, "Database error", http.StatusInternalServerError)
@@ -63,11 +95,15 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
     }
     defer rows.Close()
 
-    var notifications []models.Notification
+    list := []models.Notification{}
+    var lastDay float64
+    var lastID int
     for rows.Next() {
         var notification models.Notification
         var fromUserID sql.NullInt64
         var groupID sql.NullInt64
+        var targetType sql.NullString
+        var targetID sql.NullInt64
         var hasPendingRequest bool
 
         err := rows.Scan(
@@ -79,12 +115,18 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
             &notification.CreatedAt,
             &notification.Type,
             &groupID,
+            &targetType,
+            &targetID,
+            &notification.ActorCount,
+            &notification.UpdatedAt,
+            &lastDay,
             &hasPendingRequest,
         )
         if err != nil {
             log.Printf("Error scanning notification: %v", err)
             continue
         }
+        lastID = notification.ID
 
         // Only include follow request notifications if they have a pending request
         if notification.Type == models.NotificationTypeFollow && !hasPendingRequest {
@@ -97,8 +139,10 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
         if groupID.Valid {
             notification.GroupID = int(groupID.Int64)
         }
+        notification.TargetType = targetType.String
+        notification.TargetID = int(targetID.Int64)
 
-        notifications = append(notifications, notification)
+        list = append(list, notification)
     }
 
     if err := rows.Err(); err != nil {
@@ -107,8 +151,27 @@ func GetNotifications(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    ids := make([]int, len(list))
+    for i, notification := range list {
+        ids[i] = notification.ID
+    }
+    actors, err := notifications.Actors(ids)
+    if err != nil {
+        log.Printf("Error loading notification actors: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    for i := range list {
+        list[i].Actors = actors[list[i].ID]
+    }
+
+    // The cursor carries the position itself, so later pages stay put when
+    // a notification is folded into or deleted
+    if len(list) == limit {
+        w.Header().Set("X-Next-Cursor", util.TimeCursor(lastDay, int64(lastID)))
+    }
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(notifications)
+    json.NewEncoder(w).Encode(list)
 }
 
 
@@ -122,10 +185,10 @@ func MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
 
     notificationID := r.PathValue("id")
     
-    _, err = sqlite.DB.Exec(`
+    result, err := sqlite.DB.Exec(`
         UPDATE notifications 
         SET read = true 
-        WHERE id = ? AND to_user_id = ?
+        WHERE id = ? AND to_user_id = ? AND read = false
     `, notificationID, userID)
     
     if err != nil {
@@ -133,5 +196,399 @@ func MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    if updated, _ := result.RowsAffected(); updated > 0 {
+        notifications.PublishUnreadCount(int(userID))
+    }
+
     w.WriteHeader(http.StatusOK)
-} 
\ No newline at end of file
+} 
+
+// GetUnreadCount returns how many of the caller's notifications are unread
+func GetUnreadCount(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    count, err := notifications.UnreadCount(sqlite.DB, int(userID))
+    if err != nil {
+        log.Printf("Error counting unread notifications: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]int{"count": count})
+}
+
+// MarkAllNotificationsRead marks every unread notification of the caller as
+// read, or only those of the type given in the `type` query parameter
+func MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    notificationType := r.URL.Query().Get("type")
+    if notificationType != "" && !models.IsPersistedNotificationType(notificationType) {
+        http.Error(w, "Unknown notification type: "+notificationType, http.StatusBadRequest)
+        return
+    }
+
+    result, err := sqlite.DB.Exec(`
+        UPDATE notifications
+        SET read = true
+        WHERE to_user_id = ? AND read = false
+        AND (? = '' OR type = ?)
+    `, userID, notificationType, notificationType)
+    if err != nil {
+        log.Printf("Error marking notifications read: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    updated, _ := result.RowsAffected()
+    if updated > 0 {
+        notifications.PublishUnreadCount(int(userID))
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]int64{"updated": updated})
+}
+
+// GetNotificationPreferences returns the caller's settings for every
+// notification type. Types they never changed come back fully enabled.
+func GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    stored := make(map[string]models.NotificationPreference)
+    rows, err := sqlite.DB.Query(`
+        SELECT type, in_app, push, digest
+        FROM notification_preferences
+        WHERE user_id = ?
+    `, userID)
+    if err != nil {
+        log.Printf("Error fetching notification preferences: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var pref models.NotificationPreference
+        if err := rows.Scan(&pref.Type, &pref.InApp, &pref.Push, &pref.Digest); err != nil {
+            log.Printf("Error scanning notification preference: %v", err)
+            http.Error(w, "Database error", http.StatusInternalServerError)
+            return
+        }
+        stored[pref.Type] = pref
+    }
+
+    preferences := make([]models.NotificationPreference, 0, len(models.NotificationTypes))
+    for _, t := range models.NotificationTypes {
+        pref, ok := stored[t]
+        if !ok {
+            pref = models.NotificationPreference{Type: t, InApp: true, Push: true, Digest: true}
+        }
+        preferences = append(preferences, pref)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(preferences)
+}
+
+// UpdateNotificationPreferences saves the settings for each notification type
+// sent in the body. Types that are left out keep their current settings.
+func UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    var preferences []models.NotificationPreference
+    if err := json.NewDecoder(r.Body).Decode(&preferences); err != nil {
+        http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+        return
+    }
+
+    for _, pref := range preferences {
+        if !models.IsNotificationType(pref.Type) {
+            util.WriteFieldError(w, http.StatusBadRequest, "type", "must be a known notification type")
+            return
+        }
+    }
+
+    tx, err := sqlite.DB.Begin()
+    if err != nil {
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    defer tx.Rollback()
+
+    for _, pref := range preferences {
+        _, err := tx.Exec(`
+            INSERT INTO notification_preferences (user_id, type, in_app, push, digest)
+            VALUES (?, ?, ?, ?, ?)
+            ON CONFLICT (user_id, type) DO UPDATE SET
+                in_app = excluded.in_app,
+                push = excluded.push,
+                digest = excluded.digest
+        `, userID, pref.Type, pref.InApp, pref.Push, pref.Digest)
+        if err != nil {
+            log.Printf("Error saving notification preference: %v", err)
+            http.Error(w, "Database error", http.StatusInternalServerError)
+            return
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    GetNotificationPreferences(w, r)
+}
+
+// GetDigestSettings returns how often the caller gets an email digest of
+// their unread notifications
+func GetDigestSettings(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    frequency, _, err := digest.Settings(int(userID))
+    if err != nil {
+        log.Printf("Error fetching digest settings: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"frequency": frequency})
+}
+
+// UpdateDigestSettings sets how often the caller gets an email digest: off,
+// daily or weekly
+func UpdateDigestSettings(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    var settings struct {
+        Frequency string `json:"frequency"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+        http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+        return
+    }
+    if !digest.IsFrequency(settings.Frequency) {
+        util.WriteFieldError(w, http.StatusBadRequest, "frequency", "must be one of off, daily, weekly")
+        return
+    }
+
+    if _, _, err := digest.Settings(int(userID)); err != nil {
+        log.Printf("Error creating digest settings: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    _, err = sqlite.DB.Exec("UPDATE digest_settings SET frequency = ? WHERE user_id = ?", settings.Frequency, userID)
+    if err != nil {
+        log.Printf("Error updating digest settings: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(settings)
+}
+
+// UnsubscribeDigest turns off the email digest of whoever the token in the
+// link at the bottom of every digest belongs to. It needs no login.
+func UnsubscribeDigest(w http.ResponseWriter, r *http.Request) {
+    token := r.URL.Query().Get("token")
+    if token == "" {
+        http.Error(w, "Missing token", http.StatusBadRequest)
+        return
+    }
+
+    result, err := sqlite.DB.Exec(
+        "UPDATE digest_settings SET frequency = ? WHERE unsubscribe_token = ?",
+        digest.FrequencyOff, token,
+    )
+    if err != nil {
+        log.Printf("Error unsubscribing from digest: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    if updated, _ := result.RowsAffected(); updated == 0 {
+        http.Error(w, "Invalid unsubscribe link", http.StatusNotFound)
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    w.Write([]byte("You will no longer receive notification digests by email."))
+}
+
+// GetMutes lists the users, groups and conversations the caller muted that
+// have not expired. ?type= narrows the list to one target type.
+func GetMutes(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    targetType := r.URL.Query().Get("type")
+    if targetType != "" && !models.IsMuteTarget(targetType) {
+        http.Error(w, "type must be user, group or conversation", http.StatusBadRequest)
+        return
+    }
+
+    // Expired mutes have no effect any more, so drop them on the way
+    _, err = sqlite.DB.Exec(`
+        DELETE FROM mutes
+        WHERE user_id = ? AND expires_at IS NOT NULL AND julianday(expires_at) <= julianday('now')
+    `, userID)
+    if err != nil {
+        log.Printf("Error deleting expired mutes: %v", err)
+    }
+
+    rows, err := sqlite.DB.Query(`
+        SELECT id, target_type, target_id, expires_at, created_at
+        FROM mutes
+        WHERE user_id = ? AND (? = '' OR target_type = ?)
+        AND (expires_at IS NULL OR julianday(expires_at) > julianday('now'))
+        ORDER BY created_at DESC
+    `, userID, targetType, targetType)
+    if err != nil {
+        log.Printf("Error fetching mutes: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    defer rows.Close()
+
+    mutes := []models.Mute{}
+    for rows.Next() {
+        var mute models.Mute
+        var expiresAt sql.NullTime
+        if err := rows.Scan(&mute.ID, &mute.TargetType, &mute.TargetID, &expiresAt, &mute.CreatedAt); err != nil {
+            log.Printf("Error scanning mute: %v", err)
+            http.Error(w, "Database error", http.StatusInternalServerError)
+            return
+        }
+        if expiresAt.Valid {
+            mute.ExpiresAt = &expiresAt.Time
+        }
+        mutes = append(mutes, mute)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(mutes)
+}
+
+// CreateMute mutes another user, a group the caller belongs to or a direct
+// conversation, until expires_at if it is given. Muting the same target again
+// replaces its expiry.
+func CreateMute(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    var mute models.Mute
+    if err := json.NewDecoder(r.Body).Decode(&mute); err != nil {
+        http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+        return
+    }
+
+    switch mute.TargetType {
+    case models.MuteTargetGroup:
+        isMember, err := isGroupMember(int64(mute.TargetID), userID)
+        if err != nil {
+            http.Error(w, "Database error", http.StatusInternalServerError)
+            return
+        }
+        if !isMember {
+            http.Error(w, "You are not a member of this group", http.StatusForbidden)
+            return
+        }
+    case models.MuteTargetConversation, models.MuteTargetUser:
+        var exists bool
+        err := sqlite.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", mute.TargetID).Scan(&exists)
+        if err != nil {
+            http.Error(w, "Database error", http.StatusInternalServerError)
+            return
+        }
+        if !exists || uint64(mute.TargetID) == userID {
+            util.WriteFieldError(w, http.StatusBadRequest, "target_id", "must be another user")
+            return
+        }
+    default:
+        util.WriteFieldError(w, http.StatusBadRequest, "target_type", "must be one of user, group, conversation")
+        return
+    }
+
+    if mute.ExpiresAt != nil {
+        if !mute.ExpiresAt.After(time.Now()) {
+            util.WriteFieldError(w, http.StatusBadRequest, "expires_at", "must be in the future")
+            return
+        }
+        expiresAt := mute.ExpiresAt.UTC()
+        mute.ExpiresAt = &expiresAt
+    }
+
+    _, err = sqlite.DB.Exec(`
+        INSERT INTO mutes (user_id, target_type, target_id, expires_at)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (user_id, target_type, target_id) DO UPDATE SET expires_at = excluded.expires_at
+    `, userID, mute.TargetType, mute.TargetID, mute.ExpiresAt)
+    if err != nil {
+        log.Printf("Error creating mute: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    err = sqlite.DB.QueryRow(`
+        SELECT id, created_at FROM mutes
+        WHERE user_id = ? AND target_type = ? AND target_id = ?
+    `, userID, mute.TargetType, mute.TargetID).Scan(&mute.ID, &mute.CreatedAt)
+    if err != nil {
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(mute)
+}
+
+// DeleteMute unmutes a user, group or conversation
+func DeleteMute(w http.ResponseWriter, r *http.Request) {
+    userID, err := util.GetUserID(r, w)
+    if err != nil {
+        return
+    }
+
+    muteID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        http.Error(w, "Invalid mute ID", http.StatusBadRequest)
+        return
+    }
+
+    result, err := sqlite.DB.Exec("DELETE FROM mutes WHERE id = ? AND user_id = ?", muteID, userID)
+    if err != nil {
+        log.Printf("Error deleting mute: %v", err)
+        http.Error(w, "Database error", http.StatusInternalServerError)
+        return
+    }
+    if deleted, _ := result.RowsAffected(); deleted == 0 {
+        http.Error(w, "Mute not found", http.StatusNotFound)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,194 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+	"social-network/pkg/notifications"
+)
+
+// likeAt notifies toUserID that actorID liked postID at the given time
+func likeAt(t *testing.T, toUserID int64, actorID, postID int, at time.Time) m.Notification {
+	t.Helper()
+	n := m.Notification{
+		ToUserID:       int(toUserID),
+		FromUserID:     actorID,
+		Content:        "liked your post",
+		Type:           m.NotificationPostLike,
+		CreatedAt:      at,
+		IdempotencyKey: notifications.Key(m.NotificationPostLike, postID, actorID),
+		TargetType:     m.SourcePost,
+		TargetID:       postID,
+	}
+	if err := notifications.Send(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// notificationPage lists a page of userID's notifications and returns their
+// target ids and the cursor for the next page
+func notificationPage(t *testing.T, userID int64, before string) ([]int, string) {
+	t.Helper()
+	query := url.Values{"limit": {"2"}}
+	if before != "" {
+		query.Set("before", before)
+	}
+	rec := getAs(userID, GetNotifications, "/notifications?"+query.Encode(), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /notifications = %d %s", rec.Code, rec.Body)
+	}
+	var list []m.Notification
+	json.NewDecoder(rec.Body).Decode(&list)
+	targets := make([]int, len(list))
+	for i, n := range list {
+		targets[i] = n.TargetID
+	}
+	return targets, rec.Header().Get("X-Next-Cursor")
+}
+
+func TestNotificationCursorSurvivesFoldsAndDeletes(t *testing.T) {
+	sqlitetest.Open(t)
+	owner := newTestUser(t, "owner_test", false)
+
+	// Likes of posts 1 to 5, a minute apart, the newest last
+	start := time.Now().Add(-time.Hour)
+	byPost := make(map[int]m.Notification)
+	for post := 1; post <= 5; post++ {
+		byPost[post] = likeAt(t, owner, 2, post, start.Add(time.Duration(post)*time.Minute))
+	}
+
+	page, next := notificationPage(t, owner, "")
+	if fmt.Sprint(page) != "[5 4]" || next == "" {
+		t.Fatalf("first page = %v (next %q), want posts 5 and 4 with a cursor", page, next)
+	}
+
+	// Post 5 is liked again, which moves its notification to the top, and
+	// the notification the cursor points at goes away
+	likeAt(t, owner, 3, 5, time.Now())
+	if _, err := sqlite.DB.Exec("DELETE FROM notifications WHERE id = ?", byPost[4].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	page, next = notificationPage(t, owner, next)
+	if fmt.Sprint(page) != "[3 2]" || next == "" {
+		t.Fatalf("second page = %v (next %q), want posts 3 and 2", page, next)
+	}
+	page, _ = notificationPage(t, owner, next)
+	if fmt.Sprint(page) != "[1]" {
+		t.Errorf("last page = %v, want post 1", page)
+	}
+
+	rec := getAs(owner, GetNotifications, "/notifications?before=17", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("a bare notification id as cursor = %d, want 400", rec.Code)
+	}
+}
+
+// muteUser stores a mute of targetID by userID that expires at expiresAt
+func muteUser(t *testing.T, userID, targetID int64, expiresAt time.Time) {
+	t.Helper()
+	_, err := sqlite.DB.Exec(
+		"INSERT INTO mutes (user_id, target_type, target_id, expires_at) VALUES (?, ?, ?, ?)",
+		userID, m.MuteTargetUser, targetID, expiresAt.UTC(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// feedAuthors lists the authors of the posts in userID's feed
+func feedAuthors(t *testing.T, userID int64) []int64 {
+	t.Helper()
+	rec := getAs(userID, GetPosts, "/posts", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /posts = %d %s", rec.Code, rec.Body)
+	}
+	var posts []struct {
+		Author int64 `json:"author"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&posts); err != nil {
+		t.Fatal(err)
+	}
+	authors := make([]int64, len(posts))
+	for i, post := range posts {
+		authors[i] = post.Author
+	}
+	return authors
+}
+
+func TestMutesExpire(t *testing.T) {
+	sqlitetest.Open(t)
+
+	viewer := newTestUser(t, "viewer", false)
+	muted := newTestUser(t, "muted", false)
+	expired := newTestUser(t, "expired", false)
+	muteUser(t, viewer, muted, time.Now().Add(time.Hour))
+	muteUser(t, viewer, expired, time.Now().Add(-time.Minute))
+	postBy(t, muted, time.Now())
+	postBy(t, expired, time.Now())
+
+	authors := feedAuthors(t, viewer)
+	if slices.Contains(authors, muted) || !slices.Contains(authors, expired) {
+		t.Errorf("feed authors = %v, want %d hidden and %d shown again", authors, muted, expired)
+	}
+
+	likeAt(t, viewer, int(muted), 1, time.Now())
+	likeAt(t, viewer, int(expired), 2, time.Now())
+	var from []int64
+	rows, err := sqlite.DB.Query("SELECT from_user_id FROM notifications WHERE to_user_id = ?", viewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		rows.Scan(&id)
+		from = append(from, id)
+	}
+	if !slices.Equal(from, []int64{expired}) {
+		t.Errorf("notifications came from %v, want only the user whose mute expired (%d)", from, expired)
+	}
+
+	// Listing mutes skips and clears the expired one
+	rec := getAs(viewer, GetMutes, "/mutes", nil)
+	var mutes []m.Mute
+	json.NewDecoder(rec.Body).Decode(&mutes)
+	if len(mutes) != 1 || mutes[0].TargetID != int(muted) || mutes[0].ExpiresAt == nil {
+		t.Errorf("mutes = %+v, want only the unexpired mute of %d", mutes, muted)
+	}
+	var left int
+	sqlite.DB.QueryRow("SELECT COUNT(*) FROM mutes WHERE user_id = ?", viewer).Scan(&left)
+	if left != 1 {
+		t.Errorf("%d mutes are stored, want the expired one deleted", left)
+	}
+}
+
+func TestMuteMustExpireInTheFuture(t *testing.T) {
+	sqlitetest.Open(t)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	body := fmt.Sprintf(`{"target_type": %q, "target_id": 2, "expires_at": %q}`, m.MuteTargetUser, past)
+	if rec := postAs(1, CreateMute, "/mutes", body); rec.Code != http.StatusBadRequest {
+		t.Errorf("muting until the past returned %d, want 400", rec.Code)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body = fmt.Sprintf(`{"target_type": %q, "target_id": 2, "expires_at": %q}`, m.MuteTargetUser, future)
+	if rec := postAs(1, CreateMute, "/mutes", body); rec.Code != http.StatusCreated {
+		t.Errorf("muting for an hour returned %d: %s", rec.Code, rec.Body)
+	}
+	if muted, err := notifications.MutedTarget(sqlite.DB, 1, m.MuteTargetUser, 2); err != nil || !muted {
+		t.Errorf("MutedTarget = %v, %v, want the new mute in effect", muted, err)
+	}
+}
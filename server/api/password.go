@@ -0,0 +1,314 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/loginlimit"
+	"social-network/pkg/mailer"
+	"social-network/util"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTTL is how long a reset token can be used
+const passwordResetTTL = time.Hour
+
+var accountMailer mailer.Mailer = &mailer.LogMailer{}
+
+// SetMailer registers the mailer used for account emails such as password
+// resets
+func SetMailer(mlr mailer.Mailer) {
+	accountMailer = mlr
+}
+
+// hashToken is what the password_resets and email_verifications tables store
+// in place of a token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// setPassword stores a new password for userID and voids the user's
+// outstanding reset tokens
+func setPassword(tx *sql.Tx, userID uint64, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", string(hash), userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL",
+		time.Now().UTC(), userID,
+	)
+	return err
+}
+
+// ChangePassword sets a new password for the caller after checking the
+// current one. Every other session of the caller is logged out.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	v := util.Validator{}
+	v.Password("new_password", req.NewPassword)
+	if !v.Valid() {
+		v.Write(w, http.StatusBadRequest)
+		return
+	}
+
+	var hash, email string
+	if err := sqlite.DB.QueryRow("SELECT password, email FROM users WHERE id = ?", userID).Scan(&hash, &email); err != nil {
+		http.Error(w, "Error changing password", http.StatusInternalServerError)
+		return
+	}
+
+	// Wrong current passwords count as failed logins, so a stolen session
+	// can't be used to guess the password
+	ip := clientIP(r)
+	accountKey := loginlimit.AccountKey(email)
+	wait, err := loginlimit.RetryAfter(accountKey, loginlimit.IPKey(ip))
+	if err != nil {
+		http.Error(w, "Error changing password", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		tooManyLogins(w, wait)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.CurrentPassword)) != nil {
+		loginFailed(email, ip)
+		util.WriteFieldError(w, http.StatusForbidden, "current_password", "is incorrect")
+		return
+	}
+	if err := loginlimit.Reset(accountKey); err != nil {
+		log.Printf("Error resetting failed logins of user %d: %v", userID, err)
+	}
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error changing password", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := setPassword(tx, userID, req.NewPassword); err != nil {
+		log.Printf("Error changing password of user %d: %v", userID, err)
+		http.Error(w, "Error changing password", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error changing password", http.StatusInternalServerError)
+		return
+	}
+
+	cookie, _ := r.Cookie("AccessToken")
+	util.RevokeSessions(uint(userID), cookie.Value)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword emails a reset link to the account with the given email.
+// The response is the same whether the account exists or not, and takes as
+// long, so it can't be used to find out who is registered.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	v := util.Validator{}
+	v.Email("email", req.Email)
+	if !v.Valid() {
+		v.Write(w, http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	resetKey := loginlimit.PasswordResetKey(req.Email)
+	wait, err := loginlimit.RetryAfter(resetKey, loginlimit.PasswordResetIPKey(ip))
+	if err != nil {
+		http.Error(w, "Error sending password reset", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "Too many password reset requests, try again later", http.StatusTooManyRequests)
+		return
+	}
+	if _, err := loginlimit.Fail(resetKey, loginlimit.PasswordReset); err != nil {
+		log.Printf("Error counting password reset requests for %s: %v", req.Email, err)
+	}
+	if _, err := loginlimit.Fail(loginlimit.PasswordResetIPKey(ip), loginlimit.IP); err != nil {
+		log.Printf("Error counting password reset requests from %s: %v", ip, err)
+	}
+
+	// Looking up the account and mailing it happen after the response, so
+	// known emails aren't answered any slower than unknown ones
+	go func(email string) {
+		if err := sendPasswordReset(email); err != nil {
+			log.Printf("Error sending password reset: %v", err)
+		}
+	}(req.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordReset creates a reset token for the account with email, if
+// there is one, and mails it. Older unused tokens stop working.
+func sendPasswordReset(email string) error {
+	var userID int64
+	var username string
+	err := sqlite.DB.QueryRow("SELECT id, username FROM users WHERE email = ?", email).Scan(&userID, &username)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token := util.GenerateSessionToken()
+	now := time.Now().UTC()
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL",
+		now, userID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO password_resets (user_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?)`,
+		userID, hashToken(token), now.Add(passwordResetTTL), now,
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:3000"
+	}
+	return accountMailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nTo choose a new password, open %s/reset-password?token=%s\n\n"+
+				"The link works once and expires in %d minutes. If you didn't ask for it, you can ignore this email.\n",
+			username, appURL, url.QueryEscape(token), int(passwordResetTTL.Minutes()),
+		),
+	})
+}
+
+// ResetPassword sets a new password using a token from a reset email. The
+// token is used up, every session of the user is logged out and the caller
+// is logged in.
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	v := util.Validator{}
+	v.Required("token", req.Token)
+	v.Password("new_password", req.NewPassword)
+	if !v.Valid() {
+		v.Write(w, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var userID uint64
+	err = tx.QueryRow(`
+		SELECT user_id FROM password_resets
+		WHERE token_hash = ? AND used_at IS NULL AND julianday(expires_at) > julianday('now')`,
+		hashToken(req.Token),
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		util.WriteFieldError(w, http.StatusBadRequest, "token", "is invalid or has expired")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	// Voids this token along with any other
+	if err := setPassword(tx, userID, req.NewPassword); err != nil {
+		log.Printf("Error resetting password of user %d: %v", userID, err)
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	var username, email string
+	err = tx.QueryRow("SELECT username, email FROM users WHERE id = ?", userID).Scan(&username, &email)
+	if err != nil {
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	// Proving access to the email unlocks the account
+	if err := loginlimit.Reset(loginlimit.AccountKey(email)); err != nil {
+		log.Printf("Error resetting failed logins of user %d: %v", userID, err)
+	}
+
+	util.RevokeSessions(uint(userID), "")
+	util.StartSession(w, uint(userID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.UserResponse{
+		ID:       int64(userID),
+		Username: username,
+	})
+}
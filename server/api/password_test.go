@@ -0,0 +1,103 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func setTestPassword(t *testing.T, userID int64, password string) {
+	t.Helper()
+	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if _, err := sqlite.DB.Exec("UPDATE users SET password = ? WHERE id = ?", string(hash), userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func forgotPassword(email string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"`+email+`"}`))
+	rec := httptest.NewRecorder()
+	ForgotPassword(rec, req)
+	return rec
+}
+
+func TestForgotPasswordIsThrottledPerEmail(t *testing.T) {
+	sqlitetest.Open(t)
+	mail := recordMail(t)
+	newTestUser(t, "known_test", false)
+
+	for _, email := range []string{"known_test@example.com", "nobody@example.com"} {
+		for i := 1; i <= 3; i++ {
+			if rec := forgotPassword(email); rec.Code != http.StatusAccepted {
+				t.Fatalf("request %d for %s = %d, want 202", i, email, rec.Code)
+			}
+		}
+		rec := forgotPassword(email)
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("fourth request for %s = %d (Retry-After %q), want 429", email, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	// Another email from the same address still goes through
+	if rec := forgotPassword("other@example.com"); rec.Code != http.StatusAccepted {
+		t.Errorf("request for another email = %d, want 202", rec.Code)
+	}
+
+	// Only the known account is mailed, after the response
+	deadline := time.Now().Add(2 * time.Second)
+	for len(mail.messages()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, msg := range mail.messages() {
+		if msg.To != "known_test@example.com" {
+			t.Errorf("a reset email went to %s", msg.To)
+		}
+	}
+	if got := len(mail.messages()); got != 3 {
+		t.Errorf("sent %d reset emails, want 3", got)
+	}
+}
+
+func TestChangePasswordCountsWrongPasswordsAsFailedLogins(t *testing.T) {
+	sqlitetest.Open(t)
+	user := newTestUser(t, "owner_test", false)
+	setTestPassword(t, user, "Correct horse 1")
+
+	change := func(current string) *httptest.ResponseRecorder {
+		return postAs(user, ChangePassword, "/user/password",
+			`{"current_password":"`+current+`","new_password":"Battery staple 2"}`)
+	}
+
+	// Three free attempts, then the fourth failure makes the next one wait
+	for i := 1; i <= 4; i++ {
+		if rec := change("wrong"); rec.Code != http.StatusForbidden {
+			t.Fatalf("wrong password %d = %d, want 403", i, rec.Code)
+		}
+	}
+	rec := change("Correct horse 1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("right password while throttled = %d, want 429 with Retry-After", rec.Code)
+	}
+
+	if _, err := sqlite.DB.Exec("UPDATE login_throttles SET blocked_until = NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if rec := change("Correct horse 1"); rec.Code != http.StatusNoContent {
+		t.Fatalf("right password once the wait is over = %d %s, want 204", rec.Code, rec.Body)
+	}
+	var failures int
+	sqlite.DB.QueryRow("SELECT COUNT(*) FROM login_throttles WHERE key = 'account:owner_test@example.com'").Scan(&failures)
+	if failures != 0 {
+		t.Error("a successful password change didn't clear the failed logins")
+	}
+}
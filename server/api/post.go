@@ -17,6 +17,41 @@ import (
 	"social-network/util"
 )
 
+// visiblePostsClause limits rows of the posts table aliased `p` to the ones a
+// viewer, bound as sql.Named("viewer", id), is allowed to see: their own posts,
+// public posts of public accounts or accounts they follow, follower-only posts
+// of accounts they follow, and close-friend posts whose list includes them.
+// Posts of users the viewer blocked or was blocked by are never visible.
+var visiblePostsClause = `(
+	p.author = :viewer
+	OR (` + notBlockedClause("p.author", ":viewer") + ` AND (
+		(p.privacy = 1 AND (
+			COALESCE((SELECT is_private FROM users WHERE id = p.author), 0) = 0
+			OR EXISTS (
+				SELECT 1 FROM followers vf
+				WHERE vf.follower_id = :viewer AND vf.followed_id = p.author AND vf.status = 'accept'
+			)
+		))
+		OR (p.privacy = 2 AND EXISTS (
+			SELECT 1 FROM followers vf
+			WHERE vf.follower_id = :viewer AND vf.followed_id = p.author AND vf.status = 'accept'
+		))
+		OR (p.privacy = 3 AND EXISTS (
+			SELECT 1 FROM close_friends cf
+			WHERE cf.user_id = p.author AND cf.friend_id = :viewer
+		))
+	))
+)`
+
+const (
+	maxPostTitleLength   = 200
+	maxPostContentLength = 5000
+	maxCommentLength     = 2000
+)
+
+// privacyProblem is the field error for a post privacy other than 1 (public),
+// 2 (followers) or 3 (close friends)
+const privacyProblem = "must be 1 (public), 2 (followers) or 3 (close friends)"
 
 func CreatePost(w http.ResponseWriter, r *http.Request) {
 	var postInput struct {
@@ -39,10 +74,14 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate input
-	if strings.TrimSpace(postInput.Title) == "" && 
-	   strings.TrimSpace(postInput.Content) == "" && 
-	   postInput.Media == "" {
-		http.Error(w, "Post must have either title, content, or media", http.StatusBadRequest)
+	v := util.Validator{}
+	v.Length("title", postInput.Title, 0, maxPostTitleLength)
+	v.Length("content", postInput.Content, 0, maxPostContentLength)
+	v.Check(strings.TrimSpace(postInput.Title) != "" || strings.TrimSpace(postInput.Content) != "" || postInput.Media != "",
+		"content", "is required when there is no title or media")
+	v.Check(postInput.Privacy >= 1 && postInput.Privacy <= 3, "privacy", privacyProblem)
+	if !v.Valid() {
+		v.Write(w, http.StatusBadRequest)
 		return
 	}
 
@@ -54,13 +93,6 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate privacy value
-	if postInput.Privacy != 1 && postInput.Privacy != 2 && postInput.Privacy != 3 {
-		log.Printf("Invalid privacy value: %d", postInput.Privacy)
-		http.Error(w, "Invalid privacy type", http.StatusBadRequest)
-		return
-	}
-
 	var mediaBytes []byte
 	var mediaType string
 
@@ -69,8 +101,8 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 		// Split the base64 string to get the media type
 		parts := strings.Split(postInput.Media, ";base64,")
 		if len(parts) != 2 {
-			log.Printf("Invalid media format: %s", postInput.Media[:100]) // Log first 100 chars
-			http.Error(w, "Invalid media format", http.StatusBadRequest)
+			log.Printf("Invalid media format: %s", postInput.Media[:min(len(postInput.Media), 100)]) // Log first 100 chars
+			util.WriteFieldError(w, http.StatusBadRequest, "media", "must be a base64 data URL")
 			return
 		}
 
@@ -83,7 +115,7 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 		mediaBytes, err = base64.StdEncoding.DecodeString(parts[1])
 		if err != nil {
 			log.Printf("Base64 decode error: %v", err)
-			http.Error(w, "Invalid media encoding", http.StatusBadRequest)
+			util.WriteFieldError(w, http.StatusBadRequest, "media", "must be base64 encoded")
 			return
 		}
 	}
@@ -113,6 +145,8 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 
 	postID, _ := result.LastInsertId()
 
+	indexContent(m.SourcePost, postID, userID, 0, postInput.Title+"\n"+postInput.Content)
+
 	// Return the created post
 	response := m.PostResponse{
 		ID: postID,
@@ -133,6 +167,11 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 
 
 func ViewPost(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
 	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid post ID", http.StatusBadRequest)
@@ -173,6 +212,17 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	blocked, err := isBlocked(int64(viewerID), post.Author)
+	if err != nil {
+		http.Error(w, "Error fetching post", http.StatusInternalServerError)
+		log.Printf("view post: %v", err)
+		return
+	}
+	if blocked {
+		http.Error(w, "Post does not exist", http.StatusNotFound)
+		return
+	}
+
 	response := m.PostResponse{
 		ID:        post.ID,
 		Title:     post.Title,
@@ -199,15 +249,7 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 
 func GetPosts(w http.ResponseWriter, r *http.Request) {
     cookie, _ := r.Cookie("AccessToken")
-    userID := util.UserSession[cookie.Value]
-
-    // Get current user's username
-    var currentUsername string
-    err := sqlite.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&currentUsername)
-    if err != nil {
-        http.Error(w, "Error getting current user", http.StatusInternalServerError)
-        return
-    }
+    userID, _ := util.SessionUser(cookie.Value)
 
     rows, err := sqlite.DB.Query(`
         SELECT 
@@ -223,13 +265,18 @@ func GetPosts(w http.ResponseWriter, r *http.Request) {
             u.avatar as author_avatar,
             (SELECT COUNT(*) FROM likes WHERE post_id = p.id AND is_like = true) as like_count,
             EXISTS(SELECT 1 FROM likes WHERE post_id = p.id AND user_id = ? AND is_like = true) as user_liked,
-            cf.close_friends,
+            EXISTS(SELECT 1 FROM close_friends WHERE user_id = p.author AND friend_id = ?) as is_close_friend,
             p.group_id
         FROM posts p
         JOIN users u ON p.author = u.id
-        LEFT JOIN post_PrivateViews cf ON p.author = cf.user_id
+        WHERE `+notBlockedClause("p.author", "?")+`
+        AND NOT EXISTS (
+            SELECT 1 FROM mutes mu
+            WHERE mu.user_id = ? AND mu.target_type = 'user' AND mu.target_id = p.author
+            AND (mu.expires_at IS NULL OR julianday(mu.expires_at) > julianday('now'))
+        )
         ORDER BY p.created_at DESC
-    `, userID)
+    `, userID, userID, userID, userID, userID)
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
@@ -250,7 +297,7 @@ func GetPosts(w http.ResponseWriter, r *http.Request) {
             GroupID       sql.NullInt64
             Username      string
             Avatar        sql.NullString
-            CloseFriends  sql.NullString
+            IsCloseFriend bool
             LikeCount     int
             UserLiked     sql.NullBool
         }
@@ -258,7 +305,7 @@ func GetPosts(w http.ResponseWriter, r *http.Request) {
         if err := rows.Scan(
             &post.ID, &post.Title, &post.Content, &post.Media, &post.MediaType,
             &post.Privacy, &post.Author, &post.CreatedAt, &post.Username, &post.Avatar,
-            &post.LikeCount, &post.UserLiked, &post.CloseFriends, &post.GroupID,
+            &post.LikeCount, &post.UserLiked, &post.IsCloseFriend, &post.GroupID,
         ); err != nil {
             http.Error(w, "Error reading posts", http.StatusInternalServerError)
             log.Printf("Error scanning posts: %v", err)
@@ -266,22 +313,8 @@ func GetPosts(w http.ResponseWriter, r *http.Request) {
         }
 
         // Check privacy settings
-        if post.Privacy == 3 && post.Author != int64(userID) {
-            if post.CloseFriends.Valid {
-                closeFriends := strings.Split(post.CloseFriends.String, ",")
-                found := false
-                for _, friend := range closeFriends {
-                    if strings.TrimSpace(friend) == currentUsername {
-                        found = true
-                        break
-                    }
-                }
-                if !found {
-                    continue 
-                }
-            } else {
-                continue
-            }
+        if post.Privacy == 3 && post.Author != int64(userID) && !post.IsCloseFriend {
+            continue
         }
 
         response := m.PostResponse{
@@ -347,6 +380,21 @@ func GetUserPosts(w http.ResponseWriter, r *http.Request) {
             http.Error(w, "Invalid user ID", http.StatusBadRequest)
             return
         }
+
+        // Blocked users don't see each other's posts
+        viewerID, err := util.GetUserID(r, w)
+        if err != nil {
+            return
+        }
+        blocked, err := isBlocked(int64(viewerID), targetUserID)
+        if err != nil {
+            http.Error(w, "Database error", http.StatusInternalServerError)
+            return
+        }
+        if blocked {
+            http.Error(w, "User not found", http.StatusNotFound)
+            return
+        }
     }
 
     // Query to get posts based on privacy settings
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/util"
+)
+
+const (
+	maxNameLength    = 50
+	maxAboutMeLength = 500
+
+	// minimumAge is the youngest a user can be, in years
+	minimumAge = 13
+
+	// maxAvatarSize is the largest decoded avatar image, in bytes
+	maxAvatarSize = 2 << 20
+
+	// maxProfileBodySize leaves room for a base64 encoded avatar
+	maxProfileBodySize = 4 << 20
+)
+
+// avatarTypes are the image types accepted as avatars
+var avatarTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// UpdateProfile changes the caller's profile. Only the fields present in the
+// body are updated. The avatar is a base64 data URL, like the one sent when
+// registering. The response holds every editable field after the update.
+func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	var update m.EditableProfile
+	r.Body = http.MaxBytesReader(w, r.Body, maxProfileBodySize)
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	v := util.Validator{}
+	validateProfile(&update, &v)
+	if !v.Valid() {
+		v.Write(w, http.StatusBadRequest)
+		return
+	}
+
+	var columns []string
+	var args []interface{}
+	set := func(column string, value *string) {
+		if value != nil {
+			columns = append(columns, column+" = ?")
+			args = append(args, *value)
+		}
+	}
+	set("first_name", update.FirstName)
+	set("last_name", update.LastName)
+	set("about_me", update.AboutMe)
+	if update.DateOfBirth != nil {
+		// Stored as a time, the way registration does
+		dateOfBirth, _ := time.Parse("2006-01-02", *update.DateOfBirth)
+		columns = append(columns, "date_of_birth = ?")
+		args = append(args, dateOfBirth)
+	}
+	if update.Avatar != nil && *update.Avatar == "" {
+		columns = append(columns, "avatar = NULL")
+	} else {
+		set("avatar", update.Avatar)
+	}
+	set("email_visibility", update.EmailVisibility)
+	set("birthday_visibility", update.BirthdayVisibility)
+	set("about_me_visibility", update.AboutMeVisibility)
+
+	if len(columns) > 0 {
+		_, err := sqlite.DB.Exec(
+			"UPDATE users SET "+strings.Join(columns, ", ")+" WHERE id = ?",
+			append(args, userID)...,
+		)
+		if err != nil {
+			log.Printf("Error updating profile of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	profile, err := editableProfile(userID)
+	if err != nil {
+		log.Printf("Error reading profile of user %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// validateProfile checks the fields of a profile update, normalizing them,
+// and records the problems in v
+func validateProfile(p *m.EditableProfile, v *util.Validator) {
+	for _, name := range []struct {
+		field string
+		value *string
+	}{{"first_name", p.FirstName}, {"last_name", p.LastName}} {
+		if name.value == nil {
+			continue
+		}
+		*name.value = strings.TrimSpace(*name.value)
+		v.Length(name.field, *name.value, 1, maxNameLength)
+	}
+
+	if p.AboutMe != nil {
+		*p.AboutMe = strings.TrimSpace(*p.AboutMe)
+		v.Length("about_me", *p.AboutMe, 0, maxAboutMeLength)
+	}
+
+	if p.DateOfBirth != nil {
+		v.MinAge("date_of_birth", v.Date("date_of_birth", *p.DateOfBirth), minimumAge)
+	}
+
+	if p.Avatar != nil && *p.Avatar != "" {
+		validateAvatar(v, "avatar", *p.Avatar)
+	}
+
+	for _, visibility := range []struct {
+		field string
+		value *string
+	}{
+		{"email_visibility", p.EmailVisibility},
+		{"birthday_visibility", p.BirthdayVisibility},
+		{"about_me_visibility", p.AboutMeVisibility},
+	} {
+		if visibility.value != nil {
+			v.OneOf(visibility.field, *visibility.value, m.VisibilityPublic, m.VisibilityFollowers, m.VisibilityOnlyMe)
+		}
+	}
+}
+
+// validateAvatar checks that avatar is a base64 data URL of a supported image
+// no larger than maxAvatarSize
+func validateAvatar(v *util.Validator, field, avatar string) {
+	header, data, found := strings.Cut(avatar, ",")
+	mediaType, isBase64 := strings.CutSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+	if !found || !strings.HasPrefix(header, "data:") || !isBase64 || !avatarTypes[mediaType] {
+		v.Add(field, "must be a JPEG, PNG, GIF or WebP image")
+		return
+	}
+
+	tooLarge := fmt.Sprintf("can't be larger than %d MB", maxAvatarSize>>20)
+	if base64.StdEncoding.DecodedLen(len(data)) > maxAvatarSize+2 {
+		v.Add(field, tooLarge)
+		return
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		v.Add(field, "must be base64 encoded")
+		return
+	}
+	v.Check(len(decoded) <= maxAvatarSize, field, tooLarge)
+}
+
+// editableProfile reads the fields of userID's profile that can be edited
+func editableProfile(userID uint64) (*m.EditableProfile, error) {
+	var firstName, lastName, aboutMe, avatar, emailVisibility, birthdayVisibility, aboutMeVisibility string
+	var dateOfBirth time.Time
+	err := sqlite.DB.QueryRow(`
+		SELECT first_name, last_name, COALESCE(about_me, ''), date_of_birth, COALESCE(avatar, ''),
+			email_visibility, birthday_visibility, about_me_visibility
+		FROM users WHERE id = ?`,
+		userID,
+	).Scan(&firstName, &lastName, &aboutMe, &dateOfBirth, &avatar, &emailVisibility, &birthdayVisibility, &aboutMeVisibility)
+	if err != nil {
+		return nil, err
+	}
+
+	birthday := dateOfBirth.Format("2006-01-02")
+	return &m.EditableProfile{
+		FirstName:          &firstName,
+		LastName:           &lastName,
+		AboutMe:            &aboutMe,
+		DateOfBirth:        &birthday,
+		Avatar:             &avatar,
+		EmailVisibility:    &emailVisibility,
+		BirthdayVisibility: &birthdayVisibility,
+		AboutMeVisibility:  &aboutMeVisibility,
+	}, nil
+}
+
+// fieldVisible reports whether someone other than the owner can see a profile
+// field with the given visibility. following tells whether they are an
+// accepted follower of the owner.
+func fieldVisible(visibility string, following bool) bool {
+	return visibility == m.VisibilityPublic || (visibility == m.VisibilityFollowers && following)
+}
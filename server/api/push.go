@@ -0,0 +1,314 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/notifications"
+	"social-network/pkg/webpush"
+	"social-network/util"
+)
+
+// pushSender is nil until InitWebPush succeeds, which disables Web Push
+var pushSender *webpush.Sender
+
+// webPushTypes are the notification types worth interrupting someone for
+// when they are away. Likes and new group posts only show up in the app.
+var webPushTypes = map[string]bool{
+	m.NotificationTypeFollow:       true,
+	m.NotificationTypeAccept:       true,
+	m.NotificationEvent:            true,
+	m.NotificationGroupInvite:      true,
+	m.NotificationGroupRequest:     true,
+	m.NotificationGroupAccept:      true,
+	m.NotificationMention:          true,
+	m.NotificationChatMention:      true,
+	m.NotificationPostComment:      true,
+	m.NotificationGroupPostComment: true,
+}
+
+// pushServiceHosts are the domains of the browsers' push services. The
+// server only posts to endpoints under them, so a subscription can't point it
+// at internal addresses.
+var pushServiceHosts = []string{
+	"fcm.googleapis.com",
+	"android.googleapis.com",
+	"push.services.mozilla.com",
+	"push.apple.com",
+	"notify.windows.com",
+}
+
+// pushPayload is the JSON the service worker receives
+type pushPayload struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url"`
+}
+
+// InitWebPush loads the server's VAPID keys, from VAPID_PRIVATE_KEY or the
+// database, generating and storing a new pair on first start. client sends
+// the push requests; nil means http.DefaultClient.
+func InitWebPush(client *http.Client) error {
+	var keys *webpush.Keys
+	privateKey := os.Getenv("VAPID_PRIVATE_KEY")
+	if privateKey == "" {
+		err := sqlite.DB.QueryRow("SELECT private_key FROM vapid_keys WHERE id = 1").Scan(&privateKey)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	var err error
+	if privateKey != "" {
+		keys, err = webpush.ParseKeys(privateKey)
+	} else {
+		keys, err = webpush.GenerateKeys()
+		if err == nil {
+			_, err = sqlite.DB.Exec("INSERT INTO vapid_keys (id, private_key) VALUES (1, ?)", keys.PrivateKey())
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		subject = "mailto:admin@social-network.local"
+	}
+
+	pushSender = &webpush.Sender{Keys: keys, Subject: subject, Client: client}
+	notifications.SetWebPusher(webPushNotification)
+	return nil
+}
+
+// GetPushPublicKey returns the VAPID public key browsers subscribe with
+func GetPushPublicKey(w http.ResponseWriter, r *http.Request) {
+	if pushSender == nil {
+		http.Error(w, "Web Push is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"public_key": pushSender.Keys.PublicKey()})
+}
+
+// CreatePushSubscription stores a browser's push subscription for the
+// caller. Subscribing the same endpoint again updates its keys.
+func CreatePushSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	var sub webpush.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+	if err := validateSubscription(sub); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = sqlite.DB.Exec(`
+		INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (endpoint) DO UPDATE SET
+			user_id = excluded.user_id,
+			p256dh = excluded.p256dh,
+			auth = excluded.auth`,
+		userID, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth,
+	)
+	if err != nil {
+		log.Printf("Error saving push subscription: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// DeletePushSubscription removes one of the caller's push subscriptions,
+// identified by its endpoint
+func DeletePushSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	var sub webpush.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil || sub.Endpoint == "" {
+		http.Error(w, "Missing endpoint", http.StatusBadRequest)
+		return
+	}
+
+	result, err := sqlite.DB.Exec(
+		"DELETE FROM push_subscriptions WHERE endpoint = ? AND user_id = ?",
+		sub.Endpoint, userID,
+	)
+	if err != nil {
+		log.Printf("Error deleting push subscription: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateSubscription checks a subscription can be pushed to. Endpoints must
+// be https URLs of a known push service, unless WEBPUSH_ALLOW_HTTP is set for
+// a local stand-in service.
+func validateSubscription(sub webpush.Subscription) error {
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return fmt.Errorf("invalid endpoint")
+	}
+	if endpoint.Scheme != "https" && !(endpoint.Scheme == "http" && os.Getenv("WEBPUSH_ALLOW_HTTP") != "") {
+		return fmt.Errorf("endpoint must use https")
+	}
+	if !knownPushService(endpoint) {
+		return fmt.Errorf("endpoint is not a known push service")
+	}
+	if _, err := webpush.Encrypt(sub, nil); err != nil {
+		return fmt.Errorf("invalid subscription keys")
+	}
+	return nil
+}
+
+// knownPushService reports whether endpoint belongs to one of
+// pushServiceHosts. Any host is allowed when WEBPUSH_ALLOW_HTTP is set.
+func knownPushService(endpoint *url.URL) bool {
+	if os.Getenv("WEBPUSH_ALLOW_HTTP") != "" {
+		return true
+	}
+	if endpoint.Scheme != "https" || (endpoint.Port() != "" && endpoint.Port() != "443") {
+		return false
+	}
+	host := strings.ToLower(endpoint.Hostname())
+	for _, known := range pushServiceHosts {
+		if host == known || strings.HasSuffix(host, "."+known) {
+			return true
+		}
+	}
+	return false
+}
+
+// isConnected reports whether a user has any realtime connection open
+func isConnected(userID int) bool {
+	clientsMu.Lock()
+	for client := range clients {
+		if client.UserID == userID {
+			clientsMu.Unlock()
+			return true
+		}
+	}
+	clientsMu.Unlock()
+
+	socketManager.Mu.Lock()
+	_, online := socketManager.Sockets[uint64(userID)]
+	socketManager.Mu.Unlock()
+	if online {
+		return true
+	}
+
+	chatSocketManager.Mu.Lock()
+	_, online = chatSocketManager.Sockets[uint64(userID)]
+	chatSocketManager.Mu.Unlock()
+	return online || eventStreams.online(userID)
+}
+
+// webPushNotification sends a notification to the recipient's browsers when
+// they have no connection open and its type is in webPushTypes
+func webPushNotification(n m.Notification) {
+	if !webPushTypes[n.Type] {
+		return
+	}
+	go webPushToUser(n.ToUserID, pushPayload{
+		Type:  n.Type,
+		Title: "Social Network",
+		Body:  n.Content,
+		URL:   "/notifications",
+	})
+}
+
+// webPushMessage sends a direct message to the recipient's browsers when they
+// are away and haven't muted the conversation or the sender
+func webPushMessage(senderID uint64, recipientID int64, content string) {
+	for _, targetType := range []string{m.MuteTargetConversation, m.MuteTargetUser} {
+		muted, err := notifications.MutedTarget(sqlite.DB, int(recipientID), targetType, int(senderID))
+		if err != nil || muted {
+			return
+		}
+	}
+
+	var senderName string
+	if err := sqlite.DB.QueryRow("SELECT username FROM users WHERE id = ?", senderID).Scan(&senderName); err != nil {
+		return
+	}
+
+	if preview := []rune(content); len(preview) > 200 {
+		content = string(preview[:200]) + "…"
+	}
+	go webPushToUser(int(recipientID), pushPayload{
+		Type:  MessageTypeChat,
+		Title: senderName,
+		Body:  content,
+		URL:   fmt.Sprintf("/chat?user=%d", senderID),
+	})
+}
+
+// webPushToUser sends payload to every push subscription of a user who is not
+// connected, deleting subscriptions the push service reports as expired
+func webPushToUser(userID int, payload pushPayload) {
+	if pushSender == nil || isConnected(userID) {
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	rows, err := sqlite.DB.Query("SELECT id, endpoint, p256dh, auth FROM push_subscriptions WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("Error fetching push subscriptions of user %d: %v", userID, err)
+		return
+	}
+	subscriptions := make(map[int]webpush.Subscription)
+	for rows.Next() {
+		var id int
+		var sub webpush.Subscription
+		if err := rows.Scan(&id, &sub.Endpoint, &sub.Keys.P256dh, &sub.Keys.Auth); err == nil {
+			subscriptions[id] = sub
+		}
+	}
+	rows.Close()
+
+	for id, sub := range subscriptions {
+		// Subscriptions stored before the endpoint check are skipped
+		if endpoint, err := url.Parse(sub.Endpoint); err != nil || !knownPushService(endpoint) {
+			continue
+		}
+		err := pushSender.Send(sub, body)
+		if err == webpush.ErrGone {
+			sqlite.DB.Exec("DELETE FROM push_subscriptions WHERE id = ?", id)
+			continue
+		}
+		if err != nil {
+			log.Printf("Error sending web push to user %d: %v", userID, err)
+		}
+	}
+}
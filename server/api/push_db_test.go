@@ -0,0 +1,104 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+	"social-network/pkg/webpush"
+)
+
+func TestWebPushPrunesExpiredSubscriptions(t *testing.T) {
+	sqlitetest.Open(t)
+	t.Setenv("WEBPUSH_ALLOW_HTTP", "1")
+
+	var mu sync.Mutex
+	delivered := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		delivered[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	keys, err := webpush.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := pushSender
+	pushSender = &webpush.Sender{Keys: keys, Subject: "mailto:admin@example.com", Client: server.Client()}
+	defer func() { pushSender = previous }()
+
+	const userID = 3
+	for _, path := range []string{"/gone", "/active"} {
+		sub := testSubscription(t, server.URL+path)
+		_, err := sqlite.DB.Exec(
+			"INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth) VALUES (?, ?, ?, ?)",
+			userID, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	webPushToUser(userID, pushPayload{Type: "follow_request", Title: "Social Network", Body: "hi", URL: "/notifications"})
+
+	if delivered["/gone"] != 1 || delivered["/active"] != 1 {
+		t.Errorf("deliveries = %v, want one to each endpoint", delivered)
+	}
+
+	rows, err := sqlite.DB.Query("SELECT endpoint FROM push_subscriptions WHERE user_id = ?", userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var left []string
+	for rows.Next() {
+		var endpoint string
+		rows.Scan(&endpoint)
+		left = append(left, endpoint)
+	}
+	if len(left) != 1 || left[0] != server.URL+"/active" {
+		t.Errorf("subscriptions left = %v, want only %s/active", left, server.URL)
+	}
+}
+
+func TestWebPushSkipsUnknownHostsStoredEarlier(t *testing.T) {
+	sqlitetest.Open(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	keys, _ := webpush.GenerateKeys()
+	previous := pushSender
+	pushSender = &webpush.Sender{Keys: keys, Subject: "mailto:admin@example.com", Client: server.Client()}
+	defer func() { pushSender = previous }()
+
+	sub := testSubscription(t, server.URL+"/internal")
+	_, err := sqlite.DB.Exec(
+		"INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth) VALUES (3, ?, ?, ?)",
+		sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webPushToUser(3, pushPayload{Type: "follow_request", Body: "hi"})
+	if requests != 0 {
+		t.Errorf("server got %d requests for an endpoint that isn't a push service", requests)
+	}
+}
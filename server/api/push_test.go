@@ -0,0 +1,79 @@
+package api
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"social-network/pkg/webpush"
+)
+
+// testSubscription is a subscription with valid browser keys
+func testSubscription(t *testing.T, endpoint string) webpush.Subscription {
+	t.Helper()
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+
+	var sub webpush.Subscription
+	sub.Endpoint = endpoint
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(private.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(auth)
+	return sub
+}
+
+func TestValidateSubscriptionEndpoints(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		valid    bool
+	}{
+		{"https://fcm.googleapis.com/fcm/send/abc", true},
+		{"https://updates.push.services.mozilla.com/wpush/v2/abc", true},
+		{"https://web.push.apple.com/abc", true},
+		{"https://db5p.notify.windows.com/w/?token=abc", true},
+		{"https://FCM.googleapis.com/fcm/send/abc", true},
+		{"https://fcm.googleapis.com:443/fcm/send/abc", true},
+
+		{"http://fcm.googleapis.com/fcm/send/abc", false},
+		{"https://fcm.googleapis.com:8443/fcm/send/abc", false},
+		{"https://127.0.0.1/abc", false},
+		{"https://localhost/abc", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://10.0.0.5/abc", false},
+		{"https://internal.example.com/abc", false},
+		{"https://evilfcm.googleapis.com.attacker.net/abc", false},
+		{"https://notfcm.googleapis.com.evil/abc", false},
+		{"https://xnotify.windows.com/abc", false},
+		{"not a url", false},
+	}
+	for _, tt := range tests {
+		err := validateSubscription(testSubscription(t, tt.endpoint))
+		if (err == nil) != tt.valid {
+			t.Errorf("validateSubscription(%q) = %v, want valid %v", tt.endpoint, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateSubscriptionAllowsStandInWithAllowHTTP(t *testing.T) {
+	t.Setenv("WEBPUSH_ALLOW_HTTP", "1")
+	for _, endpoint := range []string{"http://127.0.0.1:9000/push", "https://localhost/push"} {
+		if err := validateSubscription(testSubscription(t, endpoint)); err != nil {
+			t.Errorf("validateSubscription(%q) = %v, want a stand-in to be allowed", endpoint, err)
+		}
+	}
+	if err := validateSubscription(testSubscription(t, "ftp://127.0.0.1/push")); err == nil {
+		t.Error("ftp endpoint was accepted")
+	}
+}
+
+func TestValidateSubscriptionKeys(t *testing.T) {
+	sub := testSubscription(t, "https://fcm.googleapis.com/fcm/send/abc")
+	sub.Keys.Auth = ""
+	if err := validateSubscription(sub); err == nil {
+		t.Error("subscription without an auth secret was accepted")
+	}
+}
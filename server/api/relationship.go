@@ -0,0 +1,219 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/util"
+)
+
+const (
+	// relationshipSampleSize is how many mutual followers and shared groups
+	// a profile shows
+	relationshipSampleSize = 3
+
+	defaultMutualsPageSize = 20
+	maxMutualsPageSize     = 50
+)
+
+// mutualFollowersFrom selects the users :viewer follows who follow :target,
+// aliased u, leaving out anyone blocked. It is served by the followers
+// indexes on (follower_id, followed_id, status) and (followed_id, status).
+var mutualFollowersFrom = `
+	FROM followers mine
+	JOIN followers mf ON mf.follower_id = mine.followed_id
+	JOIN users u ON u.id = mf.follower_id
+	WHERE mine.follower_id = :viewer AND mine.status = 'accept'
+	AND mf.followed_id = :target AND mf.status = 'accept'
+	AND ` + notBlockedClause("u.id", ":viewer")
+
+// sharedGroupsFrom selects the groups :viewer and :target are both members
+// of, aliased g
+const sharedGroupsFrom = `
+	FROM group_members mine
+	JOIN group_members theirs ON theirs.group_id = mine.group_id
+	JOIN groups g ON g.id = mine.group_id
+	WHERE mine.user_id = :viewer AND mine.status IN ('member', 'creator')
+	AND theirs.user_id = :target AND theirs.status IN ('member', 'creator')`
+
+// followsVisible reports whether viewerID may see whom targetID follows and
+// who follows them: anyone can for public accounts, only accepted followers
+// for private ones. It returns sql.ErrNoRows when targetID doesn't exist.
+func followsVisible(viewerID, targetID int64) (bool, error) {
+	var visible bool
+	err := sqlite.DB.QueryRow(`
+		SELECT id = :viewer OR NOT COALESCE(is_private, 0) OR EXISTS (
+			SELECT 1 FROM followers
+			WHERE follower_id = :viewer AND followed_id = :target AND status = 'accept'
+		)
+		FROM users WHERE id = :target`,
+		sql.Named("viewer", viewerID), sql.Named("target", targetID),
+	).Scan(&visible)
+	return visible, err
+}
+
+// relationshipWith describes how viewerID is connected to targetID. Mutual
+// followers are left out when the followers of targetID are private to
+// viewerID.
+func relationshipWith(viewerID, targetID int64) (*m.Relationship, error) {
+	args := []interface{}{sql.Named("viewer", viewerID), sql.Named("target", targetID)}
+	rel := &m.Relationship{MutualFollowers: []m.MutualUser{}}
+
+	err := sqlite.DB.QueryRow(`
+		SELECT
+			EXISTS (
+				SELECT 1 FROM followers
+				WHERE follower_id = :target AND followed_id = :viewer AND status = 'accept'
+			),
+			EXISTS (
+				SELECT 1 FROM close_friends
+				WHERE user_id = :viewer AND friend_id = :target
+			),
+			(SELECT COUNT(DISTINCT g.id) `+sharedGroupsFrom+`)`,
+		args...,
+	).Scan(&rel.FollowsYou, &rel.IsCloseFriend, &rel.SharedGroupCount)
+	if err != nil {
+		return nil, err
+	}
+
+	visible, err := followsVisible(viewerID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if visible {
+		err = sqlite.DB.QueryRow("SELECT COUNT(*) "+mutualFollowersFrom, args...).Scan(&rel.MutualFollowerCount)
+		if err != nil {
+			return nil, err
+		}
+		rel.MutualFollowers, err = mutualFollowers(viewerID, targetID, relationshipSampleSize, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := sqlite.DB.Query(`
+		SELECT DISTINCT g.id, g.title `+sharedGroupsFrom+`
+		ORDER BY g.title
+		LIMIT :limit`,
+		append(args, sql.Named("limit", relationshipSampleSize))...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rel.SharedGroups = []m.SharedGroup{}
+	for rows.Next() {
+		var group m.SharedGroup
+		if err := rows.Scan(&group.ID, &group.Title); err != nil {
+			return nil, err
+		}
+		rel.SharedGroups = append(rel.SharedGroups, group)
+	}
+	return rel, rows.Err()
+}
+
+// mutualFollowers returns a page of the users viewerID follows who follow
+// targetID, by username
+func mutualFollowers(viewerID, targetID int64, limit, offset int) ([]m.MutualUser, error) {
+	rows, err := sqlite.DB.Query(`
+		SELECT u.id, u.username, COALESCE(u.avatar, '') `+mutualFollowersFrom+`
+		ORDER BY u.username, u.id
+		LIMIT :limit OFFSET :offset`,
+		sql.Named("viewer", viewerID),
+		sql.Named("target", targetID),
+		sql.Named("limit", limit),
+		sql.Named("offset", offset),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []m.MutualUser{}
+	for rows.Next() {
+		var user m.MutualUser
+		if err := rows.Scan(&user.ID, &user.Username, &user.Avatar); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetMutuals lists the users the caller follows who also follow {id}. The
+// followers of a private account are only listed for its followers.
+func GetMutuals(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	targetID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := util.PageSize(r, defaultMutualsPageSize, maxMutualsPageSize)
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	visible, err := followsVisible(int64(userID), targetID)
+	exists := err != sql.ErrNoRows
+	if err != nil && exists {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	blocked, err := isBlocked(int64(userID), targetID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !exists || blocked {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if !visible {
+		http.Error(w, "This account is private", http.StatusForbidden)
+		return
+	}
+
+	var mutuals m.Mutuals
+	err = sqlite.DB.QueryRow(`
+		SELECT COUNT(*) `+mutualFollowersFrom,
+		sql.Named("viewer", userID),
+		sql.Named("target", targetID),
+	).Scan(&mutuals.Count)
+	if err != nil {
+		log.Printf("Error counting mutual followers: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	mutuals.Users, err = mutualFollowers(int64(userID), targetID, limit, offset)
+	if err != nil {
+		log.Printf("Error fetching mutual followers: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mutuals)
+}
@@ -0,0 +1,109 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+	"social-network/util"
+)
+
+func newTestUser(t *testing.T, username string, private bool) int64 {
+	t.Helper()
+	result, err := sqlite.DB.Exec(`
+		INSERT INTO users (email, password, username, first_name, last_name, date_of_birth, is_private)
+		VALUES (?, 'x', ?, 'Test', 'User', '1990-01-01', ?)`,
+		username+"@example.com", username, private,
+	)
+	if err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+func addFollow(t *testing.T, followerID, followedID int64) {
+	t.Helper()
+	_, err := sqlite.DB.Exec(
+		"INSERT INTO followers (follower_id, followed_id, status) VALUES (?, ?, 'accept')",
+		followerID, followedID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getAs runs handler for a GET of target as userID
+func getAs(userID int64, handler http.HandlerFunc, target string, pathValues map[string]string) *httptest.ResponseRecorder {
+	login := httptest.NewRecorder()
+	util.StartSession(login, uint(userID))
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.AddCookie(login.Result().Cookies()[0])
+	for name, value := range pathValues {
+		req.SetPathValue(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestMutualsOfPrivateAccounts(t *testing.T) {
+	sqlitetest.Open(t)
+	viewer := newTestUser(t, "viewer_test", false)
+	friend := newTestUser(t, "friend_test", false)
+	private := newTestUser(t, "private_test", true)
+	public := newTestUser(t, "public_test", false)
+
+	// friend follows both accounts, and the viewer follows friend
+	addFollow(t, viewer, friend)
+	addFollow(t, friend, private)
+	addFollow(t, friend, public)
+
+	mutuals := func(targetID int64) (int, m.Mutuals) {
+		rec := getAs(viewer, GetMutuals, fmt.Sprintf("/users/%d/mutuals", targetID),
+			map[string]string{"id": fmt.Sprint(targetID)})
+		var body m.Mutuals
+		if rec.Code == http.StatusOK {
+			json.NewDecoder(rec.Body).Decode(&body)
+		}
+		return rec.Code, body
+	}
+
+	if code, body := mutuals(public); code != http.StatusOK || body.Count != 1 {
+		t.Errorf("mutuals of a public account = %d %+v, want 200 with friend", code, body)
+	}
+	if code, _ := mutuals(private); code != http.StatusForbidden {
+		t.Errorf("mutuals of a private account the viewer doesn't follow = %d, want 403", code)
+	}
+	rel, err := relationshipWith(viewer, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.MutualFollowerCount != 0 || len(rel.MutualFollowers) != 0 {
+		t.Errorf("relationship with a private account lists %d mutual followers (%v), want none", rel.MutualFollowerCount, rel.MutualFollowers)
+	}
+
+	addFollow(t, viewer, private)
+	if code, body := mutuals(private); code != http.StatusOK || body.Count != 1 {
+		t.Errorf("mutuals of a followed private account = %d %+v, want 200 with friend", code, body)
+	}
+	rel, err = relationshipWith(viewer, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.MutualFollowerCount != 1 || len(rel.MutualFollowers) != 1 || rel.MutualFollowers[0].ID != friend {
+		t.Errorf("relationship with a followed private account = %+v, want friend as mutual follower", rel)
+	}
+
+	if code, _ := mutuals(9999); code != http.StatusNotFound {
+		t.Errorf("mutuals of a missing user = %d, want 404", code)
+	}
+}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/util"
+)
+
+const (
+	defaultSearchPageSize = 10
+	maxSearchPageSize     = 50
+)
+
+// Search runs a ranked full-text search over users, posts, group posts, groups
+// and the caller's own direct messages. `type` narrows the search to a single
+// kind of result; without it every kind is searched and returned side by side.
+// Posts are filtered with the same rules that decide who can view them, and
+// group posts are only returned to members of their group. Users are only
+// found by their about_me when the caller may read it.
+func Search(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	match := util.FTSQuery(r.URL.Query().Get("q"))
+	if match == "" {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+
+	searchType := r.URL.Query().Get("type")
+	if searchType == "" {
+		searchType = m.SearchTypeAll
+	}
+	switch searchType {
+	case m.SearchTypeAll, m.SearchTypeUsers, m.SearchTypePosts, m.SearchTypeGroups, m.SearchTypeMessages:
+	default:
+		http.Error(w, "Invalid search type", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := util.PageSize(r, defaultSearchPageSize, maxSearchPageSize)
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	args := []interface{}{
+		sql.Named("viewer", userID),
+		sql.Named("match", match),
+		sql.Named("limit", limit),
+		sql.Named("offset", offset),
+	}
+
+	response := make(map[string]interface{})
+	wants := func(kind string) bool {
+		return searchType == m.SearchTypeAll || searchType == kind
+	}
+
+	if wants(m.SearchTypeUsers) {
+		users, err := searchUsers(args, match)
+		if err != nil {
+			log.Printf("Error searching users: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		response["users"] = users
+	}
+
+	if wants(m.SearchTypePosts) {
+		posts, err := searchPosts(args)
+		if err != nil {
+			log.Printf("Error searching posts: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		response["posts"] = posts
+
+		groupPosts, err := searchGroupPosts(args)
+		if err != nil {
+			log.Printf("Error searching group posts: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		response["group_posts"] = groupPosts
+	}
+
+	if wants(m.SearchTypeGroups) {
+		groups, err := searchGroups(args)
+		if err != nil {
+			log.Printf("Error searching groups: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		response["groups"] = groups
+	}
+
+	if wants(m.SearchTypeMessages) {
+		messages, err := searchMessages(args)
+		if err != nil {
+			log.Printf("Error searching messages: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		response["messages"] = messages
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// aboutMeVisible is true when :viewer may read the about_me of user u
+const aboutMeVisible = `(u.about_me_visibility = 'public' OR (u.about_me_visibility = 'followers' AND EXISTS (
+	SELECT 1 FROM followers vf
+	WHERE vf.follower_id = :viewer AND vf.followed_id = u.id AND vf.status = 'accept'
+)))`
+
+// searchUsers matches the query against names and usernames, and against
+// about_me only for users whose about_me the viewer may read, so searching
+// can't reveal what a hidden about_me says
+func searchUsers(args []interface{}, match string) ([]m.UserSearchResult, error) {
+	args = append([]interface{}{
+		sql.Named("name_match", util.FTSColumns(match, "username", "first_name", "last_name")),
+	}, args...)
+
+	rows, err := sqlite.DB.Query(`
+		SELECT u.id, u.username, u.first_name, u.last_name,
+			CASE WHEN `+aboutMeVisible+` THEN u.about_me END,
+			u.avatar, u.is_private
+		FROM (
+			SELECT rowid AS id, bm25(users_fts, 10.0, 5.0, 5.0, 1.0) AS rank, true AS about_me_matched
+			FROM users_fts WHERE users_fts MATCH :match
+			UNION ALL
+			SELECT rowid, bm25(users_fts, 10.0, 5.0, 5.0, 0.0), false
+			FROM users_fts WHERE users_fts MATCH :name_match
+		) found
+		JOIN users u ON u.id = found.id
+		WHERE u.id != :viewer
+		AND (NOT found.about_me_matched OR `+aboutMeVisible+`)
+		AND `+notBlockedClause("u.id", ":viewer")+`
+		GROUP BY u.id
+		ORDER BY MIN(found.rank)
+		LIMIT :limit OFFSET :offset
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []m.UserSearchResult{}
+	for rows.Next() {
+		var user m.UserSearchResult
+		var aboutMe, avatar sql.NullString
+		if err := rows.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &aboutMe, &avatar, &user.IsPrivate); err != nil {
+			return nil, err
+		}
+		user.AboutMe = aboutMe.String
+		user.Avatar = avatar.String
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func searchPosts(args []interface{}) ([]m.PostSearchResult, error) {
+	rows, err := sqlite.DB.Query(`
+		SELECT p.id, p.title, p.content, p.privacy, p.author, u.username, p.created_at
+		FROM posts_fts
+		JOIN posts p ON p.id = posts_fts.rowid
+		JOIN users u ON u.id = p.author
+		WHERE posts_fts MATCH :match AND `+visiblePostsClause+`
+		ORDER BY bm25(posts_fts, 5.0, 1.0)
+		LIMIT :limit OFFSET :offset
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []m.PostSearchResult{}
+	for rows.Next() {
+		var post m.PostSearchResult
+		if err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.Privacy, &post.Author, &post.AuthorName, &post.CreatedAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func searchGroupPosts(args []interface{}) ([]m.PostSearchResult, error) {
+	rows, err := sqlite.DB.Query(`
+		SELECT gp.id, gp.title, gp.content, gp.author, u.username, gp.group_id, gp.created_at
+		FROM group_posts_fts
+		JOIN group_posts gp ON gp.id = group_posts_fts.rowid
+		JOIN users u ON u.id = gp.author
+		WHERE group_posts_fts MATCH :match
+		AND EXISTS (
+			SELECT 1 FROM group_members gm
+			WHERE gm.group_id = gp.group_id AND gm.user_id = :viewer
+			AND gm.status IN ('member', 'creator')
+		)
+		AND `+notBlockedClause("gp.author", ":viewer")+`
+		ORDER BY bm25(group_posts_fts, 5.0, 1.0)
+		LIMIT :limit OFFSET :offset
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []m.PostSearchResult{}
+	for rows.Next() {
+		var post m.PostSearchResult
+		if err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.Author, &post.AuthorName, &post.GroupID, &post.CreatedAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func searchGroups(args []interface{}) ([]m.Group, error) {
+	rows, err := sqlite.DB.Query(`
+		SELECT g.id, g.title, g.description, g.creator_id, g.created_at
+		FROM groups_fts
+		JOIN groups g ON g.id = groups_fts.rowid
+		WHERE groups_fts MATCH :match
+		AND `+notBlockedClause("g.creator_id", ":viewer")+`
+		ORDER BY bm25(groups_fts, 5.0, 1.0)
+		LIMIT :limit OFFSET :offset
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []m.Group{}
+	for rows.Next() {
+		var group m.Group
+		if err := rows.Scan(&group.ID, &group.Title, &group.Description, &group.CreatorID, &group.CreatedAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+func searchMessages(args []interface{}) ([]m.MessageSearchResult, error) {
+	rows, err := sqlite.DB.Query(`
+		SELECT cm.id, cm.sender_id, cm.recipient_id, cm.content, cm.created_at
+		FROM chat_messages_fts
+		JOIN chat_messages cm ON cm.id = chat_messages_fts.rowid
+		WHERE chat_messages_fts MATCH :match
+		AND (cm.sender_id = :viewer OR cm.recipient_id = :viewer)
+		ORDER BY rank
+		LIMIT :limit OFFSET :offset
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []m.MessageSearchResult{}
+	for rows.Next() {
+		var message m.MessageSearchResult
+		if err := rows.Scan(&message.ID, &message.SenderID, &message.RecipientID, &message.Content, &message.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,110 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+)
+
+// search runs GET /search as userID and decodes the response
+func search(t *testing.T, userID int64, query, searchType string) map[string]json.RawMessage {
+	t.Helper()
+	target := "/search?" + url.Values{"q": {query}, "type": {searchType}}.Encode()
+	rec := getAs(userID, Search, target, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d %s", target, rec.Code, rec.Body)
+	}
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func searchUserIDs(t *testing.T, userID int64, query string) []int {
+	t.Helper()
+	var users []m.UserSearchResult
+	json.Unmarshal(search(t, userID, query, m.SearchTypeUsers)["users"], &users)
+	ids := make([]int, len(users))
+	for i, user := range users {
+		ids[i] = int(user.ID)
+	}
+	return ids
+}
+
+func setAboutMe(t *testing.T, userID int64, aboutMe, visibility string) {
+	t.Helper()
+	_, err := sqlite.DB.Exec("UPDATE users SET about_me = ?, about_me_visibility = ? WHERE id = ?", aboutMe, visibility, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchDoesNotMatchHiddenAboutMe(t *testing.T) {
+	sqlitetest.Open(t)
+	viewer := newTestUser(t, "viewer_test", false)
+	follower := newTestUser(t, "follower_test", false)
+	owner := newTestUser(t, "owner_test", false)
+	addFollow(t, follower, owner)
+
+	tests := []struct {
+		visibility                 string
+		viewerFinds, followerFinds bool
+	}{
+		{m.VisibilityPublic, true, true},
+		{m.VisibilityFollowers, false, true},
+		{m.VisibilityOnlyMe, false, false},
+	}
+	for _, tt := range tests {
+		setAboutMe(t, owner, "I secretly collect xylophones", tt.visibility)
+
+		for _, who := range []struct {
+			id    int64
+			finds bool
+		}{{viewer, tt.viewerFinds}, {follower, tt.followerFinds}} {
+			ids := searchUserIDs(t, who.id, "xylophones")
+			if found := len(ids) == 1 && ids[0] == int(owner); found != who.finds {
+				t.Errorf("%s about_me: user %d found owner = %v (results %v), want %v",
+					tt.visibility, who.id, found, ids, who.finds)
+			}
+		}
+
+		// Names are always searchable
+		if ids := searchUserIDs(t, viewer, "owner_test"); len(ids) != 1 || ids[0] != int(owner) {
+			t.Errorf("%s about_me: searching the username found %v, want the owner", tt.visibility, ids)
+		}
+	}
+}
+
+func TestSearchHidesGroupsOfBlockedCreators(t *testing.T) {
+	sqlitetest.Open(t)
+	viewer := newTestUser(t, "viewer_test", false)
+	creator := newTestUser(t, "creator_test", false)
+	_, err := sqlite.DB.Exec("INSERT INTO groups (title, description, creator_id) VALUES ('Zither club', 'Strings', ?)", creator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := func() []m.Group {
+		var groups []m.Group
+		json.Unmarshal(search(t, viewer, "zither", m.SearchTypeGroups)["groups"], &groups)
+		return groups
+	}
+	if got := groups(); len(got) != 1 {
+		t.Fatalf("found %d groups, want the zither club", len(got))
+	}
+
+	if _, err := sqlite.DB.Exec("INSERT INTO blocks (blocker_id, blocked_id) VALUES (?, ?)", creator, viewer); err != nil {
+		t.Fatal(err)
+	}
+	if got := groups(); len(got) != 0 {
+		t.Errorf("found %+v, want no groups of a user who blocked the viewer", got)
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"sync"
 
 	m "social-network/models"
 	"social-network/pkg/db/sqlite"
+	"social-network/pkg/notifications"
 	"social-network/util"
 	"github.com/gorilla/websocket"
 )
@@ -30,10 +32,15 @@ type Client struct {
 // Define a map to store clients
 var clients = make(map[*Client]bool)
 
+// clientsMu guards clients, which is also read from the goroutines sending
+// web pushes
+var clientsMu sync.Mutex
+
 // Message types
 const (
 	MessageTypeNotification = "notification"
 	MessageTypeUserStatus   = "user_status"
+	MessageTypeFollowUpdate = "follow_update"
 )
 
 // Create a global SocketManager instance
@@ -65,14 +72,18 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add client to both maps
+	clientsMu.Lock()
 	clients[client] = true
+	clientsMu.Unlock()
 	AddConnection(socketManager, uint64(userID), ws)
 
 	log.Printf("New WebSocket connection for user %d", userID)
 
 	go func() {
 		defer func() {
+			clientsMu.Lock()
 			delete(clients, client)
+			clientsMu.Unlock()
 			RemoveConnection(socketManager, uint64(userID))
 			ws.Close()
 		}()
@@ -106,7 +117,9 @@ func HandleMessages(userID uint64, msg []byte) {
 
 	switch message.Type {
 	case MessageTypeNotification:
-		handleNotification(userID, msg)
+		// Notifications are only created by the server, which checks blocks,
+		// mutes and preferences before storing them
+		log.Printf("Ignoring notification sent by user %d", userID)
 	case MessageTypeUserStatus:
 		// Handle user status updates
 		BroadcastUserStatus(socketManager, userID, true)
@@ -115,38 +128,29 @@ func HandleMessages(userID uint64, msg []byte) {
 	}
 }
 
-func handleNotification(userID uint64, msg []byte) {
-	var notification m.Notification
-	if err := json.Unmarshal(msg, &notification); err != nil {
-		log.Printf("Error unmarshaling notification: %v", err)
-		return
-	}
-
-	// Broadcast the notification
-	BroadcastNotification(notification)
-}
-
 func BroadcastNotification(notification m.Notification) {
-	message := struct {
-		Type string         `json:"type"`
-		Data m.Notification `json:"data"`
-	}{
+	SendToUser(notification.ToUserID, notifications.Frame{
 		Type: "notification",
 		Data: notification,
-	}
+	})
+}
 
-	messageJSON, err := json.Marshal(message)
+// SendToUser writes a frame to the notification sockets of a user. It is
+// registered as the realtime publisher of the notification service.
+func SendToUser(userID int, frame notifications.Frame) {
+	messageJSON, err := json.Marshal(frame)
 	if err != nil {
-		log.Printf("Error marshaling notification: %v", err)
+		log.Printf("Error marshaling %s frame: %v", frame.Type, err)
 		return
 	}
 
-	log.Printf("Broadcasting notification message: %s", string(messageJSON))
+	log.Printf("Sending %s message to user %d: %s", frame.Type, userID, string(messageJSON))
 
 	// Broadcast using both methods to ensure delivery
 	// Method 1: Using clients map
+	clientsMu.Lock()
 	for client := range clients {
-		if client.UserID == notification.ToUserID {
+		if client.UserID == userID {
 			err := client.Conn.WriteMessage(websocket.TextMessage, messageJSON)
 			if err != nil {
 				log.Printf("Error sending notification to client: %v", err)
@@ -155,15 +159,18 @@ func BroadcastNotification(notification m.Notification) {
 			}
 		}
 	}
+	clientsMu.Unlock()
 
 	// Method 2: Using socket manager
-	if conn, exists := socketManager.Sockets[uint64(notification.ToUserID)]; exists {
+	if conn, exists := socketManager.Sockets[uint64(userID)]; exists {
 		err := conn.WriteMessage(websocket.TextMessage, messageJSON)
 		if err != nil {
 			log.Printf("Error sending notification via socket manager: %v", err)
-			RemoveConnection(socketManager, uint64(notification.ToUserID))
+			RemoveConnection(socketManager, uint64(userID))
 		}
 	}
+	// Clients that can't use websockets get the same frame over /events
+	eventStreams.send(userID, sseEvent{ID: notificationEventID(frame), Data: messageJSON})
 }
 
 func AddConnection(sm *m.SocketManager, userID uint64, conn *websocket.Conn) {
@@ -204,6 +211,11 @@ func RemoveConnection(sm *m.SocketManager, userID uint64) {
 }
 
 func BroadcastUserStatus(sm *m.SocketManager, userID uint64, isOnline bool) {
+	// Still online through /events
+	if !isOnline && eventStreams.online(int(userID)) {
+		return
+	}
+
 	statusUpdate := struct {
 		Type     string `json:"type"`
 		UserID   uint64 `json:"user_id"`
@@ -221,6 +233,7 @@ func BroadcastUserStatus(sm *m.SocketManager, userID uint64, isOnline bool) {
 	}
 
 	Broadcast(sm, message)
+	eventStreams.broadcast(sseEvent{Data: message})
 }
 
 func Broadcast(sm *m.SocketManager, message []byte) {
@@ -244,6 +257,13 @@ func GetOnlineUsers(sm *m.SocketManager) []uint64 {
 	for userID := range sm.Sockets {
 		onlineUsers = append(onlineUsers, userID)
 	}
+
+	// Users connected over /events are online too
+	for _, userID := range eventStreams.users() {
+		if _, counted := sm.Sockets[uint64(userID)]; !counted {
+			onlineUsers = append(onlineUsers, uint64(userID))
+		}
+	}
 	return onlineUsers
 }
 
@@ -286,6 +306,7 @@ func ClearNotification(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Notification not found or unauthorized", http.StatusNotFound)
 		return
 	}
+	notifications.PublishUnreadCount(int(userID))
 
 	// Send success response
 	w.WriteHeader(http.StatusOK)
@@ -320,6 +341,7 @@ func ClearAllNotifications(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
+	notifications.PublishUnreadCount(int(userID))
 
 	// Send success response
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"testing"
+
+	"social-network/pkg/notifications"
+)
+
+func TestClientNotificationsAreNotDelivered(t *testing.T) {
+	var sent []notifications.Frame
+	notifications.SetPublisher(func(userID int, frame notifications.Frame) {
+		sent = append(sent, frame)
+	})
+	defer notifications.SetPublisher(nil)
+
+	HandleMessages(2, []byte(`{
+		"type": "notification",
+		"to_user_id": 1,
+		"from_user_id": 3,
+		"content": "bob liked your post",
+		"id": 7
+	}`))
+
+	if len(sent) != 0 {
+		t.Errorf("a notification sent by a client was delivered: %+v", sent)
+	}
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/util"
+)
+
+const (
+	defaultSuggestionPageSize = 5
+	maxSuggestionPageSize     = 20
+)
+
+// Weights of each signal in a suggestion's score. Recent interactions only
+// count up to maxSuggestionInteractions so a long chat doesn't outrank
+// everything else.
+const (
+	mutualFollowerWeight      = 3
+	sharedGroupWeight         = 2
+	sharedEventWeight         = 2
+	interactionWeight         = 1
+	maxSuggestionInteractions = 5
+)
+
+// GetSuggestedUsers ranks users the caller doesn't follow or hasn't asked to
+// follow. Only friends of friends (users followed by someone the caller
+// follows) and members of the caller's groups are candidates. They score for
+// followers they share with the caller, groups they are both members of,
+// events they are both going to and comments, likes and messages exchanged
+// in the last 30 days. Dismissed and blocked users are never suggested.
+// Pages are keyed on the score and id of the last suggestion so they don't
+// shift while the scores change.
+func GetSuggestedUsers(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	limit, err := util.PageSize(r, defaultSuggestionPageSize, maxSuggestionPageSize)
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	beforeScore, beforeID, err := util.ParseRankCursor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := sqlite.DB.Query(`
+		WITH candidates(id) AS (
+			SELECT theirs.followed_id FROM followers mine
+			JOIN followers theirs ON theirs.follower_id = mine.followed_id
+			WHERE mine.follower_id = :viewer AND mine.status = 'accept' AND theirs.status = 'accept'
+			UNION
+			SELECT theirs.user_id FROM group_members mine
+			JOIN group_members theirs ON theirs.group_id = mine.group_id
+			WHERE mine.user_id = :viewer AND mine.status IN ('member', 'creator')
+			AND theirs.status IN ('member', 'creator')
+		)
+		SELECT id, username, avatar, mutual_followers, shared_groups, shared_events, interactions, score
+		FROM (
+			SELECT *, mutual_followers * :mutual_weight
+				+ shared_groups * :group_weight
+				+ shared_events * :event_weight
+				+ MIN(interactions, :max_interactions) * :interaction_weight AS score
+			FROM (
+				SELECT u.id, u.username, u.avatar,
+					(
+						SELECT COUNT(*) FROM followers mine
+						JOIN followers theirs ON theirs.follower_id = mine.followed_id
+						WHERE mine.follower_id = :viewer AND mine.status = 'accept'
+						AND theirs.followed_id = u.id AND theirs.status = 'accept'
+					) AS mutual_followers,
+					(
+						SELECT COUNT(DISTINCT mine.group_id) FROM group_members mine
+						JOIN group_members theirs ON theirs.group_id = mine.group_id
+						WHERE mine.user_id = :viewer AND mine.status IN ('member', 'creator')
+						AND theirs.user_id = u.id AND theirs.status IN ('member', 'creator')
+					) AS shared_groups,
+					(
+						SELECT COUNT(DISTINCT mine.event_id) FROM group_event_RSVP mine
+						JOIN group_event_RSVP theirs ON theirs.event_id = mine.event_id
+						WHERE mine.user_id = :viewer AND mine.rsvp_status = 'going'
+						AND theirs.user_id = u.id AND theirs.rsvp_status = 'going'
+					) AS shared_events,
+					(
+						SELECT COUNT(*) FROM comments c
+						JOIN posts p ON p.id = c.post_id
+						WHERE julianday(c.created_at) > julianday('now', '-30 days')
+						AND ((c.author = :viewer AND p.author = u.id) OR (c.author = u.id AND p.author = :viewer))
+					) + (
+						SELECT COUNT(*) FROM likes l
+						JOIN posts p ON p.id = l.post_id
+						WHERE l.is_like AND julianday(l.liked_at) > julianday('now', '-30 days')
+						AND ((l.user_id = :viewer AND p.author = u.id) OR (l.user_id = u.id AND p.author = :viewer))
+					) + (
+						SELECT COUNT(*) FROM chat_messages cm
+						WHERE julianday(cm.created_at) > julianday('now', '-30 days')
+						AND ((cm.sender_id = :viewer AND cm.recipient_id = u.id) OR (cm.sender_id = u.id AND cm.recipient_id = :viewer))
+					) AS interactions
+				FROM candidates
+				JOIN users u ON u.id = candidates.id
+				WHERE u.id != :viewer
+				AND NOT EXISTS (
+					SELECT 1 FROM followers f WHERE f.follower_id = :viewer AND f.followed_id = u.id
+				)
+				AND NOT EXISTS (
+					SELECT 1 FROM suggestion_dismissals d WHERE d.user_id = :viewer AND d.dismissed_id = u.id
+				)
+				AND `+notBlockedClause("u.id", ":viewer")+`
+			)
+		)
+		WHERE :before_id = 0 OR (score, id) < (:before_score, :before_id)
+		ORDER BY score DESC, id DESC
+		LIMIT :limit`,
+		sql.Named("viewer", userID),
+		sql.Named("mutual_weight", mutualFollowerWeight),
+		sql.Named("group_weight", sharedGroupWeight),
+		sql.Named("event_weight", sharedEventWeight),
+		sql.Named("interaction_weight", interactionWeight),
+		sql.Named("max_interactions", maxSuggestionInteractions),
+		sql.Named("before_score", beforeScore),
+		sql.Named("before_id", beforeID),
+		sql.Named("limit", limit),
+	)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error querying suggested users: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	onlineUsers := make(map[uint64]bool)
+	for _, id := range GetOnlineUsers(socketManager) {
+		onlineUsers[id] = true
+	}
+
+	suggestedUsers := []m.SuggestedUser{}
+	var score int
+	for rows.Next() {
+		var user m.SuggestedUser
+		var avatar sql.NullString
+		var interactions int
+		if err := rows.Scan(&user.ID, &user.Username, &avatar, &user.MutualFollowers, &user.SharedGroups, &user.SharedEvents, &interactions, &score); err != nil {
+			http.Error(w, "Error scanning users", http.StatusInternalServerError)
+			log.Printf("Error scanning user row: %v", err)
+			return
+		}
+		user.Avatar = avatar.String
+		user.Online = onlineUsers[uint64(user.ID)]
+		user.Reason = suggestionReason(user, interactions)
+		suggestedUsers = append(suggestedUsers, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		http.Error(w, "Error iterating users", http.StatusInternalServerError)
+		log.Printf("Error iterating users: %v", err)
+		return
+	}
+
+	if len(suggestedUsers) == limit {
+		last := suggestedUsers[len(suggestedUsers)-1]
+		w.Header().Set("X-Next-Cursor", util.RankCursor(score, int64(last.ID)))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(suggestedUsers); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// suggestionReason describes the signal that contributed most to a
+// suggestion's score
+func suggestionReason(user m.SuggestedUser, interactions int) string {
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return one
+		}
+		return fmt.Sprintf(many, n)
+	}
+
+	mutual := user.MutualFollowers * mutualFollowerWeight
+	groups := user.SharedGroups * sharedGroupWeight
+	events := user.SharedEvents * sharedEventWeight
+	recent := min(interactions, maxSuggestionInteractions) * interactionWeight
+
+	switch {
+	case mutual > 0 && mutual >= groups && mutual >= events && mutual >= recent:
+		return plural(user.MutualFollowers, "1 mutual follower", "%d mutual followers")
+	case groups > 0 && groups >= events && groups >= recent:
+		return plural(user.SharedGroups, "1 group in common", "%d groups in common")
+	case events > 0 && events >= recent:
+		return plural(user.SharedEvents, "Going to 1 of your events", "Going to %d of your events")
+	case recent > 0:
+		return "You interacted recently"
+	}
+	return "New to the network"
+}
+
+// DismissSuggestion stops {id} from being suggested to the caller again
+func DismissSuggestion(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	dismissedID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if dismissedID == int64(userID) {
+		http.Error(w, "You can't dismiss yourself", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := m.DoesUserExist(uint(dismissedID), sqlite.DB)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := sqlite.DB.Exec(
+		"INSERT OR IGNORE INTO suggestion_dismissals (user_id, dismissed_id) VALUES (?, ?)",
+		userID, dismissedID,
+	); err != nil {
+		log.Printf("Error dismissing suggestion %d: %v", dismissedID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,165 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+)
+
+// suggestionPage loads a page of userID's suggestions and the cursor of the
+// next one
+func suggestionPage(t *testing.T, userID int64, limit int, before string) ([]int, string) {
+	t.Helper()
+	query := url.Values{"limit": {fmt.Sprint(limit)}}
+	if before != "" {
+		query.Set("before", before)
+	}
+	rec := getAs(userID, GetSuggestedUsers, "/users/suggested?"+query.Encode(), nil)
+	if rec.Code != 200 {
+		t.Fatalf("suggestions returned %d: %s", rec.Code, rec.Body)
+	}
+	var users []m.SuggestedUser
+	if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, user := range users {
+		ids = append(ids, int(user.ID))
+	}
+	return ids, rec.Header().Get("X-Next-Cursor")
+}
+
+// postBy creates a post by author at the given time
+func postBy(t *testing.T, author int64, at time.Time) int64 {
+	t.Helper()
+	result, err := sqlite.DB.Exec(
+		"INSERT INTO posts (title, content, author, created_at) VALUES ('Post', 'Content', ?, ?)",
+		author, at,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+// likeOn records that userID liked postID at the given time
+func likeOn(t *testing.T, userID, postID int64, at time.Time) {
+	t.Helper()
+	_, err := sqlite.DB.Exec(
+		"INSERT INTO likes (user_id, post_id, is_like, liked_at) VALUES (?, ?, true, ?)",
+		userID, postID, at.UTC().Format(time.DateTime),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSuggestionsComeFromFriendsOfFriendsAndGroups(t *testing.T) {
+	sqlitetest.Open(t)
+
+	viewer := newTestUser(t, "viewer", false)
+	friend := newTestUser(t, "friend", false)
+	friendOfFriend := newTestUser(t, "friendoffriend", false)
+	groupmate := newTestUser(t, "groupmate", false)
+	stranger := newTestUser(t, "stranger", false)
+
+	addFollow(t, viewer, friend)
+	addFollow(t, friend, friendOfFriend)
+
+	result, err := sqlite.DB.Exec("INSERT INTO groups (title, description, creator_id) VALUES ('Knitting', 'Yarn', ?)", viewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupID, _ := result.LastInsertId()
+	for userID, status := range map[int64]string{viewer: "creator", groupmate: "member"} {
+		if _, err := sqlite.DB.Exec(
+			"INSERT INTO group_members (group_id, user_id, status) VALUES (?, ?, ?)", groupID, userID, status,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A recent like alone doesn't make the stranger a candidate
+	likeOn(t, stranger, postBy(t, viewer, time.Now()), time.Now())
+
+	ids, _ := suggestionPage(t, viewer, 20, "")
+	if !slices.Contains(ids, int(friendOfFriend)) || !slices.Contains(ids, int(groupmate)) {
+		t.Errorf("suggestions %v, want the friend of a friend %d and the groupmate %d", ids, friendOfFriend, groupmate)
+	}
+	if slices.Contains(ids, int(stranger)) || slices.Contains(ids, int(friend)) {
+		t.Errorf("suggestions %v include the stranger %d or the followed friend %d", ids, stranger, friend)
+	}
+}
+
+func TestSuggestionsCountLikesByWhenTheyHappened(t *testing.T) {
+	sqlitetest.Open(t)
+
+	viewer := newTestUser(t, "viewer", false)
+	friend := newTestUser(t, "friend", false)
+	recentLiker := newTestUser(t, "recentliker", false)
+	oldLiker := newTestUser(t, "oldliker", false)
+	addFollow(t, viewer, friend)
+	addFollow(t, friend, recentLiker)
+	addFollow(t, friend, oldLiker)
+
+	// A recent like of an old post counts, an old like of a new post doesn't.
+	// The old liker has the higher id, so it would come first on a tie.
+	longAgo := time.Now().AddDate(0, 0, -60)
+	likeOn(t, recentLiker, postBy(t, viewer, longAgo), time.Now())
+	likeOn(t, oldLiker, postBy(t, viewer, time.Now()), longAgo)
+
+	ids, _ := suggestionPage(t, viewer, 20, "")
+	want := []int{int(recentLiker), int(oldLiker)}
+	if !slices.Equal(ids, want) {
+		t.Errorf("suggestions = %v, want the recent liker first: %v", ids, want)
+	}
+}
+
+func TestSuggestionsPageWithCursor(t *testing.T) {
+	sqlitetest.Open(t)
+
+	viewer := newTestUser(t, "viewer", false)
+	friend := newTestUser(t, "friend", false)
+	addFollow(t, viewer, friend)
+	for i := range 5 {
+		candidate := newTestUser(t, fmt.Sprint("candidate", i), false)
+		addFollow(t, friend, candidate)
+		// Give some of them a second mutual follower so the scores differ
+		if i%2 == 0 {
+			other := newTestUser(t, fmt.Sprint("other", i), false)
+			addFollow(t, viewer, other)
+			addFollow(t, other, candidate)
+		}
+	}
+
+	all, _ := suggestionPage(t, viewer, 20, "")
+
+	var paged []int
+	cursor := ""
+	for range len(all) + 1 {
+		ids, next := suggestionPage(t, viewer, 2, cursor)
+		paged = append(paged, ids...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if !slices.Equal(paged, all) {
+		t.Errorf("paged suggestions = %v, want %v", paged, all)
+	}
+
+	rec := getAs(viewer, GetSuggestedUsers, "/users/suggested?before=abc", nil)
+	if rec.Code != 400 {
+		t.Errorf("invalid cursor returned %d, want 400", rec.Code)
+	}
+}
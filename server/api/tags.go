@@ -0,0 +1,345 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/notifications"
+	"social-network/util"
+)
+
+const (
+	defaultTagPageSize   = 20
+	maxTagPageSize       = 50
+	defaultTrendingHours = 24
+	maxTrendingHours     = 24 * 7
+)
+
+// mentionPlaces describes each kind of content in mention notifications
+var mentionPlaces = map[string]string{
+	m.SourcePost:             "a post",
+	m.SourceComment:          "a comment",
+	m.SourceGroupPost:        "a group post",
+	m.SourceGroupPostComment: "a group post comment",
+	m.SourceChatMessage:      "a message",
+	m.SourceGroupChatMessage: "the group chat",
+}
+
+// indexContent stores the hashtags and mentions found in freshly written
+// content and notifies every mentioned user that is allowed to see it.
+// groupID is only used for content that lives inside a group. Failures are
+// logged and never undo the write that triggered them.
+func indexContent(source string, sourceID int64, authorID uint64, groupID int64, text string) {
+	for _, tag := range util.ExtractHashtags(text) {
+		_, err := sqlite.DB.Exec(`
+			INSERT OR IGNORE INTO hashtags (tag, source_type, source_id, author)
+			VALUES (?, ?, ?, ?)`,
+			tag, source, sourceID, authorID,
+		)
+		if err != nil {
+			log.Printf("Error saving hashtag %q for %s %d: %v", tag, source, sourceID, err)
+		}
+	}
+
+	usernames := util.ExtractMentions(text)
+	if len(usernames) == 0 {
+		return
+	}
+
+	var authorName string
+	if err := sqlite.DB.QueryRow("SELECT username FROM users WHERE id = ?", authorID).Scan(&authorName); err != nil {
+		log.Printf("Error getting username for mentions: %v", err)
+		return
+	}
+
+	// A mention ending in dots refers to the name with the dots when someone
+	// has it, and otherwise to the name without them, as in "thanks @jane."
+	names := make([]interface{}, 0, 2*len(usernames))
+	for _, username := range usernames {
+		names = append(names, username)
+		if trimmed := util.MentionWithoutDots(username); trimmed != username {
+			names = append(names, trimmed)
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(names)), ",")
+	// Old usernames keep working during their grace period
+	rows, err := sqlite.DB.Query(`
+		SELECT username, id FROM users WHERE username IN (`+placeholders+`)
+		UNION
+		SELECT old_username, user_id FROM username_history
+		WHERE old_username IN (`+placeholders+`) AND `+inUsernameGrace+`
+			AND old_username NOT IN (SELECT username FROM users)`,
+		append(names, names...)...,
+	)
+	if err != nil {
+		log.Printf("Error resolving mentions: %v", err)
+		return
+	}
+	ids := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var id int64
+		if err := rows.Scan(&name, &id); err == nil {
+			ids[name] = id
+		}
+	}
+	rows.Close()
+
+	var mentioned []int64
+	seen := make(map[int64]bool)
+	for _, username := range usernames {
+		id, ok := ids[username]
+		if !ok {
+			id, ok = ids[util.MentionWithoutDots(username)]
+		}
+		if ok && id != int64(authorID) && !seen[id] {
+			seen[id] = true
+			mentioned = append(mentioned, id)
+		}
+	}
+
+	for _, userID := range mentioned {
+		// Users who blocked one another can't mention each other
+		if blocked, err := isBlocked(int64(authorID), userID); err != nil || blocked {
+			continue
+		}
+
+		visible, err := canSeeSource(source, sourceID, groupID, userID)
+		if err != nil {
+			log.Printf("Error checking visibility of %s %d for user %d: %v", source, sourceID, userID, err)
+			continue
+		}
+		if !visible {
+			continue
+		}
+
+		result, err := sqlite.DB.Exec(`
+			INSERT OR IGNORE INTO mentions (user_id, source_type, source_id, author)
+			VALUES (?, ?, ?, ?)`,
+			userID, source, sourceID, authorID,
+		)
+		if err != nil {
+			log.Printf("Error saving mention of user %d: %v", userID, err)
+			continue
+		}
+		if added, _ := result.RowsAffected(); added == 0 {
+			continue
+		}
+
+		notification := m.Notification{
+			ToUserID:   int(userID),
+			FromUserID: int(authorID),
+			Content:    fmt.Sprintf("%s mentioned you in %s", authorName, mentionPlaces[source]),
+			Type:       m.NotificationMention,
+			GroupID:    int(groupID),
+			CreatedAt:  time.Now(),
+		}
+		notification.IdempotencyKey = notifications.Key(m.NotificationMention, source, sourceID, userID)
+		if source == m.SourceChatMessage || source == m.SourceGroupChatMessage {
+			notification.Type = m.NotificationChatMention
+		}
+
+		if err := notifications.Send(&notification); err != nil {
+			log.Printf("Error creating mention notification: %v", err)
+		}
+	}
+}
+
+// canSeeSource reports whether userID is allowed to read the given content,
+// using the same rules as the endpoints that serve it.
+func canSeeSource(source string, sourceID, groupID, userID int64) (bool, error) {
+	var query string
+	switch source {
+	case m.SourcePost:
+		query = `SELECT EXISTS (SELECT 1 FROM posts p WHERE p.id = :id AND ` + visiblePostsClause + `)`
+	case m.SourceComment:
+		query = `SELECT EXISTS (
+			SELECT 1 FROM comments c
+			JOIN posts p ON p.id = c.post_id
+			WHERE c.id = :id AND ` + visiblePostsClause + `
+		)`
+	case m.SourceChatMessage:
+		query = `SELECT EXISTS (SELECT 1 FROM chat_messages WHERE id = :id AND recipient_id = :viewer)`
+	case m.SourceGroupPost, m.SourceGroupPostComment, m.SourceGroupChatMessage:
+		return isGroupMember(groupID, uint64(userID))
+	default:
+		return false, fmt.Errorf("unknown source type %q", source)
+	}
+
+	var visible bool
+	err := sqlite.DB.QueryRow(query, sql.Named("id", sourceID), sql.Named("viewer", userID)).Scan(&visible)
+	return visible, err
+}
+
+// GetTagPosts lists the posts and group posts tagged with {tag} that the
+// caller can see, newest first.
+func GetTagPosts(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		http.Error(w, "Missing tag", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := util.PageSize(r, defaultTagPageSize, maxTagPageSize)
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := sqlite.DB.Query(`
+		SELECT id, title, content, media, media_type, privacy, author, created_at, username, avatar, group_id
+		FROM (
+			SELECT p.id, p.title, p.content, p.media, p.media_type, p.privacy, p.author, p.created_at,
+				u.username, u.avatar, NULL AS group_id
+			FROM hashtags h
+			JOIN posts p ON p.id = h.source_id
+			JOIN users u ON u.id = p.author
+			WHERE h.tag = :tag AND h.source_type = 'post' AND `+visiblePostsClause+`
+
+			UNION ALL
+
+			SELECT gp.id, gp.title, gp.content, gp.media, gp.media_type, 0, gp.author, gp.created_at,
+				u.username, u.avatar, gp.group_id
+			FROM hashtags h
+			JOIN group_posts gp ON gp.id = h.source_id
+			JOIN users u ON u.id = gp.author
+			WHERE h.tag = :tag AND h.source_type = 'group_post'
+			AND EXISTS (
+				SELECT 1 FROM group_members gm
+				WHERE gm.group_id = gp.group_id AND gm.user_id = :viewer
+				AND gm.status IN ('member', 'creator')
+			)
+			AND `+notBlockedClause("gp.author", ":viewer")+`
+		)
+		ORDER BY created_at DESC
+		LIMIT :limit OFFSET :offset
+	`,
+		sql.Named("tag", tag),
+		sql.Named("viewer", userID),
+		sql.Named("limit", limit),
+		sql.Named("offset", offset),
+	)
+	if err != nil {
+		log.Printf("Error fetching posts for tag %q: %v", tag, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	posts := []m.PostResponse{}
+	for rows.Next() {
+		var post m.PostResponse
+		var media []byte
+		var mediaType, avatar sql.NullString
+		var groupID sql.NullInt64
+		if err := rows.Scan(
+			&post.ID, &post.Title, &post.Content, &media, &mediaType, &post.Privacy,
+			&post.Author, &post.CreatedAt, &post.AuthorName, &avatar, &groupID,
+		); err != nil {
+			log.Printf("Error scanning tagged post: %v", err)
+			http.Error(w, "Error reading posts", http.StatusInternalServerError)
+			return
+		}
+
+		if len(media) > 0 && mediaType.Valid {
+			post.MediaBase64 = "data:" + mediaType.String + ";base64," +
+				base64.StdEncoding.EncodeToString(media)
+			post.MediaType = mediaType.String
+		}
+		if avatar.Valid {
+			post.AuthorAvatar = avatar.String
+		}
+		if groupID.Valid {
+			post.GroupID = &groupID.Int64
+		}
+
+		posts = append(posts, post)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tag":   tag,
+		"posts": posts,
+	})
+}
+
+// GetTrendingTags ranks the hashtags used in public posts over the last
+// `hours` hours (default 24, max one week) by how many people used them.
+func GetTrendingTags(w http.ResponseWriter, r *http.Request) {
+	hours := defaultTrendingHours
+	if value := r.URL.Query().Get("hours"); value != "" {
+		var err error
+		hours, err = strconv.Atoi(value)
+		if err != nil || hours < 1 {
+			http.Error(w, "Invalid hours", http.StatusBadRequest)
+			return
+		}
+		if hours > maxTrendingHours {
+			hours = maxTrendingHours
+		}
+	}
+
+	limit, err := util.PageSize(r, 10, maxTagPageSize)
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	// Only public posts by public accounts count so trending tags never leak
+	// what is being said behind privacy settings
+	rows, err := sqlite.DB.Query(`
+		SELECT h.tag, COUNT(*) AS uses, COUNT(DISTINCT h.author) AS authors
+		FROM hashtags h
+		JOIN posts p ON p.id = h.source_id
+		JOIN users u ON u.id = p.author
+		WHERE h.source_type = 'post'
+		AND p.privacy = 1 AND u.is_private = 0
+		AND h.created_at >= datetime('now', ?)
+		GROUP BY h.tag
+		ORDER BY authors DESC, uses DESC, MAX(h.created_at) DESC
+		LIMIT ?
+	`, fmt.Sprintf("-%d hours", hours), limit)
+	if err != nil {
+		log.Printf("Error fetching trending tags: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tags := []m.TrendingTag{}
+	for rows.Next() {
+		var tag m.TrendingTag
+		if err := rows.Scan(&tag.Tag, &tag.Uses, &tag.Authors); err != nil {
+			log.Printf("Error scanning trending tag: %v", err)
+			http.Error(w, "Error reading tags", http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
@@ -0,0 +1,72 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+)
+
+// mentionedIn lists the users mentioned in a post, in id order
+func mentionedIn(t *testing.T, postID int64) []int64 {
+	t.Helper()
+	rows, err := sqlite.DB.Query(
+		"SELECT user_id FROM mentions WHERE source_type = ? AND source_id = ? ORDER BY user_id",
+		m.SourcePost, postID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestMentionsEndingInDots(t *testing.T) {
+	sqlitetest.Open(t)
+
+	dotted := newTestUser(t, "dot.end.", false)
+
+	// "@dot.end." is the user with the dot, "@jane_smith." is jane ending a sentence
+	postID := postBy(t, 1, time.Now())
+	indexContent(m.SourcePost, postID, 1, 0, "Thanks @dot.end. and @jane_smith.")
+
+	if got, want := mentionedIn(t, postID), []int64{2, dotted}; !slices.Equal(got, want) {
+		t.Errorf("mentioned users = %v, want %v", got, want)
+	}
+}
+
+func TestDeletingContentDropsItsTags(t *testing.T) {
+	sqlitetest.Open(t)
+
+	postID := postBy(t, 1, time.Now())
+	indexContent(m.SourcePost, postID, 1, 0, "Hello @jane_smith #tagcleanup")
+	if len(mentionedIn(t, postID)) != 1 {
+		t.Fatal("the post should mention jane")
+	}
+
+	if _, err := sqlite.DB.Exec("DELETE FROM posts WHERE id = ?", postID); err != nil {
+		t.Fatal(err)
+	}
+
+	var hashtags int
+	if err := sqlite.DB.QueryRow("SELECT COUNT(*) FROM hashtags WHERE tag = 'tagcleanup'").Scan(&hashtags); err != nil {
+		t.Fatal(err)
+	}
+	if mentions := mentionedIn(t, postID); hashtags != 0 || len(mentions) != 0 {
+		t.Errorf("deleted post left %d hashtags and mentions of %v", hashtags, mentions)
+	}
+}
@@ -10,8 +10,9 @@ import (
 
 	"social-network/util"
 
-	//"social-network/models"
+	"social-network/models"
 	"social-network/pkg/db/sqlite"
+	"social-network/pkg/follow"
 )
 
 func UserProfile(w http.ResponseWriter, r *http.Request) {
@@ -45,6 +46,19 @@ func UserProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Blocked users don't see each other's profiles
+	if targetUserID != int64(loggedInUserID) {
+		blocked, err := isBlocked(int64(loggedInUserID), targetUserID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+	}
+
 	// Query to get user profile information and follow status
 	query := `
 		SELECT 
@@ -65,7 +79,11 @@ func UserProfile(w http.ResponseWriter, r *http.Request) {
 				WHEN f.status = 'pending' THEN true
 				ELSE false
 			END as is_pending,
-			u.created_at
+			u.created_at,
+			u.email_visibility,
+			u.birthday_visibility,
+			u.about_me_visibility,
+			u.email_verified_at IS NOT NULL
 		FROM users u
 		LEFT JOIN followers f ON f.followed_id = u.id AND f.follower_id = ?
 		WHERE u.id = ?
@@ -76,9 +94,9 @@ func UserProfile(w http.ResponseWriter, r *http.Request) {
 		Username    string `json:"username"`
 		FirstName   string `json:"first_name"`
 		LastName    string `json:"last_name"`
-		Email       string `json:"email"`
-		DateOfBirth string `json:"date_of_birth"`
-		AboutMe     string `json:"about_me"`
+		Email       string `json:"email,omitempty"`
+		DateOfBirth string `json:"date_of_birth,omitempty"`
+		AboutMe     string `json:"about_me,omitempty"`
 		Avatar      string `json:"avatar"`
 		IsPrivate   bool   `json:"is_private"`
 		IsFollowing bool   `json:"is_following"`
@@ -87,12 +105,22 @@ func UserProfile(w http.ResponseWriter, r *http.Request) {
 		Posts       []Post `json:"posts,omitempty"`
 		Followers   int    `json:"followers_count"`
 		Following   int    `json:"following_count"`
+
+		Relationship *models.Relationship `json:"relationship,omitempty"`
+
+		// Visibility of the optional fields, only sent to the owner
+		EmailVisibility    string `json:"email_visibility,omitempty"`
+		BirthdayVisibility string `json:"birthday_visibility,omitempty"`
+		AboutMeVisibility  string `json:"about_me_visibility,omitempty"`
+		EmailVerified      *bool  `json:"email_verified,omitempty"`
 	}
 
 	// Get user profile information
 	var avatar sql.NullString
 	var aboutMe sql.NullString
 	var createdAt string
+	var emailVisibility, birthdayVisibility, aboutMeVisibility string
+	var emailVerified bool
 	err = sqlite.DB.QueryRow(query, loggedInUserID, targetUserID).Scan(
 		&profile.ID,
 		&profile.Username,
@@ -106,6 +134,10 @@ func UserProfile(w http.ResponseWriter, r *http.Request) {
 		&profile.IsFollowing,
 		&profile.IsPending,
 		&createdAt,
+		&emailVisibility,
+		&birthdayVisibility,
+		&aboutMeVisibility,
+		&emailVerified,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -127,6 +159,24 @@ func UserProfile(w http.ResponseWriter, r *http.Request) {
 	// Set the created_at field
 	profile.CreatedAt = createdAt
 
+	// Hide the optional fields the owner doesn't share with this viewer
+	if profile.ID == int64(loggedInUserID) {
+		profile.EmailVisibility = emailVisibility
+		profile.BirthdayVisibility = birthdayVisibility
+		profile.AboutMeVisibility = aboutMeVisibility
+		profile.EmailVerified = &emailVerified
+	} else {
+		if !fieldVisible(emailVisibility, profile.IsFollowing) {
+			profile.Email = ""
+		}
+		if !fieldVisible(birthdayVisibility, profile.IsFollowing) {
+			profile.DateOfBirth = ""
+		}
+		if !fieldVisible(aboutMeVisibility, profile.IsFollowing) {
+			profile.AboutMe = ""
+		}
+	}
+
 	// Get followers count
 	err = sqlite.DB.QueryRow(`
 		SELECT COUNT(*) FROM followers 
@@ -145,6 +195,16 @@ func UserProfile(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error getting following count: %v", err)
 	}
 
+	// Describe how the logged-in user is connected to someone else's profile
+	if profile.ID != int64(loggedInUserID) {
+		profile.Relationship, err = relationshipWith(int64(loggedInUserID), profile.ID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("Error getting relationship: %v", err)
+			return
+		}
+	}
+
 	// Get user's posts if the profile is public or if the logged-in user is following
 	if !profile.IsPrivate || profile.IsFollowing || profile.ID == int64(loggedInUserID) {
 		rows, err := sqlite.DB.Query(`
@@ -186,94 +246,6 @@ type Post struct {
 	CommentsCount int       `json:"comments_count"`
 }
 
-func GetSuggestedUsers(w http.ResponseWriter, r *http.Request) {
-	// Get current user ID from session
-	userID, err := util.GetUserID(r, w)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// Query for users that the current user is not following
-	rows, err := sqlite.DB.Query(`
-		SELECT DISTINCT u.id, u.username, u.avatar 
-		FROM users u 
-		WHERE u.id NOT IN (
-			SELECT followed_id 
-			FROM followers 
-			WHERE follower_id = ? AND status = 'accept'
-		) 
-		AND u.id != ?
-		AND u.id IN (
-			SELECT id FROM users WHERE id != 1
-		)
-		LIMIT 5
-	`, userID, userID)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		log.Printf("Error querying suggested users: %v", err)
-		return
-	}
-	defer rows.Close()
-
-	var suggestedUsers []struct {
-		ID       uint   `json:"id"`
-		Username string `json:"username"`
-		Avatar   string `json:"avatar,omitempty"`
-		Online   bool   `json:"online"`
-	}
-
-	// Get current online users
-	onlineUsers := make(map[uint64]bool)
-	for _, id := range GetOnlineUsers(socketManager) {
-		onlineUsers[id] = true
-	}
-
-	for rows.Next() {
-		var user struct {
-			ID       uint   `json:"id"`
-			Username string `json:"username"`
-			Avatar   string `json:"avatar,omitempty"`
-			Online   bool   `json:"online"`
-		}
-		var avatar sql.NullString
-		if err := rows.Scan(&user.ID, &user.Username, &avatar); err != nil {
-			http.Error(w, "Error scanning users", http.StatusInternalServerError)
-			log.Printf("Error scanning user row: %v", err)
-			return
-		}
-		if avatar.Valid {
-			user.Avatar = avatar.String
-		}
-		// Check if user is online
-		user.Online = onlineUsers[uint64(user.ID)]
-		suggestedUsers = append(suggestedUsers, user)
-	}
-
-	if err = rows.Err(); err != nil {
-		http.Error(w, "Error iterating users", http.StatusInternalServerError)
-		log.Printf("Error iterating users: %v", err)
-		return
-	}
-
-	// If no suggested users found, return empty array instead of null
-	if suggestedUsers == nil {
-		suggestedUsers = make([]struct {
-			ID       uint   `json:"id"`
-			Username string `json:"username"`
-			Avatar   string `json:"avatar,omitempty"`
-			Online   bool   `json:"online"`
-		}, 0)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(suggestedUsers); err != nil {
-		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
-		return
-	}
-}
-
 func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	// Get current user ID from session
 	userID, err := util.GetUserID(r, w)
@@ -291,7 +263,10 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 			u.username, 
 			u.avatar, 
 			u.is_private, 
-			u.about_me, 
+			CASE
+				WHEN u.about_me_visibility = 'public' THEN u.about_me
+				WHEN u.about_me_visibility = 'followers' AND f.status = 'accept' THEN u.about_me
+			END as about_me,
 			u.first_name, 
 			u.last_name,
 			CASE 
@@ -313,12 +288,12 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 			END as follows_you
 		FROM users u 
 		LEFT JOIN followers f ON (f.follower_id = ? AND f.followed_id = u.id)
-		WHERE u.id != ? 
+		WHERE u.id != ? AND ` + notBlockedClause("u.id", "?") + `
 		ORDER BY 
 			CASE WHEN f.status = 'pending' THEN 0 ELSE 1 END,
 			u.username
 	`
-	rows, err := sqlite.DB.Query(query, userID, userID, userID)
+	rows, err := sqlite.DB.Query(query, userID, userID, userID, userID, userID)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		log.Printf("Error querying users: %v", err)
@@ -372,16 +347,20 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(users)
 }
 
-// Add a new endpoint to update privacy settings
+// UpdatePrivacySettings switches the caller's account between public and
+// private. Going public accepts every pending follow request, since a public
+// account doesn't approve followers. Going private keeps existing followers;
+// with review_followers set the response lists them so the owner can remove
+// the ones they no longer want. Each change is recorded in privacy_audit.
 func UpdatePrivacySettings(w http.ResponseWriter, r *http.Request) {
 	userID, err := util.GetUserID(r, w)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	var settings struct {
-		IsPrivate bool `json:"is_private"`
+		IsPrivate       bool `json:"is_private"`
+		ReviewFollowers bool `json:"review_followers"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
@@ -389,15 +368,97 @@ func UpdatePrivacySettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = sqlite.DB.Exec("UPDATE users SET is_private = ? WHERE id = ?", settings.IsPrivate, userID)
+	tx, err := sqlite.DB.Begin()
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
-		log.Printf("Error updating privacy settings: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var wasPrivate bool
+	if err := tx.QueryRow("SELECT is_private FROM users WHERE id = ?", userID).Scan(&wasPrivate); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error reading privacy settings: %v", err)
+		return
+	}
+
+	response := models.PrivacySettings{IsPrivate: settings.IsPrivate}
+	var accepted []*follow.Result
+
+	if wasPrivate != settings.IsPrivate {
+		if _, err := tx.Exec("UPDATE users SET is_private = ? WHERE id = ?", settings.IsPrivate, userID); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("Error updating privacy settings: %v", err)
+			return
+		}
+
+		if !settings.IsPrivate {
+			accepted, err = follow.AcceptPending(tx, int(userID))
+			if err != nil {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				log.Printf("Error accepting pending follow requests: %v", err)
+				return
+			}
+			response.AcceptedRequests = len(accepted)
+		}
+
+		if _, err := tx.Exec(`
+			INSERT INTO privacy_audit (user_id, was_private, is_private, accepted_requests)
+			VALUES (?, ?, ?, ?)`,
+			userID, wasPrivate, settings.IsPrivate, response.AcceptedRequests,
+		); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("Error recording privacy change: %v", err)
+			return
+		}
+	}
+
+	if settings.IsPrivate && settings.ReviewFollowers {
+		response.Followers, err = followersForReview(tx, userID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("Error listing followers for review: %v", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]bool{"is_private": settings.IsPrivate})
+	for _, res := range accepted {
+		res.Publish()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// followersForReview lists the accepted followers of userID, oldest first
+func followersForReview(tx *sql.Tx, userID uint64) ([]models.Follow, error) {
+	rows, err := tx.Query(`
+		SELECT f.id, f.follower_id, f.followed_id, f.status, f.created_at, u.username, COALESCE(u.avatar, '')
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.followed_id = ? AND f.status = 'accept'
+		ORDER BY f.created_at, f.id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	followers := []models.Follow{}
+	for rows.Next() {
+		var follower models.Follow
+		if err := rows.Scan(&follower.ID, &follower.FollowerID, &follower.FollowedID, &follower.Status, &follower.CreatedAt, &follower.Username, &follower.Avatar); err != nil {
+			return nil, err
+		}
+		followers = append(followers, follower)
+	}
+	return followers, rows.Err()
 }
 
 func GetUername (r *http.Request, w http.ResponseWriter) {
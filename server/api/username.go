@@ -0,0 +1,198 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/util"
+)
+
+const (
+	// usernameCooldown is how long a user has to wait between two changes
+	usernameCooldown = 30 * 24 * time.Hour
+
+	// usernameGraceDays is how long an old username keeps pointing to its
+	// previous owner. Nobody else can take it during that time.
+	usernameGraceDays = 90
+)
+
+// inUsernameGrace matches username_history rows whose name is still reserved
+var inUsernameGrace = fmt.Sprintf("julianday(changed_at) > julianday('now', '-%d days')", usernameGraceDays)
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// resolveUsername returns the id of the user currently called username, or
+// of the user who used that name until recently.
+func resolveUsername(q queryRower, username string) (int64, error) {
+	var userID int64
+	err := q.QueryRow(`
+		SELECT id FROM users WHERE username = ?
+		UNION ALL
+		SELECT * FROM (
+			SELECT user_id FROM username_history
+			WHERE old_username = ? AND `+inUsernameGrace+`
+			ORDER BY julianday(changed_at) DESC
+			LIMIT 1
+		)
+		LIMIT 1`,
+		username, username,
+	).Scan(&userID)
+	return userID, err
+}
+
+// usernameTaken reports whether username belongs to, or is still reserved
+// for, a user other than userID. Pass 0 when nobody owns the caller yet.
+func usernameTaken(q queryRower, username string, userID int64) (bool, error) {
+	var taken bool
+	err := q.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM users WHERE username = ? AND id != ?)
+			OR EXISTS (
+				SELECT 1 FROM username_history
+				WHERE old_username = ? AND user_id != ? AND `+inUsernameGrace+`
+			)`,
+		username, userID, username, userID,
+	).Scan(&taken)
+	return taken, err
+}
+
+// ChangeUsername renames the caller. The old name keeps resolving to them for
+// the grace period, and a new change is only allowed after the cooldown.
+func ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	username := strings.TrimSpace(req.Username)
+	v := util.Validator{}
+	v.Username("username", username)
+	if !v.Valid() {
+		v.Write(w, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error changing username", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&current); err != nil {
+		log.Printf("Error getting username of user %d: %v", userID, err)
+		http.Error(w, "Error changing username", http.StatusInternalServerError)
+		return
+	}
+	if username == current {
+		util.WriteFieldError(w, http.StatusBadRequest, "username", "is already your username")
+		return
+	}
+
+	var lastChange time.Time
+	err = tx.QueryRow(`
+		SELECT changed_at FROM username_history
+		WHERE user_id = ?
+		ORDER BY julianday(changed_at) DESC
+		LIMIT 1`,
+		userID,
+	).Scan(&lastChange)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error getting username history of user %d: %v", userID, err)
+		http.Error(w, "Error changing username", http.StatusInternalServerError)
+		return
+	}
+	if wait := time.Until(lastChange.Add(usernameCooldown)); err == nil && wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "You changed your username recently, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	taken, err := usernameTaken(tx, username, int64(userID))
+	if err != nil {
+		log.Printf("Error checking username %q: %v", username, err)
+		http.Error(w, "Error changing username", http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		util.WriteFieldError(w, http.StatusConflict, "username", "is already taken")
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO username_history (user_id, old_username, changed_at)
+		VALUES (?, ?, ?)`,
+		userID, current, time.Now(),
+	)
+	if err != nil {
+		log.Printf("Error saving username history of user %d: %v", userID, err)
+		http.Error(w, "Error changing username", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET username = ? WHERE id = ?", username, userID); err != nil {
+		// Lost a race against someone registering the same name
+		util.WriteFieldError(w, http.StatusConflict, "username", "is already taken")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error changing username", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.UserResponse{
+		ID:       int64(userID),
+		Username: username,
+	})
+}
+
+// UserByUsername redirects to the profile of the user called username. Old
+// usernames keep redirecting to their owner during the grace period.
+func UserByUsername(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	userID, err := resolveUsername(sqlite.DB, r.PathValue("username"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving username: %v", err)
+		http.Error(w, "Error finding user", http.StatusInternalServerError)
+		return
+	}
+
+	blocked, err := isBlocked(int64(viewerID), userID)
+	if err != nil {
+		http.Error(w, "Error finding user", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(w, r, "/user/"+strconv.FormatInt(userID, 10), http.StatusFound)
+}
@@ -0,0 +1,91 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+)
+
+// renameAs asks for userID to be renamed to username
+func renameAs(userID int64, username string) int {
+	return postAs(userID, ChangeUsername, "/user/username", fmt.Sprintf(`{"username": %q}`, username)).Code
+}
+
+// ageUsernameHistory moves every username change of userID into the past
+func ageUsernameHistory(t *testing.T, userID int64, age time.Duration) {
+	t.Helper()
+	if _, err := sqlite.DB.Exec(
+		"UPDATE username_history SET changed_at = ? WHERE user_id = ?", time.Now().Add(-age), userID,
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOldUsernameIsReservedDuringGrace(t *testing.T) {
+	sqlitetest.Open(t)
+	owner := newTestUser(t, "owner_old", false)
+	other := newTestUser(t, "other_test", false)
+
+	if code := renameAs(owner, "owner_new"); code != http.StatusOK {
+		t.Fatalf("rename returned %d", code)
+	}
+
+	if id, err := resolveUsername(sqlite.DB, "owner_old"); err != nil || id != owner {
+		t.Errorf("resolveUsername(old name) = %d, %v, want %d", id, err, owner)
+	}
+	rec := getAs(other, UserByUsername, "/user/by-username/owner_old", map[string]string{"username": "owner_old"})
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != fmt.Sprintf("/user/%d", owner) {
+		t.Errorf("old name redirected %d to %q, want the owner's profile", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if taken, err := usernameTaken(sqlite.DB, "owner_old", other); err != nil || !taken {
+		t.Errorf("usernameTaken(old name, other user) = %v, %v, want true", taken, err)
+	}
+	if taken, err := usernameTaken(sqlite.DB, "owner_old", owner); err != nil || taken {
+		t.Errorf("usernameTaken(old name, its owner) = %v, %v, want false", taken, err)
+	}
+	if taken, err := usernameTaken(sqlite.DB, "owner_new", 0); err != nil || !taken {
+		t.Errorf("usernameTaken(new name, nobody) = %v, %v, want true", taken, err)
+	}
+	if code := renameAs(other, "owner_old"); code != http.StatusConflict {
+		t.Errorf("taking a reserved name returned %d, want 409", code)
+	}
+
+	// After the grace period the name is free and only leads to its new owner
+	ageUsernameHistory(t, owner, (usernameGraceDays+1)*24*time.Hour)
+	if _, err := resolveUsername(sqlite.DB, "owner_old"); err != sql.ErrNoRows {
+		t.Errorf("resolveUsername(expired name) = %v, want sql.ErrNoRows", err)
+	}
+	if code := renameAs(other, "owner_old"); code != http.StatusOK {
+		t.Fatalf("taking a released name returned %d", code)
+	}
+	if id, err := resolveUsername(sqlite.DB, "owner_old"); err != nil || id != other {
+		t.Errorf("resolveUsername(retaken name) = %d, %v, want %d", id, err, other)
+	}
+}
+
+func TestUsernameChangeCooldown(t *testing.T) {
+	sqlitetest.Open(t)
+	owner := newTestUser(t, "owner_test", false)
+
+	if code := renameAs(owner, "owner_second"); code != http.StatusOK {
+		t.Fatalf("first rename returned %d", code)
+	}
+	rec := postAs(owner, ChangeUsername, "/user/username", `{"username": "owner_third"}`)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("second rename returned %d with Retry-After %q, want 429", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// The owner can take their old name back once the cooldown is over
+	ageUsernameHistory(t, owner, usernameCooldown+time.Hour)
+	if code := renameAs(owner, "owner_test"); code != http.StatusOK {
+		t.Errorf("renaming back after the cooldown returned %d", code)
+	}
+}
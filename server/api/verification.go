@@ -0,0 +1,221 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/mailer"
+	"social-network/util"
+)
+
+const (
+	// emailVerificationTTL is how long a verification link can be used
+	emailVerificationTTL = 48 * time.Hour
+
+	// verificationResendCooldown is how long a user waits before another
+	// verification email can be sent to them
+	verificationResendCooldown = 2 * time.Minute
+
+	// defaultVerificationGrace is how long a new account can do everything
+	// before verifying its email, unless EMAIL_VERIFICATION_GRACE says otherwise
+	defaultVerificationGrace = 24 * time.Hour
+)
+
+// verificationGrace reads EMAIL_VERIFICATION_GRACE, a Go duration such as
+// "72h". "0s" restricts unverified accounts right away.
+func verificationGrace() time.Duration {
+	value := os.Getenv("EMAIL_VERIFICATION_GRACE")
+	if value == "" {
+		return defaultVerificationGrace
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		log.Printf("Invalid EMAIL_VERIFICATION_GRACE %q, using %s", value, defaultVerificationGrace)
+		return defaultVerificationGrace
+	}
+	return grace
+}
+
+// emailVerifiedOrInGrace reports whether userID may use the features reserved
+// for verified accounts: their email is verified or the account is still
+// within the grace period.
+func emailVerifiedOrInGrace(userID uint64) (bool, error) {
+	var allowed bool
+	err := sqlite.DB.QueryRow(`
+		SELECT email_verified_at IS NOT NULL
+			OR julianday(created_at) > julianday('now', ?)
+		FROM users WHERE id = ?`,
+		fmt.Sprintf("-%d seconds", int(verificationGrace().Seconds())), userID,
+	).Scan(&allowed)
+	return allowed, err
+}
+
+// requireVerifiedEmail writes a 403 and returns false when userID has to
+// verify their email before doing action
+func requireVerifiedEmail(w http.ResponseWriter, userID uint64, action string) bool {
+	allowed, err := emailVerifiedOrInGrace(userID)
+	if err != nil {
+		http.Error(w, "Error checking email verification", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, "Verify your email to "+action, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// sendEmailVerification mails a new verification link to userID. Older
+// unused links stop working.
+func sendEmailVerification(userID int64, email, username string) error {
+	token := util.GenerateSessionToken()
+	now := time.Now().UTC()
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE email_verifications SET used_at = ? WHERE user_id = ? AND used_at IS NULL",
+		now, userID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO email_verifications (user_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?)`,
+		userID, hashToken(token), now.Add(emailVerificationTTL), now,
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	apiURL := os.Getenv("API_URL")
+	if apiURL == "" {
+		apiURL = "http://localhost:8080"
+	}
+	return accountMailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nTo verify your email, open %s/email/verify?token=%s\n\n"+
+				"The link expires in %d hours. If you didn't create an account, you can ignore this email.\n",
+			username, apiURL, url.QueryEscape(token), int(emailVerificationTTL.Hours()),
+		),
+	})
+}
+
+// VerifyEmail marks the email of whoever the token in a verification link
+// belongs to as verified. It needs no login.
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Missing token", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var verificationID, userID int64
+	err = tx.QueryRow(`
+		SELECT id, user_id FROM email_verifications
+		WHERE token_hash = ? AND used_at IS NULL AND julianday(expires_at) > julianday('now')`,
+		hashToken(token),
+	).Scan(&verificationID, &userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Verification link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec("UPDATE email_verifications SET used_at = ? WHERE id = ?", now, verificationID); err != nil {
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(
+		"UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL",
+		now, userID,
+	)
+	if err != nil {
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("Your email is verified."))
+}
+
+// ResendEmailVerification mails the caller a new verification link
+func ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := util.GetUserID(r, w)
+	if err != nil {
+		return
+	}
+
+	var email, username string
+	var verified bool
+	err = sqlite.DB.QueryRow(
+		"SELECT email, username, email_verified_at IS NOT NULL FROM users WHERE id = ?", userID,
+	).Scan(&email, &username, &verified)
+	if err != nil {
+		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+	if verified {
+		http.Error(w, "Your email is already verified", http.StatusConflict)
+		return
+	}
+
+	var lastSent time.Time
+	err = sqlite.DB.QueryRow(`
+		SELECT created_at FROM email_verifications
+		WHERE user_id = ?
+		ORDER BY julianday(created_at) DESC
+		LIMIT 1`,
+		userID,
+	).Scan(&lastSent)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error getting email verifications of user %d: %v", userID, err)
+		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+	if wait := time.Until(lastSent.Add(verificationResendCooldown)); err == nil && wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "A verification email was sent recently, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := sendEmailVerification(int64(userID), email, username); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", userID, err)
+		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
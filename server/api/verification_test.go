@@ -0,0 +1,238 @@
+//go:build sqlite_fts5
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+	"social-network/pkg/mailer"
+	"social-network/util"
+
+	"github.com/gorilla/websocket"
+)
+
+// outbox records the account emails sent until the test ends
+type outbox struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (o *outbox) Send(msg mailer.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+// messages returns the emails sent so far
+func (o *outbox) messages() []mailer.Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]mailer.Message(nil), o.sent...)
+}
+
+func recordMail(t *testing.T) *outbox {
+	o := &outbox{}
+	SetMailer(o)
+	t.Cleanup(func() { SetMailer(&mailer.LogMailer{}) })
+	return o
+}
+
+var mailedToken = regexp.MustCompile(`token=(\S+)`)
+
+// lastToken returns the token in the link of the last email sent
+func (o *outbox) lastToken(t *testing.T) string {
+	t.Helper()
+	sent := o.messages()
+	if len(sent) == 0 {
+		t.Fatal("no email was sent")
+	}
+	match := mailedToken.FindStringSubmatch(sent[len(sent)-1].Body)
+	if match == nil {
+		t.Fatalf("no token in %q", sent[len(sent)-1].Body)
+	}
+	token, _ := url.QueryUnescape(match[1])
+	return token
+}
+
+// postAs runs handler for a POST of target as userID
+func postAs(userID int64, handler http.HandlerFunc, target, body string) *httptest.ResponseRecorder {
+	login := httptest.NewRecorder()
+	util.StartSession(login, uint(userID))
+
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.AddCookie(login.Result().Cookies()[0])
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func verify(token string) int {
+	rec := httptest.NewRecorder()
+	VerifyEmail(rec, httptest.NewRequest(http.MethodGet, "/email/verify?token="+url.QueryEscape(token), nil))
+	return rec.Code
+}
+
+func setCreatedAt(t *testing.T, userID int64, at time.Time) {
+	t.Helper()
+	if _, err := sqlite.DB.Exec("UPDATE users SET created_at = ? WHERE id = ?", at.UTC(), userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerificationGracePeriod(t *testing.T) {
+	sqlitetest.Open(t)
+	user := newTestUser(t, "new_test", false)
+
+	allowed := func() bool {
+		t.Helper()
+		ok, err := emailVerifiedOrInGrace(uint64(user))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if !allowed() {
+		t.Error("a new unverified account is restricted during the grace period")
+	}
+	t.Setenv("EMAIL_VERIFICATION_GRACE", "0s")
+	if allowed() {
+		t.Error("a new unverified account isn't restricted without a grace period")
+	}
+	t.Setenv("EMAIL_VERIFICATION_GRACE", "")
+
+	setCreatedAt(t, user, time.Now().Add(-defaultVerificationGrace-time.Minute))
+	if allowed() {
+		t.Error("an unverified account is allowed after the grace period")
+	}
+	if rec := postAs(user, CreateGroup, "/groups", `{"title":"T","description":"D"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("creating a group after the grace period = %d, want 403", rec.Code)
+	}
+
+	if _, err := sqlite.DB.Exec("UPDATE users SET email_verified_at = ? WHERE id = ?", time.Now().UTC(), user); err != nil {
+		t.Fatal(err)
+	}
+	if !allowed() {
+		t.Error("a verified account is restricted")
+	}
+}
+
+func TestVerificationTokens(t *testing.T) {
+	sqlitetest.Open(t)
+	mail := recordMail(t)
+	user := newTestUser(t, "new_test", false)
+
+	if err := sendEmailVerification(user, "new_test@example.com", "new_test"); err != nil {
+		t.Fatal(err)
+	}
+	first := mail.lastToken(t)
+
+	// A resend voids the first link
+	if _, err := sqlite.DB.Exec("UPDATE email_verifications SET created_at = ? WHERE user_id = ?",
+		time.Now().UTC().Add(-verificationResendCooldown), user); err != nil {
+		t.Fatal(err)
+	}
+	if rec := postAs(user, ResendEmailVerification, "/email/verify/resend", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("resend = %d %s, want 202", rec.Code, rec.Body)
+	}
+	second := mail.lastToken(t)
+	if code := verify(first); code != http.StatusBadRequest {
+		t.Errorf("verifying with a replaced link = %d, want 400", code)
+	}
+
+	// Expired links don't work
+	if _, err := sqlite.DB.Exec("UPDATE email_verifications SET expires_at = ? WHERE token_hash = ?",
+		time.Now().UTC().Add(-time.Minute), hashToken(second)); err != nil {
+		t.Fatal(err)
+	}
+	if code := verify(second); code != http.StatusBadRequest {
+		t.Errorf("verifying with an expired link = %d, want 400", code)
+	}
+	if _, err := sqlite.DB.Exec("UPDATE email_verifications SET expires_at = ? WHERE token_hash = ?",
+		time.Now().UTC().Add(time.Hour), hashToken(second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := verify(second); code != http.StatusOK {
+		t.Fatalf("verifying = %d, want 200", code)
+	}
+	var verified bool
+	sqlite.DB.QueryRow("SELECT email_verified_at IS NOT NULL FROM users WHERE id = ?", user).Scan(&verified)
+	if !verified {
+		t.Error("the email isn't verified")
+	}
+	if code := verify(second); code != http.StatusBadRequest {
+		t.Errorf("reusing a link = %d, want 400", code)
+	}
+
+	if rec := postAs(user, ResendEmailVerification, "/email/verify/resend", ""); rec.Code != http.StatusConflict {
+		t.Errorf("resending once verified = %d, want 409", rec.Code)
+	}
+}
+
+func TestResendVerificationCooldown(t *testing.T) {
+	sqlitetest.Open(t)
+	mail := recordMail(t)
+	user := newTestUser(t, "new_test", false)
+
+	if rec := postAs(user, ResendEmailVerification, "/email/verify/resend", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("first resend = %d, want 202", rec.Code)
+	}
+	rec := postAs(user, ResendEmailVerification, "/email/verify/resend", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("resending right away = %d (Retry-After %q), want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if sent := mail.messages(); len(sent) != 1 {
+		t.Errorf("sent %d emails, want 1", len(sent))
+	}
+}
+
+func TestUnverifiedDirectMessageGetsErrorFrame(t *testing.T) {
+	sqlitetest.Open(t)
+	sender := newTestUser(t, "sender_test", false)
+	setCreatedAt(t, sender, time.Now().Add(-defaultVerificationGrace-time.Minute))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		handleDirectMessage(conn, uint64(sender), 2, "hello")
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var frame struct {
+		Type        string `json:"type"`
+		RecipientID int64  `json:"recipient_id"`
+		Content     string `json:"content"`
+	}
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("reading the reply: %v", err)
+	}
+	if frame.Type != MessageTypeError || frame.RecipientID != 2 || !strings.Contains(frame.Content, "Verify your email") {
+		t.Errorf("reply = %+v, want an error frame for the conversation with user 2", frame)
+	}
+
+	var stored int
+	sqlite.DB.QueryRow("SELECT COUNT(*) FROM chat_messages WHERE sender_id = ?", sender).Scan(&stored)
+	if stored != 0 {
+		t.Errorf("stored %d messages from the unverified sender", stored)
+	}
+}
@@ -6,9 +6,13 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"social-network/api"
 	"social-network/pkg/db/sqlite"
+	"social-network/pkg/digest"
+	"social-network/pkg/mailer"
+	"social-network/pkg/notifications"
 	"social-network/util"
 	"social-network/middleware"
 )
@@ -32,7 +36,7 @@ func authMiddleware(next http.Handler) http.Handler {
 		cookieValue := cookie.Value
 
 		// check if the cookie exists in the already active sessions
-		if _, ok := util.UserSession[cookieValue]; !ok {
+		if _, ok := util.SessionUser(cookieValue); !ok {
 			http.Error(w, "Unauthorized user", http.StatusUnauthorized)
 			return
 		}
@@ -49,6 +53,9 @@ func main() {
 
 	defer sqlite.DB.Close()
 
+	// Let the notification service push over the websocket connections
+	notifications.SetPublisher(api.SendToUser)
+
 	var arg string
 
 	// check if an argument is passed
@@ -72,6 +79,17 @@ func main() {
 		return
 	}
 
+	// Send notifications to browsers through Web Push
+	if err := api.InitWebPush(&http.Client{Timeout: 10 * time.Second}); err != nil {
+		log.Printf("Web Push disabled: %v", err)
+	}
+
+	mail := mailer.FromEnv()
+	api.SetMailer(mail)
+
+	// Email unread notifications to users who are away
+	digest.Start(mail)
+
 	mux := http.NewServeMux()
 
 	// Add CORS middleware
@@ -82,6 +100,10 @@ func main() {
 	mux.HandleFunc("POST /register", api.RegisterHandler)
 	mux.HandleFunc("POST /login", api.LoginHandler)
 	mux.HandleFunc("POST /logout", api.LogoutHandler)
+	mux.HandleFunc("POST /password/forgot", api.ForgotPassword)
+	mux.HandleFunc("POST /password/reset", api.ResetPassword)
+	mux.HandleFunc("GET /email/verify", api.VerifyEmail)
+	mux.Handle("POST /email/verify/resend", authMiddleware(http.HandlerFunc(api.ResendEmailVerification)))
 	mux.HandleFunc("POST /userID", api.GetUserIDED) // BY NAME 
 	mux.HandleFunc("GET /userIDBY", api.GetUserIDBY) // BY itself
 	mux.HandleFunc("GET /userName", func(w http.ResponseWriter, r *http.Request) {
@@ -128,14 +150,16 @@ func main() {
 	mux.Handle("POST /event/rsvp",authMiddleware( http.HandlerFunc(api.RSVPEvent)))
 	mux.Handle("GET /event/rsvps/{id}", http.HandlerFunc(api.GetRSVPs))
 	mux.Handle("POST /groups/pendingUsers", authMiddleware(http.HandlerFunc(api.GetPendingUsers)))
-	mux.Handle("POST /groups/getnonmembers", (http.HandlerFunc(api.GetnonMembers)))
+	mux.Handle("POST /groups/getnonmembers", authMiddleware(http.HandlerFunc(api.GetnonMembers)))
 	mux.Handle("POST /groups/getMembers", authMiddleware(http.HandlerFunc(api.GetMembers)))
 	mux.Handle("POST /groups/ismember", (http.HandlerFunc(api.IsMember)))
 	mux.Handle("POST /follow", authMiddleware(http.HandlerFunc(api.RequestFollowUser)))
 	mux.Handle("POST /Unfollow", authMiddleware(http.HandlerFunc(api.UnfollowUser)))
-	mux.Handle("PATCH /follow/request/{id}", authMiddleware(http.HandlerFunc(api.AcceptOrRejectRequest))) 
-	mux.Handle("PATCH /follow/requestF/{id}", authMiddleware(http.HandlerFunc(api.HandelAcceptOrRejectRequest))) 
+	mux.Handle("PATCH /follow/requests/{id}", authMiddleware(http.HandlerFunc(api.RespondToFollowRequest)))
+	mux.Handle("DELETE /follow/requests/{id}", authMiddleware(http.HandlerFunc(api.CancelFollowRequest)))
 	mux.Handle("GET /followers", authMiddleware(http.HandlerFunc(api.GetFollowers)))
+	mux.Handle("GET /followers/{userId}", authMiddleware(http.HandlerFunc(api.GetFollowers)))
+	mux.Handle("DELETE /followers/{id}", authMiddleware(http.HandlerFunc(api.RemoveFollower)))
 	mux.Handle("POST /CloseFriend", authMiddleware(http.HandlerFunc(api.CloseFriend)))
 	mux.Handle("GET /followStatus", authMiddleware(http.HandlerFunc(api.GetFollowstatus)))
 	mux.Handle("GET /followRequest", authMiddleware(http.HandlerFunc(api.FollowRequestHandler)))
@@ -143,9 +167,22 @@ func main() {
 	mux.Handle("GET /user/{userID}", authMiddleware(http.HandlerFunc(api.UserProfile)))
 
 	mux.Handle("/ws", authMiddleware(http.HandlerFunc(api.WebSocketHandler)))
+	mux.Handle("GET /events", authMiddleware(http.HandlerFunc(api.EventsHandler)))
+
+	mux.Handle("GET /push/public-key", authMiddleware(http.HandlerFunc(api.GetPushPublicKey)))
+	mux.Handle("POST /push/subscriptions", authMiddleware(http.HandlerFunc(api.CreatePushSubscription)))
+	mux.Handle("DELETE /push/subscriptions", authMiddleware(http.HandlerFunc(api.DeletePushSubscription)))
 
 	mux.Handle("GET /users/suggested", authMiddleware(http.HandlerFunc(api.GetSuggestedUsers)))
+	mux.Handle("POST /users/suggested/{id}/dismiss", authMiddleware(http.HandlerFunc(api.DismissSuggestion)))
+	mux.Handle("GET /users/{id}/mutuals", authMiddleware(http.HandlerFunc(api.GetMutuals)))
+	mux.Handle("GET /users/blocked", authMiddleware(http.HandlerFunc(api.GetBlockedUsers)))
+	mux.Handle("POST /users/{id}/block", authMiddleware(http.HandlerFunc(api.BlockUser)))
+	mux.Handle("DELETE /users/{id}/block", authMiddleware(http.HandlerFunc(api.UnblockUser)))
 	mux.Handle("GET /AllUsers", authMiddleware(http.HandlerFunc(api.GetAllUsers)))
+	mux.Handle("GET /search", authMiddleware(http.HandlerFunc(api.Search)))
+	mux.Handle("GET /tags/trending", authMiddleware(http.HandlerFunc(api.GetTrendingTags)))
+	mux.Handle("GET /tags/{tag}", authMiddleware(http.HandlerFunc(api.GetTagPosts)))
 
 	mux.Handle("GET /chat/users", authMiddleware(http.HandlerFunc(api.GetChatUsers)))
 	mux.Handle("GET /messages", authMiddleware(http.HandlerFunc(api.GetChatMessages)))
@@ -153,13 +190,28 @@ func main() {
 	mux.Handle("GET /posts/user/{id}", authMiddleware(http.HandlerFunc(api.GetUserPosts)))
 
 	mux.Handle("POST /user/privacy", authMiddleware(http.HandlerFunc(api.UpdatePrivacySettings)))
+	mux.Handle("PATCH /user/profile", authMiddleware(http.HandlerFunc(api.UpdateProfile)))
+	mux.Handle("PATCH /user/username", authMiddleware(http.HandlerFunc(api.ChangeUsername)))
+	mux.Handle("POST /user/password", authMiddleware(http.HandlerFunc(api.ChangePassword)))
+	mux.Handle("GET /user/by-username/{username}", authMiddleware(http.HandlerFunc(api.UserByUsername)))
 
 	mux.Handle("GET /notifications", authMiddleware(http.HandlerFunc(api.GetNotifications)))
+	mux.Handle("GET /notifications/unread-count", authMiddleware(http.HandlerFunc(api.GetUnreadCount)))
+	mux.Handle("POST /notifications/read-all", authMiddleware(http.HandlerFunc(api.MarkAllNotificationsRead)))
 
 	mux.Handle("POST /notifications/{id}/read", authMiddleware(http.HandlerFunc(api.MarkNotificationRead)))
 
 	mux.Handle("POST /notifications/{id}/clear", authMiddleware(http.HandlerFunc(api.ClearNotification)))
 	mux.Handle("POST /notifications/clear-all", authMiddleware(http.HandlerFunc(api.ClearAllNotifications)))
+	mux.Handle("GET /notifications/preferences", authMiddleware(http.HandlerFunc(api.GetNotificationPreferences)))
+	mux.Handle("PUT /notifications/preferences", authMiddleware(http.HandlerFunc(api.UpdateNotificationPreferences)))
+	mux.Handle("GET /notifications/digest", authMiddleware(http.HandlerFunc(api.GetDigestSettings)))
+	mux.Handle("PUT /notifications/digest", authMiddleware(http.HandlerFunc(api.UpdateDigestSettings)))
+	mux.HandleFunc("GET /digest/unsubscribe", api.UnsubscribeDigest)
+
+	mux.Handle("GET /mutes", authMiddleware(http.HandlerFunc(api.GetMutes)))
+	mux.Handle("POST /mutes", authMiddleware(http.HandlerFunc(api.CreateMute)))
+	mux.Handle("DELETE /mutes/{id}", authMiddleware(http.HandlerFunc(api.DeleteMute)))
 
 	mux.Handle("/ws/chat", authMiddleware(http.HandlerFunc(api.ChatWebSocketHandler)))
 
@@ -169,11 +221,13 @@ func main() {
 	mux.Handle("/ws/likes", authMiddleware(http.HandlerFunc(api.LikeWebSocketHandler)))
 
 	mux.Handle("GET /following/{userId}", authMiddleware(http.HandlerFunc(api.GetFollowing)))
-	mux.Handle("GET /following", authMiddleware(http.HandlerFunc(api.GetFollowingBYIt)))
+	mux.Handle("GET /following", authMiddleware(http.HandlerFunc(api.GetFollowing)))
 
 	mux.Handle("GET /comments/{postID}/count", authMiddleware(http.HandlerFunc(api.GetCommentCount)))
 
 	mux.Handle("GET /groups/messages", authMiddleware(http.HandlerFunc(api.GetGroupChatMessages)))
+	mux.Handle("GET /groups/messages/around", authMiddleware(http.HandlerFunc(api.GetGroupChatContext)))
+	mux.Handle("GET /groups/messages/search", authMiddleware(http.HandlerFunc(api.SearchGroupChatMessages)))
 
 	mux.Handle("/ws/group-chat", authMiddleware(http.HandlerFunc(api.GroupChatHandler)))
 
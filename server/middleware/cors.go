@@ -9,6 +9,7 @@ func CORS(next http.Handler) http.Handler {
         w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
         w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept")
         w.Header().Set("Access-Control-Allow-Credentials", "true")
+        w.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor")
 
         // Handle preflight requests
         if r.Method == "OPTIONS" {
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// BlockedUser is an entry of the caller's block list
+type BlockedUser struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Avatar    string    `json:"avatar,omitempty"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
@@ -17,4 +17,14 @@ type Group_messages struct {
 	Content string `json:"content,omitempty"`
 	Media string `json:"media,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
-}
\ No newline at end of file
+}
+
+// GroupChatMessage is a stored group chat message as returned by the history endpoints
+type GroupChatMessage struct {
+	ID        int64     `json:"id"`
+	GroupID   int64     `json:"group_id"`
+	SenderID  int64     `json:"sender_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	Username  string    `json:"username"`
+}
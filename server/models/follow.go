@@ -14,6 +14,7 @@ type Follow struct {
 
 type FollowRequest struct {
 	ID         int    `json:"id"`
+	FollowerID int    `json:"follower_id"`
 	FollowedID int    `json:"followed_id"`
 	Username   string `json:"username"`
 	Avatar     string `json:"avatar"`
@@ -24,6 +25,21 @@ type FollowResponse struct {
 	Message string `json:"message"`
 }
 
+// Follow update statuses, sent to the other user when a follow is undone
+const (
+	FollowCancelled = "cancelled"
+	FollowRemoved   = "removed"
+)
+
+// FollowUpdate tells a user that a follow between them and someone else
+// changed without them acting on it
+type FollowUpdate struct {
+	FollowerID int    `json:"follower_id"`
+	FollowedID int    `json:"followed_id"`
+	Status     string `json:"status"`
+}
+
+// CloseFriends replaces the caller's whole close friends list
 type CloseFriends struct {
-	Usernames []string `json:"selectedUsers"`
+	UserIDs []int `json:"user_ids"`
 }
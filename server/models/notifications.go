@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+    "fmt"
+    "time"
+)
 
 type Notification struct {
     ID         int       `json:"id"`          
@@ -11,6 +14,27 @@ type Notification struct {
     GroupID    int       `json:"group_id,omitempty"` 
     CreatedAt  time.Time `json:"created_at"`  
     Type       string    `json:"type"`       
+    // IdempotencyKey identifies the event behind a notification so retries
+    // and double submits don't notify twice
+    IdempotencyKey string `json:"-"`
+    // TargetType and TargetID name what the notification is about. Unread
+    // notifications of an aggregated type with the same target are folded
+    // into one, listing the most recent actors.
+    TargetType string              `json:"target_type,omitempty"`
+    TargetID   int                 `json:"target_id,omitempty"`
+    Actors     []NotificationActor `json:"actors,omitempty"`
+    ActorCount int                 `json:"actor_count"`
+    UpdatedAt  time.Time           `json:"updated_at"`
+    // Seq increases with every change to the recipient's notifications,
+    // including folds, and is the event id on /events
+    Seq int `json:"-"`
+}
+
+// NotificationActor is a user who caused a notification
+type NotificationActor struct {
+    ID       int    `json:"id"`
+    Username string `json:"username"`
+    Avatar   string `json:"avatar,omitempty"`
 }
 
 const (
@@ -22,4 +46,113 @@ const (
     NotificationGroupRequest = "group_request"
     NotificationGroupAccept = "group_accept"
     NotificationGroupReject = "group_reject"
+    NotificationMention = "mention"
+    NotificationChatMention = "chat_mention"
+    NotificationPostLike = "post_like"
+    NotificationPostComment = "post_comment"
+    NotificationGroupPost = "group_post"
+    NotificationGroupPostComment = "group_post_comment"
+)
+
+// NotificationAccountLocked warns a user that their account was locked after
+// too many failed logins. It is left out of NotificationTypes so it can't be
+// turned off.
+const NotificationAccountLocked = "account_locked"
+
+// NotificationTypes lists every type a user can set preferences for
+var NotificationTypes = []string{
+    NotificationTypeFollow,
+    NotificationTypeAccept,
+    NotificationTypeReject,
+    NotificationEvent,
+    NotificationGroupInvite,
+    NotificationGroupRequest,
+    NotificationGroupAccept,
+    NotificationGroupReject,
+    NotificationMention,
+    NotificationChatMention,
+    NotificationPostLike,
+    NotificationPostComment,
+    NotificationGroupPost,
+    NotificationGroupPostComment,
+}
+
+// IsNotificationType reports whether t is one of NotificationTypes
+func IsNotificationType(t string) bool {
+    for _, known := range NotificationTypes {
+        if t == known {
+            return true
+        }
+    }
+    return false
+}
+
+// IsPersistedNotificationType reports whether t is a type notifications are
+// stored with, including those users can't set preferences for
+func IsPersistedNotificationType(t string) bool {
+    return IsNotificationType(t) || t == NotificationAccountLocked
+}
+
+// NotificationTargetGroup is the target of notifications about a group as a
+// whole, such as new events. Content targets use the Source* constants.
+const NotificationTargetGroup = "group"
+
+// aggregateActions describes what the other actors did when notifications of
+// a type are folded together, e.g. "Alice and 4 others <action>"
+var aggregateActions = map[string]string{
+    NotificationEvent:            "scheduled new events in your group",
+    NotificationPostLike:         "liked your post",
+    NotificationPostComment:      "commented on your post",
+    NotificationGroupPost:        "posted in your group",
+    NotificationGroupPostComment: "commented on your group post",
+}
+
+// IsAggregatedNotification reports whether notifications of type t with the
+// same target are folded into one
+func IsAggregatedNotification(t string) bool {
+    _, ok := aggregateActions[t]
+    return ok
+}
+
+// AggregateContent builds the text of a folded notification from the latest
+// actor and how many others took part
+func AggregateContent(t, latestActor string, others int) string {
+    if others == 1 {
+        return fmt.Sprintf("%s and 1 other %s", latestActor, aggregateActions[t])
+    }
+    return fmt.Sprintf("%s and %d others %s", latestActor, others, aggregateActions[t])
+}
+
+// IsActionableNotification reports whether a notification type asks the
+// recipient to respond, such as accepting a follow request or an invitation
+func IsActionableNotification(t string) bool {
+    return t == NotificationTypeFollow || t == NotificationGroupInvite || t == NotificationGroupRequest
+}
+
+type NotificationPreference struct {
+    Type   string `json:"type"`
+    InApp  bool   `json:"in_app"`
+    Push   bool   `json:"push"`
+    Digest bool   `json:"digest"`
+}
+
+const (
+    MuteTargetGroup        = "group"
+    MuteTargetConversation = "conversation"
+    MuteTargetUser         = "user"
 )
+
+// IsMuteTarget reports whether t is a kind of thing that can be muted
+func IsMuteTarget(t string) bool {
+    return t == MuteTargetGroup || t == MuteTargetConversation || t == MuteTargetUser
+}
+
+// Mute silences a group, a direct conversation or a user. A nil ExpiresAt
+// mutes until the mute is deleted.
+type Mute struct {
+    ID         int        `json:"id"`
+    TargetType string     `json:"target_type"`
+    TargetID   int        `json:"target_id"`
+    ExpiresAt  *time.Time `json:"expires_at"`
+    CreatedAt  time.Time  `json:"created_at"`
+}
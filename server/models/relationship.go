@@ -0,0 +1,32 @@
+package models
+
+// Relationship summarizes how the caller is connected to another user. The
+// samples hold a few of the mutual followers and shared groups; the counts
+// cover all of them.
+type Relationship struct {
+	FollowsYou          bool          `json:"follows_you"`
+	IsCloseFriend       bool          `json:"is_close_friend"`
+	MutualFollowers     []MutualUser  `json:"mutual_followers"`
+	MutualFollowerCount int           `json:"mutual_followers_count"`
+	SharedGroups        []SharedGroup `json:"shared_groups"`
+	SharedGroupCount    int           `json:"shared_groups_count"`
+}
+
+// MutualUser is someone the caller follows who also follows another user
+type MutualUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Avatar   string `json:"avatar,omitempty"`
+}
+
+// SharedGroup is a group two users are both members of
+type SharedGroup struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+// Mutuals is a page of GET /users/{id}/mutuals
+type Mutuals struct {
+	Count int          `json:"count"`
+	Users []MutualUser `json:"users"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Search result types returned by GET /search
+const (
+	SearchTypeAll      = "all"
+	SearchTypeUsers    = "users"
+	SearchTypePosts    = "posts"
+	SearchTypeGroups   = "groups"
+	SearchTypeMessages = "messages"
+)
+
+type UserSearchResult struct {
+	ID        uint   `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	AboutMe   string `json:"about_me,omitempty"`
+	Avatar    string `json:"avatar,omitempty"`
+	IsPrivate bool   `json:"is_private"`
+}
+
+type PostSearchResult struct {
+	ID         int64     `json:"id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Privacy    int       `json:"privacy,omitempty"`
+	Author     int64     `json:"author"`
+	AuthorName string    `json:"author_name"`
+	GroupID    int64     `json:"group_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type MessageSearchResult struct {
+	ID          int64     `json:"id"`
+	SenderID    int64     `json:"sender_id"`
+	RecipientID int64     `json:"recipient_id"`
+	Content     string    `json:"content"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// SuggestedUser is a user the caller may want to follow. Reason explains the
+// strongest thing they have in common, such as "3 mutual followers".
+type SuggestedUser struct {
+	ID              uint   `json:"id"`
+	Username        string `json:"username"`
+	Avatar          string `json:"avatar,omitempty"`
+	Online          bool   `json:"online"`
+	Reason          string `json:"reason"`
+	MutualFollowers int    `json:"mutual_followers"`
+	SharedGroups    int    `json:"shared_groups"`
+	SharedEvents    int    `json:"shared_events"`
+}
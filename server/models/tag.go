@@ -0,0 +1,17 @@
+package models
+
+// Kinds of content hashtags and mentions are parsed from
+const (
+	SourcePost             = "post"
+	SourceComment          = "comment"
+	SourceGroupPost        = "group_post"
+	SourceGroupPostComment = "group_post_comment"
+	SourceChatMessage      = "chat_message"
+	SourceGroupChatMessage = "group_chat_message"
+)
+
+type TrendingTag struct {
+	Tag     string `json:"tag"`
+	Uses    int    `json:"uses"`
+	Authors int    `json:"authors"`
+}
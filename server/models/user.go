@@ -36,3 +36,38 @@ func DoesUserExist(userID uint, db *sql.DB) (bool, error) {
 
 	return true, nil
 }
+
+// PrivacySettings is the result of a privacy change. AcceptedRequests counts
+// the pending follow requests accepted when the account went public, and
+// Followers lists the current followers for review when it went private.
+type PrivacySettings struct {
+	IsPrivate        bool     `json:"is_private"`
+	AcceptedRequests int      `json:"accepted_requests"`
+	Followers        []Follow `json:"followers,omitempty"`
+}
+
+// Visibility of an optional profile field
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityOnlyMe    = "only_me"
+)
+
+// IsVisibility reports whether v is a valid profile field visibility
+func IsVisibility(v string) bool {
+	return v == VisibilityPublic || v == VisibilityFollowers || v == VisibilityOnlyMe
+}
+
+// EditableProfile holds the profile fields a user can change. In a
+// PATCH /user/profile request nil fields are left as they are; an empty
+// avatar removes it.
+type EditableProfile struct {
+	FirstName          *string `json:"first_name"`
+	LastName           *string `json:"last_name"`
+	AboutMe            *string `json:"about_me"`
+	DateOfBirth        *string `json:"date_of_birth"`
+	Avatar             *string `json:"avatar"`
+	EmailVisibility    *string `json:"email_visibility"`
+	BirthdayVisibility *string `json:"birthday_visibility"`
+	AboutMeVisibility  *string `json:"about_me_visibility"`
+}
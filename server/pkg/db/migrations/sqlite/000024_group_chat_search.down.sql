@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS group_chat_messages_fts_insert;
+DROP TRIGGER IF EXISTS group_chat_messages_fts_delete;
+DROP TRIGGER IF EXISTS group_chat_messages_fts_update;
+DROP TABLE IF EXISTS group_chat_messages_fts;
+DROP INDEX IF EXISTS idx_group_chat_messages_group_id;
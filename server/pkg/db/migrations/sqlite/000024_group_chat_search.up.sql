@@ -0,0 +1,33 @@
+-- Keyset pagination walks group chat history by id inside a group
+CREATE INDEX IF NOT EXISTS idx_group_chat_messages_group_id ON group_chat_messages(group_id, id);
+
+-- Full-text index over group chat history (requires the sqlite_fts5 build tag)
+CREATE VIRTUAL TABLE IF NOT EXISTS group_chat_messages_fts USING fts5(
+    content,
+    content='group_chat_messages',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+-- Keep the index in sync with the messages table
+CREATE TRIGGER IF NOT EXISTS group_chat_messages_fts_insert
+AFTER INSERT ON group_chat_messages
+BEGIN
+    INSERT INTO group_chat_messages_fts (rowid, content) VALUES (NEW.id, NEW.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS group_chat_messages_fts_delete
+AFTER DELETE ON group_chat_messages
+BEGIN
+    INSERT INTO group_chat_messages_fts (group_chat_messages_fts, rowid, content) VALUES ('delete', OLD.id, OLD.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS group_chat_messages_fts_update
+AFTER UPDATE OF content ON group_chat_messages
+BEGIN
+    INSERT INTO group_chat_messages_fts (group_chat_messages_fts, rowid, content) VALUES ('delete', OLD.id, OLD.content);
+    INSERT INTO group_chat_messages_fts (rowid, content) VALUES (NEW.id, NEW.content);
+END;
+
+-- Index the messages that already exist
+INSERT INTO group_chat_messages_fts (group_chat_messages_fts) VALUES ('rebuild');
@@ -0,0 +1,154 @@
+-- Full-text indexes backing GET /search (requires the sqlite_fts5 build tag).
+-- Each index mirrors its source table and is kept in sync by triggers.
+
+-- Users
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+    username,
+    first_name,
+    last_name,
+    about_me,
+    content='users',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS users_fts_insert
+AFTER INSERT ON users
+BEGIN
+    INSERT INTO users_fts (rowid, username, first_name, last_name, about_me)
+    VALUES (NEW.id, NEW.username, NEW.first_name, NEW.last_name, NEW.about_me);
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_delete
+AFTER DELETE ON users
+BEGIN
+    INSERT INTO users_fts (users_fts, rowid, username, first_name, last_name, about_me)
+    VALUES ('delete', OLD.id, OLD.username, OLD.first_name, OLD.last_name, OLD.about_me);
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_update
+AFTER UPDATE OF username, first_name, last_name, about_me ON users
+BEGIN
+    INSERT INTO users_fts (users_fts, rowid, username, first_name, last_name, about_me)
+    VALUES ('delete', OLD.id, OLD.username, OLD.first_name, OLD.last_name, OLD.about_me);
+    INSERT INTO users_fts (rowid, username, first_name, last_name, about_me)
+    VALUES (NEW.id, NEW.username, NEW.first_name, NEW.last_name, NEW.about_me);
+END;
+
+-- Posts
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+    title,
+    content,
+    content='posts',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_insert
+AFTER INSERT ON posts
+BEGIN
+    INSERT INTO posts_fts (rowid, title, content) VALUES (NEW.id, NEW.title, NEW.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_delete
+AFTER DELETE ON posts
+BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, title, content) VALUES ('delete', OLD.id, OLD.title, OLD.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_update
+AFTER UPDATE OF title, content ON posts
+BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, title, content) VALUES ('delete', OLD.id, OLD.title, OLD.content);
+    INSERT INTO posts_fts (rowid, title, content) VALUES (NEW.id, NEW.title, NEW.content);
+END;
+
+-- Group posts
+CREATE VIRTUAL TABLE IF NOT EXISTS group_posts_fts USING fts5(
+    title,
+    content,
+    content='group_posts',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS group_posts_fts_insert
+AFTER INSERT ON group_posts
+BEGIN
+    INSERT INTO group_posts_fts (rowid, title, content) VALUES (NEW.id, NEW.title, NEW.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS group_posts_fts_delete
+AFTER DELETE ON group_posts
+BEGIN
+    INSERT INTO group_posts_fts (group_posts_fts, rowid, title, content) VALUES ('delete', OLD.id, OLD.title, OLD.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS group_posts_fts_update
+AFTER UPDATE OF title, content ON group_posts
+BEGIN
+    INSERT INTO group_posts_fts (group_posts_fts, rowid, title, content) VALUES ('delete', OLD.id, OLD.title, OLD.content);
+    INSERT INTO group_posts_fts (rowid, title, content) VALUES (NEW.id, NEW.title, NEW.content);
+END;
+
+-- Groups
+CREATE VIRTUAL TABLE IF NOT EXISTS groups_fts USING fts5(
+    title,
+    description,
+    content='groups',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_insert
+AFTER INSERT ON groups
+BEGIN
+    INSERT INTO groups_fts (rowid, title, description) VALUES (NEW.id, NEW.title, NEW.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_delete
+AFTER DELETE ON groups
+BEGIN
+    INSERT INTO groups_fts (groups_fts, rowid, title, description) VALUES ('delete', OLD.id, OLD.title, OLD.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_update
+AFTER UPDATE OF title, description ON groups
+BEGIN
+    INSERT INTO groups_fts (groups_fts, rowid, title, description) VALUES ('delete', OLD.id, OLD.title, OLD.description);
+    INSERT INTO groups_fts (rowid, title, description) VALUES (NEW.id, NEW.title, NEW.description);
+END;
+
+-- Direct chat messages
+CREATE VIRTUAL TABLE IF NOT EXISTS chat_messages_fts USING fts5(
+    content,
+    content='chat_messages',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS chat_messages_fts_insert
+AFTER INSERT ON chat_messages
+BEGIN
+    INSERT INTO chat_messages_fts (rowid, content) VALUES (NEW.id, NEW.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS chat_messages_fts_delete
+AFTER DELETE ON chat_messages
+BEGIN
+    INSERT INTO chat_messages_fts (chat_messages_fts, rowid, content) VALUES ('delete', OLD.id, OLD.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS chat_messages_fts_update
+AFTER UPDATE OF content ON chat_messages
+BEGIN
+    INSERT INTO chat_messages_fts (chat_messages_fts, rowid, content) VALUES ('delete', OLD.id, OLD.content);
+    INSERT INTO chat_messages_fts (rowid, content) VALUES (NEW.id, NEW.content);
+END;
+
+-- Index the rows that already exist
+INSERT INTO users_fts (users_fts) VALUES ('rebuild');
+INSERT INTO posts_fts (posts_fts) VALUES ('rebuild');
+INSERT INTO group_posts_fts (group_posts_fts) VALUES ('rebuild');
+INSERT INTO groups_fts (groups_fts) VALUES ('rebuild');
+INSERT INTO chat_messages_fts (chat_messages_fts) VALUES ('rebuild');
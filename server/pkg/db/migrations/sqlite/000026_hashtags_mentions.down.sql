@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_mentions_source;
+DROP TABLE IF EXISTS mentions;
+DROP INDEX IF EXISTS idx_hashtags_created_at;
+DROP TABLE IF EXISTS hashtags;
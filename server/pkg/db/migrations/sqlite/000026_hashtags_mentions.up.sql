@@ -0,0 +1,25 @@
+-- Hashtags and @mentions parsed out of posts, comments and chat messages when
+-- they are written. source_type is one of: post, comment, group_post,
+-- group_post_comment, chat_message, group_chat_message.
+CREATE TABLE IF NOT EXISTS hashtags (
+    tag TEXT NOT NULL,
+    source_type TEXT NOT NULL,
+    source_id INTEGER NOT NULL,
+    author INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tag, source_type, source_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hashtags_created_at ON hashtags(created_at);
+
+CREATE TABLE IF NOT EXISTS mentions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source_type TEXT NOT NULL,
+    source_id INTEGER NOT NULL,
+    author INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, source_type, source_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_source ON mentions(source_type, source_id);
@@ -0,0 +1,57 @@
+-- Restore the follow notification triggers from migration 14
+DROP TRIGGER IF EXISTS create_follow_notification;
+DROP TRIGGER IF EXISTS follow_request_response_notification;
+
+CREATE TRIGGER IF NOT EXISTS create_follow_notification
+AFTER INSERT ON followers
+WHEN NEW.status = 'pending'
+BEGIN
+    INSERT INTO notifications (
+        to_user_id,
+        from_user_id,
+        content,
+        type,
+        read,
+        created_at
+    )
+    SELECT
+        NEW.followed_id,
+        NEW.follower_id,
+        (SELECT username || ' wants to follow you' FROM users WHERE id = NEW.follower_id),
+        'follow_request',
+        false,
+        DATETIME('now')
+    WHERE EXISTS (
+        SELECT 1 FROM users 
+        WHERE id = NEW.followed_id 
+        AND is_private = true
+    );
+END;
+
+CREATE TRIGGER IF NOT EXISTS follow_request_response_notification
+AFTER UPDATE ON followers
+WHEN OLD.status = 'pending' AND (NEW.status = 'accept' OR NEW.status = 'reject')
+BEGIN
+    INSERT INTO notifications (
+        to_user_id,
+        from_user_id,
+        content,
+        type,
+        read,
+        created_at
+    )
+    SELECT
+        NEW.follower_id,
+        NEW.followed_id,
+        (SELECT username || ' ' || NEW.status || 'ed your follow request' 
+         FROM users WHERE id = NEW.followed_id),
+        CASE NEW.status
+            WHEN 'accept' THEN 'follow_accept'
+            WHEN 'reject' THEN 'follow_reject'
+        END,
+        false,
+        DATETIME('now');
+END;
+
+DROP TABLE IF EXISTS mutes;
+DROP TABLE IF EXISTS notification_preferences;
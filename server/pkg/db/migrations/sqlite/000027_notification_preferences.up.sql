@@ -0,0 +1,88 @@
+-- Per-user notification preferences. A missing row means every channel is on.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    in_app BOOLEAN NOT NULL DEFAULT TRUE,
+    push BOOLEAN NOT NULL DEFAULT TRUE,
+    digest BOOLEAN NOT NULL DEFAULT TRUE,
+    PRIMARY KEY (user_id, type)
+);
+
+-- Groups and direct conversations a user does not want to be notified about.
+-- target_id is a group id or, for conversations, the other user's id.
+CREATE TABLE IF NOT EXISTS mutes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_type TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, target_type, target_id)
+);
+
+-- Recreate the follow notification triggers from migration 14 so they skip
+-- users who turned off in-app notifications of that type.
+DROP TRIGGER IF EXISTS create_follow_notification;
+DROP TRIGGER IF EXISTS follow_request_response_notification;
+
+CREATE TRIGGER IF NOT EXISTS create_follow_notification
+AFTER INSERT ON followers
+WHEN NEW.status = 'pending'
+BEGIN
+    INSERT INTO notifications (
+        to_user_id,
+        from_user_id,
+        content,
+        type,
+        read,
+        created_at
+    )
+    SELECT
+        NEW.followed_id,
+        NEW.follower_id,
+        (SELECT username || ' wants to follow you' FROM users WHERE id = NEW.follower_id),
+        'follow_request',
+        false,
+        DATETIME('now')
+    WHERE EXISTS (
+        SELECT 1 FROM users 
+        WHERE id = NEW.followed_id 
+        AND is_private = true
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM notification_preferences
+        WHERE user_id = NEW.followed_id
+        AND type = 'follow_request'
+        AND in_app = false
+    );
+END;
+
+CREATE TRIGGER IF NOT EXISTS follow_request_response_notification
+AFTER UPDATE ON followers
+WHEN OLD.status = 'pending' AND (NEW.status = 'accept' OR NEW.status = 'reject')
+BEGIN
+    INSERT INTO notifications (
+        to_user_id,
+        from_user_id,
+        content,
+        type,
+        read,
+        created_at
+    )
+    SELECT
+        NEW.follower_id,
+        NEW.followed_id,
+        (SELECT username || ' ' || NEW.status || 'ed your follow request' 
+         FROM users WHERE id = NEW.followed_id),
+        CASE NEW.status
+            WHEN 'accept' THEN 'follow_accept'
+            WHEN 'reject' THEN 'follow_reject'
+        END,
+        false,
+        DATETIME('now')
+    WHERE NOT EXISTS (
+        SELECT 1 FROM notification_preferences
+        WHERE user_id = NEW.follower_id
+        AND type = CASE NEW.status WHEN 'accept' THEN 'follow_accept' ELSE 'follow_reject' END
+        AND in_app = false
+    );
+END;
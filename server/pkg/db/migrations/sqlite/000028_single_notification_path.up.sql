@@ -0,0 +1,21 @@
+-- Notifications are created and pushed by the Go notification service only.
+-- The follow triggers inserted a second copy of every follow request and
+-- wrote accept/reject notifications that were never pushed.
+DROP TRIGGER IF EXISTS create_follow_notification;
+DROP TRIGGER IF EXISTS follow_request_response_notification;
+
+-- Keep one follow request notification per pair of users
+DELETE FROM notifications
+WHERE type = 'follow_request'
+AND id NOT IN (
+    SELECT MAX(id) FROM notifications
+    WHERE type = 'follow_request'
+    GROUP BY to_user_id, from_user_id
+);
+
+-- Identifies the event behind a notification so it is only created once
+ALTER TABLE notifications ADD COLUMN idempotency_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_idempotency_key
+ON notifications(idempotency_key)
+WHERE idempotency_key IS NOT NULL;
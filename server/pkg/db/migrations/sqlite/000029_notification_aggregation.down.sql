@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS delete_notification_actors;
+DROP TABLE IF EXISTS notification_actors;
+DROP INDEX IF EXISTS idx_notifications_aggregate;
+
+ALTER TABLE notifications DROP COLUMN updated_at;
+ALTER TABLE notifications DROP COLUMN actor_count;
+ALTER TABLE notifications DROP COLUMN target_id;
+ALTER TABLE notifications DROP COLUMN target_type;
@@ -0,0 +1,42 @@
+-- What a notification is about, so notifications of the same type and target
+-- can be folded into one ("Alice and 4 others liked your post")
+ALTER TABLE notifications ADD COLUMN target_type TEXT;
+ALTER TABLE notifications ADD COLUMN target_id INTEGER;
+ALTER TABLE notifications ADD COLUMN actor_count INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE notifications ADD COLUMN updated_at DATETIME;
+
+UPDATE notifications
+SET updated_at = created_at,
+    actor_count = CASE WHEN from_user_id IS NULL THEN 0 ELSE 1 END;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_aggregate
+ON notifications(to_user_id, type, target_type, target_id)
+WHERE read = false AND target_type IS NOT NULL;
+
+-- One row per event folded into a notification
+CREATE TABLE IF NOT EXISTS notification_actors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    notification_id INTEGER NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    actor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    idempotency_key TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_actors_notification
+ON notification_actors(notification_id, created_at);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notification_actors_idempotency_key
+ON notification_actors(idempotency_key)
+WHERE idempotency_key IS NOT NULL;
+
+INSERT INTO notification_actors (notification_id, actor_id, idempotency_key, created_at)
+SELECT id, from_user_id, idempotency_key, created_at
+FROM notifications
+WHERE from_user_id IS NOT NULL;
+
+-- Foreign keys are not enforced on this connection, so clean up by hand
+CREATE TRIGGER IF NOT EXISTS delete_notification_actors
+AFTER DELETE ON notifications
+BEGIN
+    DELETE FROM notification_actors WHERE notification_id = OLD.id;
+END;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS digest_settings;
+
+ALTER TABLE users DROP COLUMN email_verified_at;
@@ -0,0 +1,14 @@
+-- Emails are only sent to verified addresses. Accounts created before
+-- verification existed are treated as verified.
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
+
+UPDATE users SET email_verified_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+
+-- How often each user gets an email summary of their unread notifications.
+-- Users without a row get the daily digest.
+CREATE TABLE IF NOT EXISTS digest_settings (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    frequency TEXT NOT NULL DEFAULT 'daily' CHECK (frequency IN ('off', 'daily', 'weekly')),
+    last_sent_at DATETIME,
+    unsubscribe_token TEXT NOT NULL UNIQUE
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS vapid_keys;
+DROP INDEX IF EXISTS idx_push_subscriptions_user;
+DROP TABLE IF EXISTS push_subscriptions;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_mutes_user_target;
+
+DELETE FROM mutes WHERE target_type = 'user';
+ALTER TABLE mutes DROP COLUMN expires_at;
@@ -0,0 +1,5 @@
+-- Mutes can now target users as well, and can lapse on their own.
+-- A NULL expires_at mutes until the mute is deleted.
+ALTER TABLE mutes ADD COLUMN expires_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_mutes_user_target ON mutes(user_id, target_type, expires_at);
@@ -0,0 +1,20 @@
+-- Rejected requests did not exist as rows before
+DELETE FROM followers WHERE status = 'reject';
+
+ALTER TABLE followers DROP COLUMN responded_at;
+
+-- Rows migration 34 couldn't map stay out of followers
+DROP TABLE IF EXISTS followers_legacy;
+
+CREATE TRIGGER IF NOT EXISTS prevent_duplicate_follows
+BEFORE INSERT ON followers
+FOR EACH ROW
+WHEN EXISTS (
+    SELECT 1 FROM followers 
+    WHERE follower_id = NEW.follower_id 
+    AND followed_id = NEW.followed_id
+    AND status != 'reject'
+)
+BEGIN
+    SELECT RAISE(ABORT, 'Follow request already exists');
+END;
@@ -0,0 +1,69 @@
+-- Follows now move through the states of pkg/follow. A rejected request is
+-- kept, with the time it was answered, so it can be re-sent after a cooldown.
+-- The duplicate trigger blocked exactly that, and the unique constraint
+-- already keeps one row per pair of users.
+DROP TRIGGER IF EXISTS prevent_duplicate_follows;
+
+-- Databases from before migration 13 can have statuses it doesn't allow.
+-- Map the spellings that mean one of the states, and keep every row that
+-- still doesn't fit in followers_legacy instead of losing it.
+CREATE TEMP VIEW followers_mapped AS
+SELECT id, follower_id, followed_id, status, created_at,
+    CASE lower(trim(status))
+        WHEN 'pending' THEN 'pending'
+        WHEN 'requested' THEN 'pending'
+        WHEN 'request' THEN 'pending'
+        WHEN 'accept' THEN 'accept'
+        WHEN 'accepted' THEN 'accept'
+        WHEN 'approved' THEN 'accept'
+        WHEN 'follow' THEN 'accept'
+        WHEN 'following' THEN 'accept'
+        WHEN 'reject' THEN 'reject'
+        WHEN 'rejected' THEN 'reject'
+        WHEN 'declined' THEN 'reject'
+    END AS state
+FROM followers;
+
+CREATE TABLE IF NOT EXISTS followers_legacy (
+    id INTEGER PRIMARY KEY,
+    follower_id INTEGER,
+    followed_id INTEGER,
+    status TEXT,
+    created_at DATETIME,
+    archived_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO followers_legacy (id, follower_id, followed_id, status, created_at)
+SELECT id, follower_id, followed_id, status, created_at
+FROM followers_mapped
+WHERE state IS NULL;
+
+-- Rebuild the table so every database has the constraints from migration 13,
+-- keeping the latest row of each pair
+CREATE TABLE followers_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    follower_id INTEGER NOT NULL REFERENCES users(id),
+    followed_id INTEGER NOT NULL REFERENCES users(id),
+    status TEXT NOT NULL CHECK (status IN ('pending', 'accept', 'reject')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    responded_at DATETIME,
+    UNIQUE (follower_id, followed_id)
+);
+
+INSERT INTO followers_new (id, follower_id, followed_id, status, created_at, responded_at)
+SELECT id, follower_id, followed_id, state, created_at,
+    CASE WHEN state IN ('accept', 'reject') THEN created_at END
+FROM followers_mapped
+WHERE id IN (
+    SELECT MAX(id) FROM followers_mapped
+    WHERE state IS NOT NULL
+    GROUP BY follower_id, followed_id
+);
+
+DROP VIEW followers_mapped;
+DROP TABLE followers;
+ALTER TABLE followers_new RENAME TO followers;
+
+CREATE INDEX IF NOT EXISTS idx_followers_status ON followers(follower_id, followed_id, status);
+CREATE INDEX IF NOT EXISTS idx_followers_users ON followers(follower_id, followed_id);
+CREATE INDEX IF NOT EXISTS idx_friends ON followers(follower_id, followed_id, status);
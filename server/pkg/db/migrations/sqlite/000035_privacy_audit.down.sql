@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_privacy_audit_user;
+DROP TABLE IF EXISTS privacy_audit;
@@ -0,0 +1,12 @@
+-- Every change of a user's account privacy, with the follow requests that
+-- were accepted because of it
+CREATE TABLE IF NOT EXISTS privacy_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    was_private BOOLEAN NOT NULL,
+    is_private BOOLEAN NOT NULL,
+    accepted_requests INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_privacy_audit_user ON privacy_audit(user_id, created_at);
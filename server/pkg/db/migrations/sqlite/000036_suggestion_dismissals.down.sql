@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_group_event_rsvp_user;
+DROP INDEX IF EXISTS idx_group_members_user;
+DROP INDEX IF EXISTS idx_followers_followed;
+DROP TABLE IF EXISTS suggestion_dismissals;
@@ -0,0 +1,13 @@
+-- Users a user doesn't want to be suggested again
+CREATE TABLE IF NOT EXISTS suggestion_dismissals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    dismissed_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, dismissed_id)
+);
+
+-- Lookups used to rank suggestions by what two users have in common
+CREATE INDEX IF NOT EXISTS idx_followers_followed ON followers(followed_id, status);
+CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(user_id, group_id);
+CREATE INDEX IF NOT EXISTS idx_group_event_rsvp_user ON group_event_RSVP(user_id, event_id);
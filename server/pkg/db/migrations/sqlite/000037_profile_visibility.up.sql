@@ -0,0 +1,8 @@
+-- Who can see each of the optional profile fields: everyone ('public'),
+-- accepted followers ('followers') or the owner alone ('only_me')
+ALTER TABLE users ADD COLUMN email_visibility TEXT NOT NULL DEFAULT 'followers'
+    CHECK (email_visibility IN ('public', 'followers', 'only_me'));
+ALTER TABLE users ADD COLUMN birthday_visibility TEXT NOT NULL DEFAULT 'followers'
+    CHECK (birthday_visibility IN ('public', 'followers', 'only_me'));
+ALTER TABLE users ADD COLUMN about_me_visibility TEXT NOT NULL DEFAULT 'public'
+    CHECK (about_me_visibility IN ('public', 'followers', 'only_me'));
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS post_PrivateViews (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER REFERENCES users(id),
+    close_friends TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO post_PrivateViews (user_id, close_friends)
+SELECT cf.user_id, group_concat(u.username, ',')
+FROM close_friends cf
+JOIN users u ON u.id = cf.friend_id
+GROUP BY cf.user_id;
+
+DROP INDEX IF EXISTS idx_close_friends_friend;
+DROP TABLE IF EXISTS close_friends;
+
+DROP INDEX IF EXISTS idx_username_history_user;
+DROP INDEX IF EXISTS idx_username_history_name;
+DROP TABLE IF EXISTS username_history;
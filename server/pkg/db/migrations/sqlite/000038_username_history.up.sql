@@ -0,0 +1,41 @@
+-- Usernames users had before renaming themselves. An old name keeps leading
+-- to its user, and can't be taken by anyone else, for a grace period.
+CREATE TABLE IF NOT EXISTS username_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_username TEXT NOT NULL,
+    changed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_username_history_name ON username_history(old_username, changed_at);
+CREATE INDEX IF NOT EXISTS idx_username_history_user ON username_history(user_id, changed_at);
+
+-- Close friends were a comma separated list of usernames, which a rename
+-- would break. They are now stored by user id.
+CREATE TABLE IF NOT EXISTS close_friends (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    friend_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, friend_id),
+    CHECK (user_id != friend_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_close_friends_friend ON close_friends(friend_id);
+
+WITH RECURSIVE split (user_id, name, rest) AS (
+    SELECT user_id, '', REPLACE(close_friends, ' ', '') || ','
+    FROM post_PrivateViews
+    WHERE close_friends IS NOT NULL
+    UNION ALL
+    SELECT user_id, substr(rest, 1, instr(rest, ',') - 1), substr(rest, instr(rest, ',') + 1)
+    FROM split
+    WHERE rest != ''
+)
+INSERT OR IGNORE INTO close_friends (user_id, friend_id)
+SELECT s.user_id, u.id
+FROM split s
+JOIN users u ON u.username = s.name
+WHERE s.name != '' AND u.id != s.user_id;
+
+DROP TABLE IF EXISTS post_PrivateViews;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_email_verifications_user;
+DROP TABLE IF EXISTS email_verifications;
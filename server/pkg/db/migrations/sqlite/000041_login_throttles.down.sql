@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_login_throttles_last_failure;
+DROP TABLE IF EXISTS login_throttles;
@@ -0,0 +1,10 @@
+-- Failed logins per account ("account:<email>") and per IP address
+-- ("ip:<address>"). blocked_until is when the next attempt is allowed.
+CREATE TABLE IF NOT EXISTS login_throttles (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at DATETIME NOT NULL,
+    blocked_until DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_throttles_last_failure ON login_throttles(last_failure_at);
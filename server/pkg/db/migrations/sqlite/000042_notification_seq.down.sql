@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_notifications_user_seq;
+
+ALTER TABLE notifications DROP COLUMN seq;
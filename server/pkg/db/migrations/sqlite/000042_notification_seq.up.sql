@@ -0,0 +1,12 @@
+-- seq orders the changes to a user's notifications: it is bumped both when a
+-- notification is created and when another actor is folded into it, so
+-- /events can resume from it. Row ids don't move when a notification is
+-- updated.
+ALTER TABLE notifications ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;
+
+UPDATE notifications SET seq = (
+    SELECT COUNT(*) FROM notifications earlier
+    WHERE earlier.to_user_id = notifications.to_user_id AND earlier.id <= notifications.id
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_seq ON notifications(to_user_id, seq);
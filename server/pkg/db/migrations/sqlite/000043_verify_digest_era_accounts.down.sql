@@ -0,0 +1,2 @@
+-- The backfilled accounts can't be told apart from ones verified since, so
+-- they stay verified.
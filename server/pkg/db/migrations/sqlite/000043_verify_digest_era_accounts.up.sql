@@ -0,0 +1,7 @@
+-- Accounts created after migration 30 and before email verification existed
+-- never had email_verified_at set, so the digest skipped them. They never
+-- got a verification email either, so treat them as verified like the
+-- accounts migration 30 backfilled.
+UPDATE users SET email_verified_at = COALESCE(created_at, CURRENT_TIMESTAMP)
+WHERE email_verified_at IS NULL
+AND NOT EXISTS (SELECT 1 FROM email_verifications ev WHERE ev.user_id = users.id);
@@ -0,0 +1 @@
+ALTER TABLE likes DROP COLUMN liked_at;
@@ -0,0 +1,5 @@
+-- Likes had no timestamp (migration 16 never replaced the table created by
+-- migration 6), so suggestions couldn't tell recent likes apart. liked_at is
+-- set when a post is liked and again when it is liked after an unlike. Older
+-- likes keep it NULL and no longer count as recent.
+ALTER TABLE likes ADD COLUMN liked_at DATETIME;
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS posts_tags_delete;
+DROP TRIGGER IF EXISTS comments_tags_delete;
+DROP TRIGGER IF EXISTS group_posts_tags_delete;
+DROP TRIGGER IF EXISTS group_post_comments_tags_delete;
+DROP TRIGGER IF EXISTS chat_messages_tags_delete;
+DROP TRIGGER IF EXISTS group_chat_messages_tags_delete;
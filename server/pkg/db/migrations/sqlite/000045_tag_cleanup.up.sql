@@ -0,0 +1,58 @@
+-- Hashtags and mentions point at their content by source_type and source_id
+-- rather than a foreign key, so drop them when the content is deleted,
+-- including by a cascade. Rows left behind by content deleted earlier go too.
+
+CREATE TRIGGER IF NOT EXISTS posts_tags_delete
+AFTER DELETE ON posts
+BEGIN
+    DELETE FROM hashtags WHERE source_type = 'post' AND source_id = OLD.id;
+    DELETE FROM mentions WHERE source_type = 'post' AND source_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS comments_tags_delete
+AFTER DELETE ON comments
+BEGIN
+    DELETE FROM hashtags WHERE source_type = 'comment' AND source_id = OLD.id;
+    DELETE FROM mentions WHERE source_type = 'comment' AND source_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS group_posts_tags_delete
+AFTER DELETE ON group_posts
+BEGIN
+    DELETE FROM hashtags WHERE source_type = 'group_post' AND source_id = OLD.id;
+    DELETE FROM mentions WHERE source_type = 'group_post' AND source_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS group_post_comments_tags_delete
+AFTER DELETE ON group_post_comments
+BEGIN
+    DELETE FROM hashtags WHERE source_type = 'group_post_comment' AND source_id = OLD.id;
+    DELETE FROM mentions WHERE source_type = 'group_post_comment' AND source_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS chat_messages_tags_delete
+AFTER DELETE ON chat_messages
+BEGIN
+    DELETE FROM hashtags WHERE source_type = 'chat_message' AND source_id = OLD.id;
+    DELETE FROM mentions WHERE source_type = 'chat_message' AND source_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS group_chat_messages_tags_delete
+AFTER DELETE ON group_chat_messages
+BEGIN
+    DELETE FROM hashtags WHERE source_type = 'group_chat_message' AND source_id = OLD.id;
+    DELETE FROM mentions WHERE source_type = 'group_chat_message' AND source_id = OLD.id;
+END;
+
+DELETE FROM hashtags WHERE source_type = 'post' AND source_id NOT IN (SELECT id FROM posts);
+DELETE FROM mentions WHERE source_type = 'post' AND source_id NOT IN (SELECT id FROM posts);
+DELETE FROM hashtags WHERE source_type = 'comment' AND source_id NOT IN (SELECT id FROM comments);
+DELETE FROM mentions WHERE source_type = 'comment' AND source_id NOT IN (SELECT id FROM comments);
+DELETE FROM hashtags WHERE source_type = 'group_post' AND source_id NOT IN (SELECT id FROM group_posts);
+DELETE FROM mentions WHERE source_type = 'group_post' AND source_id NOT IN (SELECT id FROM group_posts);
+DELETE FROM hashtags WHERE source_type = 'group_post_comment' AND source_id NOT IN (SELECT id FROM group_post_comments);
+DELETE FROM mentions WHERE source_type = 'group_post_comment' AND source_id NOT IN (SELECT id FROM group_post_comments);
+DELETE FROM hashtags WHERE source_type = 'chat_message' AND source_id NOT IN (SELECT id FROM chat_messages);
+DELETE FROM mentions WHERE source_type = 'chat_message' AND source_id NOT IN (SELECT id FROM chat_messages);
+DELETE FROM hashtags WHERE source_type = 'group_chat_message' AND source_id NOT IN (SELECT id FROM group_chat_messages);
+DELETE FROM mentions WHERE source_type = 'group_chat_message' AND source_id NOT IN (SELECT id FROM group_chat_messages);
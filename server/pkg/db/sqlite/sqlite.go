@@ -14,6 +14,10 @@ import (
 
 var DB *sql.DB
 
+// MigrationsPath is where the migrations are, relative to the working
+// directory unless it is absolute
+var MigrationsPath = "pkg/db/migrations/sqlite"
+
 func OpenDB(dbPath string) error {
 	var err error
 	DB, err = sql.Open("sqlite3", dbPath)
@@ -38,7 +42,7 @@ func applyMigrations() error {
 		return fmt.Errorf("could not create driver: %v", err)
 	}
 
-	migrationsPath, err := filepath.Abs("pkg/db/migrations/sqlite")
+	migrationsPath, err := filepath.Abs(MigrationsPath)
 	if err != nil {
 		return fmt.Errorf("could not get migrations path: %v", err)
 	}
@@ -78,7 +82,7 @@ func RollbackMigrations() error {
 		return fmt.Errorf("could not create driver: %v", err)
 	}
 
-	migrationsPath, err := filepath.Abs("pkg/db/migrations/sqlite")
+	migrationsPath, err := filepath.Abs(MigrationsPath)
 	if err != nil {
 		return fmt.Errorf("could not get migrations path: %v", err)
 	}
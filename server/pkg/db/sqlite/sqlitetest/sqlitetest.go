@@ -0,0 +1,39 @@
+// Package sqlitetest gives tests a fresh, fully migrated in-memory database
+// as sqlite.DB. The migrations create FTS5 tables, so tests using it need the
+// sqlite_fts5 build tag like the server does.
+package sqlitetest
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"social-network/pkg/db/sqlite"
+)
+
+var opened atomic.Int64
+
+// Open replaces sqlite.DB with a new in-memory database until t ends. Tests
+// using it must not run in parallel.
+func Open(t testing.TB) {
+	t.Helper()
+
+	_, file, _, _ := runtime.Caller(0)
+	sqlite.MigrationsPath = filepath.Join(filepath.Dir(file), "..", "..", "migrations", "sqlite")
+
+	// A named shared-cache database is the same for every connection of the
+	// pool, unlike a plain :memory: one
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared", opened.Add(1))
+
+	previous := sqlite.DB
+	if err := sqlite.OpenDB(dsn); err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	db := sqlite.DB
+	t.Cleanup(func() {
+		db.Close()
+		sqlite.DB = previous
+	})
+}
@@ -0,0 +1,210 @@
+package digest
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/mailer"
+	"social-network/pkg/notifications"
+	"social-network/util"
+)
+
+// How often a user gets their digest
+const (
+	FrequencyOff    = "off"
+	FrequencyDaily  = "daily"
+	FrequencyWeekly = "weekly"
+
+	// DefaultFrequency applies to users who never chose one
+	DefaultFrequency = FrequencyDaily
+)
+
+const (
+	// checkInterval is how often the job looks for digests that are due
+	checkInterval = time.Hour
+
+	// maxItems is how many notifications are listed in one email
+	maxItems = 20
+)
+
+// IsFrequency reports whether f is a valid digest frequency
+func IsFrequency(f string) bool {
+	return f == FrequencyOff || f == FrequencyDaily || f == FrequencyWeekly
+}
+
+// period is the time between two digests of the given frequency
+func period(frequency string) time.Duration {
+	if frequency == FrequencyWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Start runs the digest job in the background, sending the digests that are
+// due right away and then every checkInterval.
+func Start(mail mailer.Mailer) {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			if err := Run(mail, time.Now()); err != nil {
+				log.Printf("Error sending notification digests: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+type recipient struct {
+	id         int
+	email      string
+	username   string
+	frequency  string
+	lastSentAt sql.NullTime
+}
+
+// Run emails every verified user whose digest is due a summary of the unread
+// notifications they got since their last one.
+func Run(mail mailer.Mailer, now time.Time) error {
+	rows, err := sqlite.DB.Query(`
+		SELECT u.id, u.email, u.username, COALESCE(ds.frequency, ?), ds.last_sent_at
+		FROM users u
+		LEFT JOIN digest_settings ds ON ds.user_id = u.id
+		WHERE u.email_verified_at IS NOT NULL
+		AND COALESCE(ds.frequency, ?) != ?`,
+		DefaultFrequency, DefaultFrequency, FrequencyOff,
+	)
+	if err != nil {
+		return err
+	}
+	var recipients []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.id, &r.email, &r.username, &r.frequency, &r.lastSentAt); err != nil {
+			rows.Close()
+			return err
+		}
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+
+	for _, r := range recipients {
+		if r.lastSentAt.Valid && now.Sub(r.lastSentAt.Time) < period(r.frequency) {
+			continue
+		}
+		since := now.Add(-period(r.frequency))
+		if r.lastSentAt.Valid {
+			since = r.lastSentAt.Time
+		}
+
+		if err := send(mail, r, since, now); err != nil {
+			log.Printf("Error sending digest to user %d: %v", r.id, err)
+		}
+	}
+	return nil
+}
+
+// send emails one user their digest, if they have anything new, and records
+// when it was sent
+func send(mail mailer.Mailer, r recipient, since, now time.Time) error {
+	rows, err := sqlite.DB.Query(`
+		SELECT type, content FROM notifications
+		WHERE to_user_id = ? AND read = false
+		AND julianday(updated_at) > julianday(?)
+		ORDER BY julianday(updated_at) DESC`,
+		r.id, since,
+	)
+	if err != nil {
+		return err
+	}
+	var items []string
+	wanted := make(map[string]bool)
+	for rows.Next() {
+		var notificationType, content string
+		if err := rows.Scan(&notificationType, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		enabled, ok := wanted[notificationType]
+		if !ok {
+			enabled, err = notifications.Enabled(sqlite.DB, r.id, notificationType, notifications.ChannelDigest)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			wanted[notificationType] = enabled
+		}
+		if enabled {
+			items = append(items, content)
+		}
+	}
+	rows.Close()
+
+	_, token, err := Settings(r.id)
+	if err != nil {
+		return err
+	}
+
+	if len(items) > 0 {
+		err = mail.Send(mailer.Message{
+			To:      r.email,
+			Subject: fmt.Sprintf("You have %d unread notifications", len(items)),
+			Body:    body(r.username, items, token),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = sqlite.DB.Exec("UPDATE digest_settings SET last_sent_at = ? WHERE user_id = ?", now, r.id)
+	return err
+}
+
+// body renders the text of a digest email
+func body(username string, items []string, token string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\n\nHere is what you missed:\n\n", username)
+	for i, item := range items {
+		if i == maxItems {
+			fmt.Fprintf(&b, "...and %d more\n", len(items)-maxItems)
+			break
+		}
+		fmt.Fprintf(&b, "- %s\n", item)
+	}
+	fmt.Fprintf(&b, "\nSee everything at %s\n", env("APP_URL", "http://localhost:3000"))
+	fmt.Fprintf(&b, "\nTo stop these emails, open %s/digest/unsubscribe?token=%s\n",
+		env("API_URL", "http://localhost:8080"), url.QueryEscape(token))
+	return b.String()
+}
+
+// Settings returns a user's digest frequency and unsubscribe token, creating
+// their settings with the default frequency if needed
+func Settings(userID int) (string, string, error) {
+	_, err := sqlite.DB.Exec(`
+		INSERT OR IGNORE INTO digest_settings (user_id, frequency, unsubscribe_token)
+		VALUES (?, ?, ?)`,
+		userID, DefaultFrequency, util.GenerateSessionToken(),
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	var frequency, token string
+	err = sqlite.DB.QueryRow(
+		"SELECT frequency, unsubscribe_token FROM digest_settings WHERE user_id = ?", userID,
+	).Scan(&frequency, &token)
+	return frequency, token, err
+}
+
+func env(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,168 @@
+//go:build sqlite_fts5
+
+package digest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+	"social-network/pkg/mailer"
+)
+
+// outbox records the emails sent, keyed by address
+type outbox map[string][]mailer.Message
+
+func (o outbox) Send(msg mailer.Message) error {
+	o[msg.To] = append(o[msg.To], msg)
+	return nil
+}
+
+func newUser(t *testing.T, username string, verified bool) int {
+	t.Helper()
+	var verifiedAt interface{}
+	if verified {
+		verifiedAt = time.Now().Add(-30 * 24 * time.Hour)
+	}
+	result, err := sqlite.DB.Exec(`
+		INSERT INTO users (email, password, username, first_name, last_name, date_of_birth, email_verified_at)
+		VALUES (?, 'x', ?, 'Test', 'User', '1990-01-01', ?)`,
+		username+"@example.com", username, verifiedAt,
+	)
+	if err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+func notify(t *testing.T, userID int, notificationType, content string, at time.Time, read bool) {
+	t.Helper()
+	_, err := sqlite.DB.Exec(`
+		INSERT INTO notifications (to_user_id, content, type, read, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, content, notificationType, read, at, at,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setDigest(t *testing.T, userID int, frequency string, lastSentAt interface{}) {
+	t.Helper()
+	if _, _, err := Settings(userID); err != nil {
+		t.Fatal(err)
+	}
+	_, err := sqlite.DB.Exec("UPDATE digest_settings SET frequency = ?, last_sent_at = ? WHERE user_id = ?", frequency, lastSentAt, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunPicksRecipients(t *testing.T) {
+	sqlitetest.Open(t)
+	now := time.Now()
+	hourAgo := now.Add(-time.Hour)
+
+	daily := newUser(t, "daily_test", true)
+	unverified := newUser(t, "unverified_test", false)
+	off := newUser(t, "off_test", true)
+	weekly := newUser(t, "weekly_test", true)
+	recent := newUser(t, "recent_test", true)
+	for _, id := range []int{daily, unverified, off, weekly, recent} {
+		notify(t, id, m.NotificationPostLike, "bob liked your post", hourAgo, false)
+	}
+	setDigest(t, off, FrequencyOff, nil)
+	setDigest(t, weekly, FrequencyWeekly, now.Add(-3*24*time.Hour))
+	setDigest(t, recent, FrequencyDaily, now.Add(-12*time.Hour))
+
+	sent := outbox{}
+	if err := Run(sent, now); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		want     int
+	}{
+		{"daily_test", 1},      // the default frequency
+		{"unverified_test", 0}, // never mailed before verifying
+		{"off_test", 0},        // opted out
+		{"weekly_test", 0},     // last digest three days ago
+		{"recent_test", 0},     // last digest twelve hours ago
+	}
+	for _, tt := range tests {
+		if got := len(sent[tt.username+"@example.com"]); got != tt.want {
+			t.Errorf("%s got %d digests, want %d", tt.username, got, tt.want)
+		}
+	}
+
+	// The digest that went out moves the window on
+	again := outbox{}
+	if err := Run(again, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(again["daily_test@example.com"]); got != 0 {
+		t.Errorf("daily_test got %d more digests an hour later, want none", got)
+	}
+	if err := Run(again, now.Add(25*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(again["weekly_test@example.com"]); got != 0 {
+		t.Errorf("weekly_test got a digest four days after the last one")
+	}
+}
+
+func TestRunListsUnreadNotificationsSinceLastDigest(t *testing.T) {
+	sqlitetest.Open(t)
+	now := time.Now()
+
+	user := newUser(t, "reader_test", true)
+	setDigest(t, user, FrequencyDaily, now.Add(-30*time.Hour))
+	notify(t, user, m.NotificationPostLike, "before the last digest", now.Add(-31*time.Hour), false)
+	notify(t, user, m.NotificationPostLike, "already read", now.Add(-2*time.Hour), true)
+	notify(t, user, m.NotificationPostComment, "comment without digest", now.Add(-2*time.Hour), false)
+	notify(t, user, m.NotificationPostLike, "new like", now.Add(-time.Hour), false)
+	_, err := sqlite.DB.Exec(
+		"INSERT INTO notification_preferences (user_id, type, in_app, push, digest) VALUES (?, ?, true, true, false)",
+		user, m.NotificationPostComment,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := outbox{}
+	if err := Run(sent, now); err != nil {
+		t.Fatal(err)
+	}
+	mails := sent["reader_test@example.com"]
+	if len(mails) != 1 {
+		t.Fatalf("got %d digests, want 1", len(mails))
+	}
+	if mails[0].Subject != "You have 1 unread notifications" || !strings.Contains(mails[0].Body, "- new like\n") {
+		t.Errorf("digest = %q\n%s\nwant only the new like", mails[0].Subject, mails[0].Body)
+	}
+
+	var lastSentAt time.Time
+	sqlite.DB.QueryRow("SELECT last_sent_at FROM digest_settings WHERE user_id = ?", user).Scan(&lastSentAt)
+	if !lastSentAt.Equal(now) {
+		t.Errorf("last_sent_at = %v, want %v", lastSentAt, now)
+	}
+}
+
+func TestRunSkipsEmptyDigests(t *testing.T) {
+	sqlitetest.Open(t)
+	now := time.Now()
+	newUser(t, "quiet_test", true)
+
+	sent := outbox{}
+	if err := Run(sent, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(sent["quiet_test@example.com"]); got != 0 {
+		t.Errorf("a user without unread notifications got %d digests", got)
+	}
+}
@@ -0,0 +1,295 @@
+// Package follow holds the follow state machine. A follow between two users
+// goes from none to pending (or straight to accepted when the followed user is
+// public), then to accepted or rejected. A rejected request can be sent again
+// once RequestCooldown has passed. Accepted follows and pending requests can
+// be undone, which brings the pair back to none.
+package follow
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/notifications"
+)
+
+// States of a follow, as stored in followers.status. StateNone means there is
+// no row for the pair.
+const (
+	StateNone     = ""
+	StatePending  = "pending"
+	StateAccepted = "accept"
+	StateRejected = "reject"
+)
+
+// Actions move a follow from one state to another. Request, Cancel and
+// Unfollow are taken by the follower; Accept, Reject and Remove by the user
+// being followed.
+const (
+	ActionRequest  = "request"
+	ActionCancel   = "cancel"
+	ActionAccept   = "accept"
+	ActionReject   = "reject"
+	ActionUnfollow = "unfollow"
+	ActionRemove   = "remove"
+)
+
+// RequestCooldown is how long a user has to wait after a rejection before
+// asking to follow the same user again
+const RequestCooldown = 7 * 24 * time.Hour
+
+var (
+	// ErrInvalidTransition means the action can't be taken in the current state
+	ErrInvalidTransition = errors.New("follow: invalid transition")
+
+	// ErrAlreadyRequested means a request is pending or already accepted
+	ErrAlreadyRequested = errors.New("follow: already requested")
+)
+
+// CooldownError is returned when a rejected request is re-sent too early
+type CooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("follow: request was rejected, try again in %s", e.RetryAfter.Round(time.Minute))
+}
+
+// Transition returns the state a follow moves to when action is taken.
+// targetPrivate tells whether the followed user approves followers, and
+// respondedAt is when a rejected request was answered.
+func Transition(state, action string, targetPrivate bool, respondedAt, now time.Time) (string, error) {
+	switch action {
+	case ActionRequest:
+		switch state {
+		case StatePending, StateAccepted:
+			return state, ErrAlreadyRequested
+		case StateRejected:
+			if wait := respondedAt.Add(RequestCooldown).Sub(now); wait > 0 {
+				return state, &CooldownError{RetryAfter: wait}
+			}
+		}
+		if targetPrivate {
+			return StatePending, nil
+		}
+		return StateAccepted, nil
+
+	case ActionCancel:
+		if state == StatePending {
+			return StateNone, nil
+		}
+
+	case ActionAccept:
+		if state == StatePending {
+			return StateAccepted, nil
+		}
+
+	case ActionReject:
+		if state == StatePending {
+			return StateRejected, nil
+		}
+
+	case ActionUnfollow, ActionRemove:
+		if state == StateAccepted {
+			return StateNone, nil
+		}
+	}
+	return state, ErrInvalidTransition
+}
+
+// Result describes a transition that was applied
+type Result struct {
+	FollowID   int64
+	FollowerID int
+	FollowedID int
+	From       string
+	To         string
+
+	// notification is sent to the other user once the transaction commits
+	notification *m.Notification
+	deliver      bool
+
+	// retracted holds the notifications removed from each user's list
+	retracted map[int][]int
+}
+
+// Apply takes action on the follow from followerID to followedID inside tx:
+// it validates the transition, stores the new state and creates or retracts
+// the notifications that go with it. Call Publish on the result after the
+// transaction has been committed.
+func Apply(tx *sql.Tx, followerID, followedID int, action string) (*Result, error) {
+	if followerID == followedID {
+		return nil, ErrInvalidTransition
+	}
+
+	res := &Result{FollowerID: followerID, FollowedID: followedID, retracted: make(map[int][]int)}
+
+	var respondedAt, requestedAt sql.NullTime
+	err := tx.QueryRow(`
+		SELECT id, status, created_at, responded_at FROM followers
+		WHERE follower_id = ? AND followed_id = ?`,
+		followerID, followedID,
+	).Scan(&res.FollowID, &res.From, &requestedAt, &respondedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var targetPrivate bool
+	if err := tx.QueryRow("SELECT is_private FROM users WHERE id = ?", followedID).Scan(&targetPrivate); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res.To, err = Transition(res.From, action, targetPrivate, respondedAt.Time, now)
+	if err != nil {
+		return res, err
+	}
+
+	switch {
+	case res.To == StateNone:
+		_, err = tx.Exec("DELETE FROM followers WHERE id = ?", res.FollowID)
+	case res.From == StateNone:
+		var result sql.Result
+		result, err = tx.Exec(`
+			INSERT INTO followers (follower_id, followed_id, status, created_at)
+			VALUES (?, ?, ?, ?)`,
+			followerID, followedID, res.To, now,
+		)
+		if err == nil {
+			res.FollowID, err = result.LastInsertId()
+		}
+		requestedAt = sql.NullTime{Time: now, Valid: true}
+	case action == ActionRequest:
+		// A rejected request that is sent again starts over
+		_, err = tx.Exec(`
+			UPDATE followers SET status = ?, created_at = ?, responded_at = NULL
+			WHERE id = ?`,
+			res.To, now, res.FollowID,
+		)
+		requestedAt = sql.NullTime{Time: now, Valid: true}
+	default:
+		_, err = tx.Exec(
+			"UPDATE followers SET status = ?, responded_at = ? WHERE id = ?",
+			res.To, now, res.FollowID,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := res.notify(tx, action, requestedAt.Time); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// notify creates the notification of a transition and retracts the ones it
+// makes obsolete. Keys include the request time so a request that is sent
+// again gets fresh notifications.
+func (res *Result) notify(tx *sql.Tx, action string, requestedAt time.Time) error {
+	var err error
+	retract := func(toUserID, fromUserID int, types ...string) {
+		if err != nil {
+			return
+		}
+		var ids []int
+		ids, err = notifications.Retract(tx, toUserID, fromUserID, types...)
+		res.retracted[toUserID] = append(res.retracted[toUserID], ids...)
+	}
+
+	switch action {
+	case ActionRequest:
+		if res.To == StatePending {
+			res.notification, err = res.build(tx, res.FollowedID, res.FollowerID, m.NotificationTypeFollow,
+				"%s wants to follow you", requestedAt)
+		}
+	case ActionAccept, ActionReject:
+		notificationType, format := m.NotificationTypeAccept, "%s accepted your follow request"
+		if action == ActionReject {
+			notificationType, format = m.NotificationTypeReject, "%s rejected your follow request"
+		}
+		retract(res.FollowedID, res.FollowerID, m.NotificationTypeFollow)
+		if err == nil {
+			res.notification, err = res.build(tx, res.FollowerID, res.FollowedID, notificationType, format, requestedAt)
+		}
+	case ActionCancel:
+		retract(res.FollowedID, res.FollowerID, m.NotificationTypeFollow)
+	case ActionRemove:
+		retract(res.FollowerID, res.FollowedID, m.NotificationTypeAccept)
+		retract(res.FollowedID, res.FollowerID, m.NotificationTypeFollow)
+	}
+	if err != nil || res.notification == nil {
+		return err
+	}
+
+	res.deliver, err = notifications.Persist(tx, res.notification)
+	return err
+}
+
+// build creates the notification sent to toUserID about fromUserID, whose
+// username fills in format
+func (res *Result) build(tx *sql.Tx, toUserID, fromUserID int, notificationType, format string, requestedAt time.Time) (*m.Notification, error) {
+	var username string
+	if err := tx.QueryRow("SELECT username FROM users WHERE id = ?", fromUserID).Scan(&username); err != nil {
+		return nil, err
+	}
+	return &m.Notification{
+		ToUserID:       toUserID,
+		FromUserID:     fromUserID,
+		Content:        fmt.Sprintf(format, username),
+		Type:           notificationType,
+		CreatedAt:      time.Now(),
+		IdempotencyKey: notifications.Key(notificationType, res.FollowID, requestedAt.Unix()),
+	}, nil
+}
+
+// Publish pushes the transition's notification and tells users about
+// notifications that were retracted
+func (res *Result) Publish() {
+	if res.notification != nil && res.deliver {
+		notifications.Push(*res.notification)
+	}
+	for userID, ids := range res.retracted {
+		notifications.PublishRemoved(userID, ids)
+	}
+}
+
+// AcceptPending accepts every pending request to followedID, oldest first.
+// It is used when a private account goes public and no longer approves
+// followers. Call Publish on each result after the transaction commits.
+func AcceptPending(tx *sql.Tx, followedID int) ([]*Result, error) {
+	rows, err := tx.Query(`
+		SELECT follower_id FROM followers
+		WHERE followed_id = ? AND status = ?
+		ORDER BY created_at, id`,
+		followedID, StatePending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var followerIDs []int
+	for rows.Next() {
+		var followerID int
+		if err := rows.Scan(&followerID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		followerIDs = append(followerIDs, followerID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, 0, len(followerIDs))
+	for _, followerID := range followerIDs {
+		res, err := Apply(tx, followerID, followedID, ActionAccept)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
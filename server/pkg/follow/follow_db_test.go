@@ -0,0 +1,386 @@
+//go:build sqlite_fts5
+
+package follow
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+	"social-network/pkg/notifications"
+)
+
+// published records the frames Publish sends
+type published struct {
+	frames map[int][]notifications.Frame
+}
+
+func recordFrames(t *testing.T) *published {
+	p := &published{frames: make(map[int][]notifications.Frame)}
+	notifications.SetPublisher(func(userID int, frame notifications.Frame) {
+		p.frames[userID] = append(p.frames[userID], frame)
+	})
+	t.Cleanup(func() { notifications.SetPublisher(nil) })
+	return p
+}
+
+func (p *published) take(userID int) []notifications.Frame {
+	frames := p.frames[userID]
+	delete(p.frames, userID)
+	return frames
+}
+
+func newUser(t *testing.T, username string, private bool) int {
+	t.Helper()
+	result, err := sqlite.DB.Exec(`
+		INSERT INTO users (email, password, username, first_name, last_name, date_of_birth, is_private)
+		VALUES (?, 'x', ?, 'Test', 'User', '1990-01-01', ?)`,
+		username+"@example.com", username, private,
+	)
+	if err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+// apply runs Apply in its own transaction and publishes the result once it
+// commits, like the handlers do
+func apply(t *testing.T, followerID, followedID int, action string) (*Result, error) {
+	t.Helper()
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	res, err := Apply(tx, followerID, followedID, action)
+	if err != nil {
+		return res, err
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	res.Publish()
+	return res, nil
+}
+
+type followRow struct {
+	id          int64
+	status      string
+	respondedAt sql.NullTime
+}
+
+// row loads the follow between two users; ok is false when there is none
+func row(t *testing.T, followerID, followedID int) (followRow, bool) {
+	t.Helper()
+	var r followRow
+	err := sqlite.DB.QueryRow(
+		"SELECT id, status, responded_at FROM followers WHERE follower_id = ? AND followed_id = ?",
+		followerID, followedID,
+	).Scan(&r.id, &r.status, &r.respondedAt)
+	if err == sql.ErrNoRows {
+		return r, false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, true
+}
+
+// stored lists the types of the notifications from fromUserID to toUserID
+func stored(t *testing.T, toUserID, fromUserID int) []string {
+	t.Helper()
+	rows, err := sqlite.DB.Query(
+		"SELECT type FROM notifications WHERE to_user_id = ? AND from_user_id = ? ORDER BY id",
+		toUserID, fromUserID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var types []string
+	for rows.Next() {
+		var notificationType string
+		rows.Scan(&notificationType)
+		types = append(types, notificationType)
+	}
+	return types
+}
+
+func frameTypes(frames []notifications.Frame) []string {
+	types := make([]string, len(frames))
+	for i, frame := range frames {
+		types[i] = frame.Type
+		if n, ok := frame.Data.(m.Notification); ok {
+			types[i] += ":" + n.Type
+		}
+	}
+	return types
+}
+
+// removed is what a user is sent when notifications are retracted
+var removed = []string{notifications.FrameNotificationRemoved, notifications.FrameUnreadCount}
+
+// pushed is what a user is sent for a new notification of notificationType
+func pushed(notificationType string) []string {
+	return []string{notifications.FrameNotification + ":" + notificationType, notifications.FrameUnreadCount}
+}
+
+func equal(a, b []string) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func TestApplyPrivateRequestAndAccept(t *testing.T) {
+	sqlitetest.Open(t)
+	frames := recordFrames(t)
+	alice := newUser(t, "alice_test", false)
+	carol := newUser(t, "carol_test", true)
+
+	res, err := apply(t, alice, carol, ActionRequest)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if res.From != StateNone || res.To != StatePending {
+		t.Errorf("request moved %q to %q, want none to pending", res.From, res.To)
+	}
+	r, ok := row(t, alice, carol)
+	if !ok || r.status != StatePending || r.id != res.FollowID {
+		t.Errorf("row after request = %+v (exists %v), want pending with id %d", r, ok, res.FollowID)
+	}
+	if got := stored(t, carol, alice); !equal(got, []string{m.NotificationTypeFollow}) {
+		t.Errorf("carol's notifications = %v, want a follow request", got)
+	}
+	got := frames.take(carol)
+	if !equal(frameTypes(got), pushed(m.NotificationTypeFollow)) {
+		t.Fatalf("carol got frames %v, want the follow request", frameTypes(got))
+	}
+	if n := got[0].Data.(m.Notification); n.Content != "alice_test wants to follow you" || n.FromUserID != alice {
+		t.Errorf("follow request notification = %+v", n)
+	}
+
+	res, err = apply(t, alice, carol, ActionAccept)
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if res.From != StatePending || res.To != StateAccepted {
+		t.Errorf("accept moved %q to %q, want pending to accept", res.From, res.To)
+	}
+	r, _ = row(t, alice, carol)
+	if r.status != StateAccepted || !r.respondedAt.Valid {
+		t.Errorf("row after accept = %+v, want accepted with responded_at", r)
+	}
+	if got := stored(t, carol, alice); len(got) != 0 {
+		t.Errorf("carol still has notifications %v, want the request retracted", got)
+	}
+	if got := stored(t, alice, carol); !equal(got, []string{m.NotificationTypeAccept}) {
+		t.Errorf("alice's notifications = %v, want an accept", got)
+	}
+	if got := frameTypes(frames.take(alice)); !equal(got, pushed(m.NotificationTypeAccept)) {
+		t.Errorf("alice got frames %v, want the accept notification", got)
+	}
+	if got := frameTypes(frames.take(carol)); !equal(got, removed) {
+		t.Errorf("carol got frames %v, want the request removed", got)
+	}
+}
+
+func TestApplyPublicRequestIsAcceptedAtOnce(t *testing.T) {
+	sqlitetest.Open(t)
+	frames := recordFrames(t)
+	alice := newUser(t, "alice_test", false)
+	dave := newUser(t, "dave_test", false)
+
+	res, err := apply(t, alice, dave, ActionRequest)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if res.To != StateAccepted {
+		t.Errorf("request to a public account moved to %q, want accepted", res.To)
+	}
+	if r, _ := row(t, alice, dave); r.status != StateAccepted {
+		t.Errorf("row status = %q, want accepted", r.status)
+	}
+	if got := stored(t, dave, alice); len(got) != 0 {
+		t.Errorf("dave got notifications %v, want none", got)
+	}
+	if len(frames.frames) != 0 {
+		t.Errorf("frames were published: %v", frames.frames)
+	}
+
+	if _, err := apply(t, alice, dave, ActionRequest); !errors.Is(err, ErrAlreadyRequested) {
+		t.Errorf("requesting again = %v, want ErrAlreadyRequested", err)
+	}
+}
+
+func TestApplyRejectionCooldown(t *testing.T) {
+	sqlitetest.Open(t)
+	frames := recordFrames(t)
+	alice := newUser(t, "alice_test", false)
+	carol := newUser(t, "carol_test", true)
+
+	if _, err := apply(t, alice, carol, ActionRequest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apply(t, alice, carol, ActionReject); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := row(t, alice, carol)
+	if r.status != StateRejected {
+		t.Fatalf("row status after reject = %q", r.status)
+	}
+	if got := stored(t, alice, carol); !equal(got, []string{m.NotificationTypeReject}) {
+		t.Errorf("alice's notifications = %v, want a rejection", got)
+	}
+	if got := stored(t, carol, alice); len(got) != 0 {
+		t.Errorf("carol's notifications = %v, want the answered request retracted", got)
+	}
+	frames.take(carol)
+
+	var cooldown *CooldownError
+	if _, err := apply(t, alice, carol, ActionRequest); !errors.As(err, &cooldown) {
+		t.Fatalf("request right after a rejection = %v, want a CooldownError", err)
+	}
+	if after, _ := row(t, alice, carol); after != r {
+		t.Errorf("row changed by a refused request: %+v, was %+v", after, r)
+	}
+
+	_, err := sqlite.DB.Exec("UPDATE followers SET responded_at = ? WHERE id = ?",
+		time.Now().Add(-RequestCooldown-time.Minute), r.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := apply(t, alice, carol, ActionRequest)
+	if err != nil {
+		t.Fatalf("request after the cooldown: %v", err)
+	}
+	if res.From != StateRejected || res.To != StatePending || res.FollowID != r.id {
+		t.Errorf("request after the cooldown = %+v, want the same row moved from rejected to pending", res)
+	}
+	r, _ = row(t, alice, carol)
+	if r.status != StatePending || r.respondedAt.Valid {
+		t.Errorf("row after the new request = %+v, want pending without responded_at", r)
+	}
+	if got := stored(t, carol, alice); !equal(got, []string{m.NotificationTypeFollow}) {
+		t.Errorf("carol's notifications = %v, want a fresh follow request", got)
+	}
+	if got := frameTypes(frames.take(carol)); !equal(got, pushed(m.NotificationTypeFollow)) {
+		t.Errorf("carol got frames %v, want the new request pushed", got)
+	}
+}
+
+func TestApplyUndo(t *testing.T) {
+	sqlitetest.Open(t)
+	frames := recordFrames(t)
+	alice := newUser(t, "alice_test", false)
+	carol := newUser(t, "carol_test", true)
+
+	apply(t, alice, carol, ActionRequest)
+	if _, err := apply(t, alice, carol, ActionCancel); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if _, ok := row(t, alice, carol); ok {
+		t.Error("row still exists after cancel")
+	}
+	if got := stored(t, carol, alice); len(got) != 0 {
+		t.Errorf("carol still has notifications %v after cancel", got)
+	}
+
+	apply(t, alice, carol, ActionRequest)
+	apply(t, alice, carol, ActionAccept)
+	frames.take(alice)
+	frames.take(carol)
+	if _, err := apply(t, alice, carol, ActionRemove); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, ok := row(t, alice, carol); ok {
+		t.Error("row still exists after remove")
+	}
+	if got := stored(t, alice, carol); len(got) != 0 {
+		t.Errorf("alice still has notifications %v after being removed", got)
+	}
+	if got := frameTypes(frames.take(alice)); !equal(got, removed) {
+		t.Errorf("alice got frames %v, want the accept removed", got)
+	}
+
+	if _, err := apply(t, alice, carol, ActionUnfollow); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("unfollowing without a follow = %v, want ErrInvalidTransition", err)
+	}
+	if _, err := apply(t, alice, alice, ActionRequest); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("following yourself = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestStateMachineMigrationKeepsLegacyStatuses(t *testing.T) {
+	sqlitetest.Open(t)
+
+	// A followers table from before migration 13, without its CHECK
+	_, err := sqlite.DB.Exec(`
+		DROP TABLE followers;
+		CREATE TABLE followers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			follower_id INTEGER NOT NULL,
+			followed_id INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO followers (follower_id, followed_id, status) VALUES
+			(1, 2, 'accepted'),
+			(1, 3, 'Requested'),
+			(2, 3, 'blocked'),
+			(3, 1, 'pending'),
+			(3, 1, 'approved'),
+			(2, 1, 'accept'),
+			(2, 1, 'muted');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migration, err := os.ReadFile(filepath.Join("..", "db", "migrations", "sqlite", "000034_follow_state_machine.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlite.DB.Exec(string(migration)); err != nil {
+		t.Fatalf("running migration 34: %v", err)
+	}
+
+	tests := []struct {
+		followerID, followedID int
+		want                   string
+	}{
+		{1, 2, StateAccepted},
+		{1, 3, StatePending},
+		{2, 3, ""},
+		{3, 1, StateAccepted},
+		{2, 1, StateAccepted},
+	}
+	for _, tt := range tests {
+		r, ok := row(t, tt.followerID, tt.followedID)
+		if got := map[bool]string{true: r.status}[ok]; got != tt.want {
+			t.Errorf("follow %d -> %d = %q, want %q", tt.followerID, tt.followedID, got, tt.want)
+		}
+	}
+
+	var legacy []string
+	rows, err := sqlite.DB.Query("SELECT status FROM followers_legacy ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		legacy = append(legacy, status)
+	}
+	if !equal(legacy, []string{"blocked", "muted"}) {
+		t.Errorf("kept legacy statuses %v, want [blocked muted]", legacy)
+	}
+}
@@ -0,0 +1,125 @@
+package follow
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransition(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Long enough ago that a rejected request may be sent again
+	answered := now.Add(-2 * RequestCooldown)
+
+	tests := []struct {
+		state, action string
+		// wantPublic and wantPrivate are the next state when the followed
+		// user is public or private. They are ignored when wantErr is set.
+		wantPublic, wantPrivate string
+		wantErr                 error
+	}{
+		{StateNone, ActionRequest, StateAccepted, StatePending, nil},
+		{StateNone, ActionCancel, "", "", ErrInvalidTransition},
+		{StateNone, ActionAccept, "", "", ErrInvalidTransition},
+		{StateNone, ActionReject, "", "", ErrInvalidTransition},
+		{StateNone, ActionUnfollow, "", "", ErrInvalidTransition},
+		{StateNone, ActionRemove, "", "", ErrInvalidTransition},
+
+		{StatePending, ActionRequest, "", "", ErrAlreadyRequested},
+		{StatePending, ActionCancel, StateNone, StateNone, nil},
+		{StatePending, ActionAccept, StateAccepted, StateAccepted, nil},
+		{StatePending, ActionReject, StateRejected, StateRejected, nil},
+		{StatePending, ActionUnfollow, "", "", ErrInvalidTransition},
+		{StatePending, ActionRemove, "", "", ErrInvalidTransition},
+
+		{StateAccepted, ActionRequest, "", "", ErrAlreadyRequested},
+		{StateAccepted, ActionCancel, "", "", ErrInvalidTransition},
+		{StateAccepted, ActionAccept, "", "", ErrInvalidTransition},
+		{StateAccepted, ActionReject, "", "", ErrInvalidTransition},
+		{StateAccepted, ActionUnfollow, StateNone, StateNone, nil},
+		{StateAccepted, ActionRemove, StateNone, StateNone, nil},
+
+		{StateRejected, ActionRequest, StateAccepted, StatePending, nil},
+		{StateRejected, ActionCancel, "", "", ErrInvalidTransition},
+		{StateRejected, ActionAccept, "", "", ErrInvalidTransition},
+		{StateRejected, ActionReject, "", "", ErrInvalidTransition},
+		{StateRejected, ActionUnfollow, "", "", ErrInvalidTransition},
+		{StateRejected, ActionRemove, "", "", ErrInvalidTransition},
+
+		{StateAccepted, "follow", "", "", ErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		for _, private := range []bool{false, true} {
+			want := tt.wantPublic
+			if private {
+				want = tt.wantPrivate
+			}
+
+			got, err := Transition(tt.state, tt.action, private, answered, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Transition(%q, %q, private=%v) error = %v, want %v", tt.state, tt.action, private, err, tt.wantErr)
+				}
+				if got != tt.state {
+					t.Errorf("Transition(%q, %q, private=%v) = %q after an error, want the state unchanged", tt.state, tt.action, private, got)
+				}
+				continue
+			}
+			if err != nil || got != want {
+				t.Errorf("Transition(%q, %q, private=%v) = %q, %v, want %q", tt.state, tt.action, private, got, err, want)
+			}
+		}
+	}
+}
+
+func TestTransitionRequestCooldown(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		respondedAt   time.Time
+		wantRetry     time.Duration
+		wantCooldown  bool
+		wantNextState string
+	}{
+		{"just rejected", now, RequestCooldown, true, ""},
+		{"a day later", now.Add(-24 * time.Hour), RequestCooldown - 24*time.Hour, true, ""},
+		{"a second early", now.Add(-RequestCooldown + time.Second), time.Second, true, ""},
+		{"cooldown over", now.Add(-RequestCooldown), 0, false, StatePending},
+		{"long ago", now.Add(-30 * 24 * time.Hour), 0, false, StatePending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Transition(StateRejected, ActionRequest, true, tt.respondedAt, now)
+
+			var cooldown *CooldownError
+			if tt.wantCooldown {
+				if !errors.As(err, &cooldown) {
+					t.Fatalf("error = %v, want a CooldownError", err)
+				}
+				if cooldown.RetryAfter != tt.wantRetry {
+					t.Errorf("RetryAfter = %s, want %s", cooldown.RetryAfter, tt.wantRetry)
+				}
+				if got != StateRejected {
+					t.Errorf("state = %q, want it to stay rejected", got)
+				}
+				return
+			}
+			if err != nil || got != tt.wantNextState {
+				t.Errorf("Transition = %q, %v, want %q", got, err, tt.wantNextState)
+			}
+		})
+	}
+}
+
+func TestTransitionCooldownOnlyAppliesToRejections(t *testing.T) {
+	now := time.Now()
+	// A recent respondedAt from an earlier accept doesn't hold back a new
+	// request after an unfollow, which leaves no row behind
+	got, err := Transition(StateNone, ActionRequest, true, now, now)
+	if err != nil || got != StatePending {
+		t.Errorf("Transition = %q, %v, want %q", got, err, StatePending)
+	}
+}
@@ -0,0 +1,171 @@
+// Package loginlimit slows down password guessing. Failed logins are counted
+// per account and per IP address in the login_throttles table, so a restart
+// doesn't reset them. After a few free attempts every failure doubles the
+// wait before the next attempt, and too many failures lock the key out for a
+// while. Failures are forgotten FailureWindow after the last one.
+package loginlimit
+
+import (
+	"database/sql"
+	"time"
+
+	"social-network/pkg/db/sqlite"
+	"social-network/util"
+)
+
+// FailureWindow is how long failures are remembered after the last one
+const FailureWindow = time.Hour
+
+// Policy decides how long a key has to wait after a number of failures
+type Policy struct {
+	// FreeAttempts is how many failures are allowed without waiting
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past FreeAttempts. It
+	// doubles with every further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter failures, and with every failure after that, the key is
+	// locked for Lockout
+	LockoutAfter int
+	Lockout      time.Duration
+}
+
+var (
+	// Account limits guesses at a single account, from anywhere
+	Account = Policy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockoutAfter: 10,
+		Lockout:      15 * time.Minute,
+	}
+
+	// IP limits guesses from a single address, at any account. It is looser
+	// so people sharing an address don't lock each other out.
+	IP = Policy{
+		FreeAttempts: 10,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockoutAfter: 50,
+		Lockout:      15 * time.Minute,
+	}
+
+	// PasswordReset limits reset emails to a single address to three before
+	// a wait. Every request counts, whether or not an account uses the
+	// address.
+	PasswordReset = Policy{
+		FreeAttempts: 2,
+		BaseDelay:    time.Minute,
+		MaxDelay:     15 * time.Minute,
+		LockoutAfter: 10,
+		Lockout:      time.Hour,
+	}
+)
+
+// AccountKey is the key of the account using email
+func AccountKey(email string) string {
+	return "account:" + util.NormalizeEmail(email)
+}
+
+// IPKey is the key of an IP address
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// PasswordResetKey is the key of the password reset requests for email
+func PasswordResetKey(email string) string {
+	return "reset:" + util.NormalizeEmail(email)
+}
+
+// PasswordResetIPKey is the key of the password reset requests from an IP
+// address, kept apart from its failed logins
+func PasswordResetIPKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+// Delay is how long a key with failures has to wait before the next attempt
+func (p Policy) Delay(failures int) time.Duration {
+	switch {
+	case failures >= p.LockoutAfter:
+		return p.Lockout
+	case failures <= p.FreeAttempts:
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// RetryAfter is how long to wait before any of keys may try again. Zero means
+// an attempt is allowed now.
+func RetryAfter(keys ...string) (time.Duration, error) {
+	var wait time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		var blockedUntil sql.NullTime
+		err := sqlite.DB.QueryRow(
+			"SELECT blocked_until FROM login_throttles WHERE key = ?", key,
+		).Scan(&blockedUntil)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if blockedUntil.Valid && blockedUntil.Time.Sub(now) > wait {
+			wait = blockedUntil.Time.Sub(now)
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt for key. It reports whether this failure
+// locked the key out, which only happens once per run of failures.
+func Fail(key string, p Policy) (locked bool, err error) {
+	now := time.Now().UTC()
+	windowStart := now.Add(-FailureWindow)
+
+	// Counted in one statement so concurrent failures can't be lost
+	var failures int
+	err = sqlite.DB.QueryRow(`
+		INSERT INTO login_throttles (key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN julianday(last_failure_at) < julianday(?) THEN 1
+				ELSE failures + 1
+			END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures`,
+		key, now, windowStart,
+	).Scan(&failures)
+	if err != nil {
+		return false, err
+	}
+
+	var blockedUntil interface{}
+	if delay := p.Delay(failures); delay > 0 {
+		blockedUntil = now.Add(delay)
+	}
+	_, err = sqlite.DB.Exec("UPDATE login_throttles SET blocked_until = ? WHERE key = ?", blockedUntil, key)
+	if err != nil {
+		return false, err
+	}
+
+	// Forget keys nobody has failed with for a while
+	_, err = sqlite.DB.Exec(`
+		DELETE FROM login_throttles
+		WHERE julianday(last_failure_at) < julianday(?)
+		AND (blocked_until IS NULL OR julianday(blocked_until) < julianday(?))`,
+		windowStart, now,
+	)
+	return failures == p.LockoutAfter, err
+}
+
+// Reset forgets the failures of key, after a successful login
+func Reset(key string) error {
+	_, err := sqlite.DB.Exec("DELETE FROM login_throttles WHERE key = ?", key)
+	return err
+}
@@ -0,0 +1,105 @@
+//go:build sqlite_fts5
+
+package loginlimit
+
+import (
+	"testing"
+	"time"
+
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+)
+
+// near reports whether got is within a second below want, allowing for the
+// time passing during the test
+func near(got, want time.Duration) bool {
+	return got <= want && got > want-time.Second
+}
+
+func TestFailBacksOffThenLocksOut(t *testing.T) {
+	sqlitetest.Open(t)
+	key := AccountKey("jane@example.com")
+
+	for failures := 1; failures <= Account.LockoutAfter+2; failures++ {
+		locked, err := Fail(key, Account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantLocked := failures == Account.LockoutAfter; locked != wantLocked {
+			t.Errorf("failure %d: locked = %v, want %v", failures, locked, wantLocked)
+		}
+
+		wait, err := RetryAfter(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := Account.Delay(failures); !(want == 0 && wait == 0) && !near(wait, want) {
+			t.Errorf("after %d failures RetryAfter = %s, want about %s", failures, wait, want)
+		}
+	}
+
+	var failures int
+	sqlite.DB.QueryRow("SELECT failures FROM login_throttles WHERE key = ?", key).Scan(&failures)
+	if failures != Account.LockoutAfter+2 {
+		t.Errorf("stored failures = %d, want %d", failures, Account.LockoutAfter+2)
+	}
+}
+
+func TestFailForgetsOldFailures(t *testing.T) {
+	sqlitetest.Open(t)
+	key := AccountKey("jane@example.com")
+
+	for i := 0; i < Account.LockoutAfter-1; i++ {
+		if _, err := Fail(key, Account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := sqlite.DB.Exec(
+		"UPDATE login_throttles SET last_failure_at = ?, blocked_until = NULL WHERE key = ?",
+		time.Now().UTC().Add(-FailureWindow-time.Minute), key,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked, err := Fail(key, Account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked {
+		t.Error("a failure after the window locked the account")
+	}
+	if wait, _ := RetryAfter(key); wait != 0 {
+		t.Errorf("RetryAfter = %s after the count started over, want 0", wait)
+	}
+}
+
+func TestResetAndMultipleKeys(t *testing.T) {
+	sqlitetest.Open(t)
+	account, ip := AccountKey("jane@example.com"), IPKey("10.0.0.1")
+
+	for i := 0; i < Account.FreeAttempts+3; i++ {
+		Fail(account, Account)
+	}
+	for i := 0; i < IP.FreeAttempts+1; i++ {
+		Fail(ip, IP)
+	}
+
+	wait, err := RetryAfter(account, ip, IPKey("10.0.0.2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(wait, 4*time.Second) {
+		t.Errorf("RetryAfter of both keys = %s, want the longer 4s of the account", wait)
+	}
+
+	if err := Reset(account); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := RetryAfter(account); wait != 0 {
+		t.Errorf("RetryAfter after Reset = %s, want 0", wait)
+	}
+	if wait, _ := RetryAfter(ip); !near(wait, time.Second) {
+		t.Errorf("Reset of the account changed the IP's wait to %s", wait)
+	}
+}
@@ -0,0 +1,89 @@
+package loginlimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccountDelay(t *testing.T) {
+	want := []time.Duration{
+		0, 0, 0, 0, // up to FreeAttempts failures wait nothing
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		16 * time.Second,
+		32 * time.Second,
+		15 * time.Minute, // LockoutAfter
+		15 * time.Minute,
+		15 * time.Minute,
+	}
+	for failures, delay := range want {
+		if got := Account.Delay(failures); got != delay {
+			t.Errorf("Account.Delay(%d) = %s, want %s", failures, got, delay)
+		}
+	}
+}
+
+func TestDelayIsCappedBelowLockout(t *testing.T) {
+	p := Policy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 10 * time.Second, LockoutAfter: 20, Lockout: time.Hour}
+	want := map[int]time.Duration{
+		2:  0,
+		3:  time.Second,
+		4:  2 * time.Second,
+		5:  4 * time.Second,
+		6:  8 * time.Second,
+		7:  10 * time.Second,
+		19: 10 * time.Second,
+		20: time.Hour,
+		50: time.Hour,
+	}
+	for failures, delay := range want {
+		if got := p.Delay(failures); got != delay {
+			t.Errorf("Delay(%d) = %s, want %s", failures, got, delay)
+		}
+	}
+}
+
+func TestIPPolicyIsLooserThanAccount(t *testing.T) {
+	for failures := 0; failures <= IP.LockoutAfter; failures++ {
+		if IP.Delay(failures) > Account.Delay(failures) && failures < Account.LockoutAfter {
+			t.Errorf("after %d failures an IP waits %s, longer than an account's %s",
+				failures, IP.Delay(failures), Account.Delay(failures))
+		}
+	}
+	if IP.Delay(Account.LockoutAfter) >= IP.Lockout {
+		t.Error("an IP is locked out as soon as a single account is")
+	}
+}
+
+func TestPasswordResetDelay(t *testing.T) {
+	want := []time.Duration{
+		0, 0, 0, // the first two requests don't count towards a wait
+		time.Minute, // so the third makes the next one wait
+		2 * time.Minute,
+		4 * time.Minute,
+		8 * time.Minute,
+		15 * time.Minute,
+		15 * time.Minute,
+		15 * time.Minute,
+		time.Hour,
+	}
+	for requests, delay := range want {
+		if got := PasswordReset.Delay(requests); got != delay {
+			t.Errorf("PasswordReset.Delay(%d) = %s, want %s", requests, got, delay)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	if got := AccountKey("  Jane@Example.COM "); got != "account:jane@example.com" {
+		t.Errorf("AccountKey = %q, want the email lowercased and trimmed", got)
+	}
+	if got := IPKey("127.0.0.1"); got != "ip:127.0.0.1" {
+		t.Errorf("IPKey = %q", got)
+	}
+	if PasswordResetKey("Jane@Example.com") == AccountKey("Jane@Example.com") || PasswordResetIPKey("127.0.0.1") == IPKey("127.0.0.1") {
+		t.Error("password reset requests share keys with failed logins")
+	}
+}
@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails. Pick an implementation with FromEnv.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// FromEnv returns the mailer configured by the environment:
+//
+//   - SMTP_HOST (with SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM)
+//     sends real emails over SMTP
+//   - MAIL_DIR writes each email to a file in that directory
+//   - otherwise emails are only logged
+func FromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@social-network.local"
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		return &FileMailer{Dir: dir, From: from}
+	}
+
+	return &LogMailer{From: from}
+}
+
+// SMTPMailer sends emails through an SMTP server, using STARTTLS when the
+// server offers it
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(s.Host+":"+s.Port, auth, s.From, []string{msg.To}, format(s.From, msg))
+}
+
+// FileMailer writes every email to its own .eml file, for development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (f *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	return os.WriteFile(filepath.Join(f.Dir, name), format(f.From, msg), 0o644)
+}
+
+// LogMailer only logs emails. It is used when no mail settings are given.
+type LogMailer struct {
+	From string
+}
+
+func (l *LogMailer) Send(msg Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// headerValue strips line breaks so values can't inject extra headers
+var headerValue = strings.NewReplacer("\r", "", "\n", "")
+
+// format renders msg as an RFC 5322 message
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + headerValue.Replace(from) + "\r\n")
+	b.WriteString("To: " + headerValue.Replace(msg.To) + "\r\n")
+	b.WriteString("Subject: " + headerValue.Replace(msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Mailer
+	}{
+		{"nothing set", nil, &LogMailer{From: "no-reply@social-network.local"}},
+		{"mail dir", map[string]string{"MAIL_DIR": "/tmp/mail", "MAIL_FROM": "hi@example.com"},
+			&FileMailer{Dir: "/tmp/mail", From: "hi@example.com"}},
+		{"smtp", map[string]string{"SMTP_HOST": "smtp.example.com", "SMTP_USERNAME": "user", "SMTP_PASSWORD": "secret"},
+			&SMTPMailer{Host: "smtp.example.com", Port: "587", Username: "user", Password: "secret", From: "no-reply@social-network.local"}},
+		{"smtp wins over mail dir", map[string]string{"SMTP_HOST": "smtp.example.com", "SMTP_PORT": "2525", "MAIL_DIR": "/tmp/mail"},
+			&SMTPMailer{Host: "smtp.example.com", Port: "2525", From: "no-reply@social-network.local"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "MAIL_FROM", "MAIL_DIR"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			got := FromEnv()
+			switch want := tt.want.(type) {
+			case *LogMailer:
+				if g, ok := got.(*LogMailer); !ok || *g != *want {
+					t.Errorf("FromEnv() = %#v, want %#v", got, want)
+				}
+			case *FileMailer:
+				if g, ok := got.(*FileMailer); !ok || *g != *want {
+					t.Errorf("FromEnv() = %#v, want %#v", got, want)
+				}
+			case *SMTPMailer:
+				if g, ok := got.(*SMTPMailer); !ok || *g != *want {
+					t.Errorf("FromEnv() = %#v, want %#v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	mail := &FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+	err := mail.Send(Message{To: "jane@example.com", Subject: "Hello\r\nBcc: eve@example.com", Body: "line one\nline two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*jane_at_example.com.eml"))
+	if len(files) != 1 {
+		t.Fatalf("wrote %v, want one file for jane", files)
+	}
+	content, _ := os.ReadFile(files[0])
+	msg := string(content)
+
+	for _, want := range []string{"From: no-reply@example.com\r\n", "To: jane@example.com\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message is missing %q:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Errorf("a line break in the subject added a header:\n%s", msg)
+	}
+}
@@ -0,0 +1,488 @@
+package notifications
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+)
+
+// Channels a notification can be delivered on. Each one matches a column of
+// the notification_preferences table.
+const (
+	ChannelInApp  = "in_app"
+	ChannelPush   = "push"
+	ChannelDigest = "digest"
+)
+
+const (
+	// AggregationWindow is how long an unread notification keeps absorbing
+	// new notifications of the same type and target
+	AggregationWindow = 24 * time.Hour
+
+	// MaxActors is how many actors are listed on a notification
+	MaxActors = 3
+)
+
+// Types of realtime frames sent by this package
+const (
+	FrameNotification        = "notification"
+	FrameUnreadCount         = "unread_count"
+	FrameNotificationRemoved = "notification_removed"
+)
+
+// Execer is satisfied by both *sql.DB and *sql.Tx so a producer can store its
+// notification inside the same transaction as the change that caused it.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Frame is a message sent to a user over their realtime connection
+type Frame struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Publisher delivers a frame to every realtime connection of a user
+type Publisher func(userID int, frame Frame)
+
+var publisher Publisher
+
+// SetPublisher registers the function used to push notifications in realtime.
+// The api package owns the sockets, so it is wired up from main.
+func SetPublisher(p Publisher) {
+	publisher = p
+}
+
+// WebPusher delivers a notification to a user's browsers through Web Push.
+// It decides itself whether the user needs it, e.g. because they are offline.
+type WebPusher func(n m.Notification)
+
+var webPusher WebPusher
+
+// SetWebPusher registers the function used to send notifications through
+// Web Push. It is called for every stored notification that is pushed.
+func SetWebPusher(p WebPusher) {
+	webPusher = p
+}
+
+// Send stores a notification and pushes it to the recipient, honouring their
+// preferences, mutes and the notification's idempotency key. n.ID is set when
+// the notification is stored.
+func Send(n *m.Notification) error {
+	deliver, err := Persist(sqlite.DB, n)
+	if err != nil || !deliver {
+		return err
+	}
+	Push(*n)
+	return nil
+}
+
+// Key builds an idempotency key from the parts that identify the event a
+// notification is about, e.g. Key(m.NotificationTypeFollow, followRowID).
+func Key(parts ...interface{}) string {
+	key := make([]string, len(parts))
+	for i, part := range parts {
+		key[i] = fmt.Sprint(part)
+	}
+	return strings.Join(key, ":")
+}
+
+// Persist stores a notification unless the recipient turned off in-app
+// notifications of its type. It reports whether the notification should be
+// delivered at all: false when it wasn't stored, because the recipient turned
+// off in-app notifications of its type, muted where it came from or already
+// has a notification with the same idempotency key. Call Push only when it
+// returns true, once the surrounding transaction, if any, has been committed.
+//
+// A notification of an aggregated type is folded into the recipient's unread
+// notification with the same type and target from the last
+// AggregationWindow, if there is one. n then describes that notification.
+func Persist(q Execer, n *m.Notification) (bool, error) {
+	muted, err := Muted(q, *n)
+	if err != nil || muted {
+		return false, err
+	}
+
+	enabled, err := Enabled(q, n.ToUserID, n.Type, ChannelInApp)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		// Without a stored row clients couldn't mark it read
+		return false, nil
+	}
+
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+	n.UpdatedAt = n.CreatedAt
+	if n.FromUserID != 0 {
+		n.ActorCount = 1
+	}
+
+	if m.IsAggregatedNotification(n.Type) && n.TargetType != "" && n.FromUserID != 0 {
+		folded, deliver, err := fold(q, n)
+		if err != nil || folded {
+			return deliver, err
+		}
+	}
+
+	err = q.QueryRow(`
+		INSERT OR IGNORE INTO notifications (
+			to_user_id, from_user_id, content, type, group_id, read, created_at,
+			idempotency_key, target_type, target_id, actor_count, updated_at, seq
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, `+nextSeq+`)
+		RETURNING id, seq`,
+		n.ToUserID,
+		sql.NullInt64{Int64: int64(n.FromUserID), Valid: n.FromUserID != 0},
+		n.Content,
+		n.Type,
+		sql.NullInt64{Int64: int64(n.GroupID), Valid: n.GroupID != 0},
+		n.Read,
+		n.CreatedAt,
+		sql.NullString{String: n.IdempotencyKey, Valid: n.IdempotencyKey != ""},
+		sql.NullString{String: n.TargetType, Valid: n.TargetType != ""},
+		sql.NullInt64{Int64: int64(n.TargetID), Valid: n.TargetType != ""},
+		n.ActorCount,
+		n.UpdatedAt,
+		n.ToUserID,
+	).Scan(&n.ID, &n.Seq)
+	if err == sql.ErrNoRows {
+		// Ignored as a duplicate
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if n.FromUserID != 0 {
+		if _, err := addActor(q, *n); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// nextSeq is the seq a created or updated notification of the user bound to
+// it gets
+const nextSeq = "(SELECT COALESCE(MAX(seq), 0) + 1 FROM notifications WHERE to_user_id = ?)"
+
+// fold merges n into a matching unread notification of the recipient. It
+// reports whether n was handled, either folded or dropped as a duplicate, and
+// whether the updated notification should be pushed.
+func fold(q Execer, n *m.Notification) (bool, bool, error) {
+	if n.IdempotencyKey != "" {
+		var seen bool
+		err := q.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM notification_actors WHERE idempotency_key = ?)
+			OR EXISTS (SELECT 1 FROM notifications WHERE idempotency_key = ?)`,
+			n.IdempotencyKey, n.IdempotencyKey,
+		).Scan(&seen)
+		if err != nil || seen {
+			return true, false, err
+		}
+	}
+
+	var existing m.Notification
+	err := q.QueryRow(`
+		SELECT id, created_at FROM notifications
+		WHERE to_user_id = ? AND type = ? AND target_type = ? AND target_id = ?
+		AND read = false AND datetime(updated_at) >= datetime(?)
+		ORDER BY id DESC
+		LIMIT 1`,
+		n.ToUserID, n.Type, n.TargetType, n.TargetID, n.CreatedAt.Add(-AggregationWindow),
+	).Scan(&existing.ID, &existing.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	n.ID = existing.ID
+	added, err := addActor(q, *n)
+	if err != nil || !added {
+		return true, false, err
+	}
+
+	var latestActor string
+	err = q.QueryRow(`
+		SELECT (SELECT COUNT(DISTINCT actor_id) FROM notification_actors WHERE notification_id = ?),
+			(SELECT username FROM users WHERE id = ?)`,
+		n.ID, n.FromUserID,
+	).Scan(&n.ActorCount, &latestActor)
+	if err != nil {
+		return true, false, err
+	}
+	if n.ActorCount > 1 {
+		n.Content = m.AggregateContent(n.Type, latestActor, n.ActorCount-1)
+	}
+
+	err = q.QueryRow(`
+		UPDATE notifications
+		SET content = ?, from_user_id = ?, actor_count = ?, updated_at = ?, seq = `+nextSeq+`
+		WHERE id = ?
+		RETURNING seq`,
+		n.Content, n.FromUserID, n.ActorCount, n.UpdatedAt, n.ToUserID, n.ID,
+	).Scan(&n.Seq)
+	if err != nil {
+		return true, false, err
+	}
+
+	n.CreatedAt = existing.CreatedAt
+	return true, true, nil
+}
+
+// addActor records that n.FromUserID took part in notification n.ID. It
+// reports false when the idempotency key was already recorded.
+func addActor(q Execer, n m.Notification) (bool, error) {
+	result, err := q.Exec(`
+		INSERT OR IGNORE INTO notification_actors (notification_id, actor_id, idempotency_key, created_at)
+		VALUES (?, ?, ?, ?)`,
+		n.ID,
+		n.FromUserID,
+		sql.NullString{String: n.IdempotencyKey, Valid: n.IdempotencyKey != ""},
+		n.UpdatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	added, _ := result.RowsAffected()
+	return added > 0, nil
+}
+
+// Actors loads the most recent distinct actors of each notification, at most
+// MaxActors per notification, keyed by notification id.
+func Actors(notificationIDs []int) (map[int][]m.NotificationActor, error) {
+	actors := make(map[int][]m.NotificationActor)
+	if len(notificationIDs) == 0 {
+		return actors, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(notificationIDs)), ",")
+	args := make([]interface{}, len(notificationIDs))
+	for i, id := range notificationIDs {
+		args[i] = id
+	}
+
+	rows, err := sqlite.DB.Query(`
+		SELECT na.notification_id, u.id, u.username, u.avatar
+		FROM notification_actors na
+		JOIN users u ON u.id = na.actor_id
+		WHERE na.notification_id IN (`+placeholders+`)
+		GROUP BY na.notification_id, u.id
+		ORDER BY na.notification_id, MAX(na.id) DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var notificationID int
+		var actor m.NotificationActor
+		var avatar sql.NullString
+		if err := rows.Scan(&notificationID, &actor.ID, &actor.Username, &avatar); err != nil {
+			return nil, err
+		}
+		if len(actors[notificationID]) == MaxActors {
+			continue
+		}
+		actor.Avatar = avatar.String
+		actors[notificationID] = append(actors[notificationID], actor)
+	}
+	return actors, rows.Err()
+}
+
+// Push sends a notification to the recipient's realtime connections unless
+// they turned off push for its type or muted where it came from. When the
+// notification was stored, the recipient's new unread count is sent as well.
+func Push(n m.Notification) {
+	if publisher == nil {
+		return
+	}
+
+	muted, err := Muted(sqlite.DB, n)
+	if err != nil || muted {
+		return
+	}
+	if n.ID != 0 {
+		defer PublishUnreadCount(n.ToUserID)
+	}
+
+	enabled, err := Enabled(sqlite.DB, n.ToUserID, n.Type, ChannelPush)
+	if err != nil || !enabled {
+		return
+	}
+
+	if n.ID != 0 && n.FromUserID != 0 {
+		actors, err := Actors([]int{n.ID})
+		if err != nil {
+			log.Printf("Error loading actors of notification %d: %v", n.ID, err)
+		}
+		n.Actors = actors[n.ID]
+	}
+
+	publisher(n.ToUserID, Frame{Type: FrameNotification, Data: n})
+	// Only notifications Persist created reach the user's browsers
+	if webPusher != nil && n.ID != 0 {
+		webPusher(n)
+	}
+}
+
+// UnreadCount counts a user's unread notifications. Follow requests that were
+// already answered or withdrawn are not counted, matching what
+// GET /notifications lists.
+func UnreadCount(q Execer, userID int) (int, error) {
+	var count int
+	err := q.QueryRow(`
+		SELECT COUNT(*) FROM notifications n
+		WHERE n.to_user_id = ? AND n.read = false
+		AND (
+			n.type != 'follow_request'
+			OR EXISTS (
+				SELECT 1 FROM followers
+				WHERE follower_id = n.from_user_id
+				AND followed_id = n.to_user_id
+				AND status = 'pending'
+			)
+		)`,
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+// Retract deletes the notifications of the given types that fromUserID sent
+// toUserID, for when what they were about was undone, and returns their ids.
+// Pass the ids to PublishRemoved once the surrounding transaction, if any, has
+// been committed.
+func Retract(q Execer, toUserID, fromUserID int, types ...string) ([]int, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(types)), ",")
+	args := []interface{}{toUserID, fromUserID}
+	for _, t := range types {
+		args = append(args, t)
+	}
+	where := "to_user_id = ? AND from_user_id = ? AND type IN (" + placeholders + ")"
+
+	var list string
+	if err := q.QueryRow("SELECT COALESCE(group_concat(id), '') FROM notifications WHERE "+where, args...).Scan(&list); err != nil {
+		return nil, err
+	}
+	if list == "" {
+		return nil, nil
+	}
+	if _, err := q.Exec("DELETE FROM notifications WHERE "+where, args...); err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, id := range strings.Split(list, ",") {
+		var n int
+		if _, err := fmt.Sscan(id, &n); err == nil {
+			ids = append(ids, n)
+		}
+	}
+	return ids, nil
+}
+
+// PublishRemoved tells a user that notifications they were sent are gone so
+// clients can drop them, followed by their new unread count
+func PublishRemoved(userID int, ids []int) {
+	if publisher == nil || len(ids) == 0 {
+		return
+	}
+
+	publisher(userID, Frame{Type: FrameNotificationRemoved, Data: map[string][]int{"ids": ids}})
+	PublishUnreadCount(userID)
+}
+
+// PublishUnreadCount sends a user their current unread count so badges stay
+// in sync. Call it after anything that changes which notifications are unread.
+func PublishUnreadCount(userID int) {
+	if publisher == nil {
+		return
+	}
+
+	count, err := UnreadCount(sqlite.DB, userID)
+	if err != nil {
+		log.Printf("Error counting unread notifications for user %d: %v", userID, err)
+		return
+	}
+
+	publisher(userID, Frame{Type: FrameUnreadCount, Data: map[string]int{"count": count}})
+}
+
+// Enabled reports whether a user wants notifications of a type on a channel.
+// Everything is enabled until the user says otherwise.
+func Enabled(q Execer, userID int, notificationType, channel string) (bool, error) {
+	switch channel {
+	case ChannelInApp, ChannelPush, ChannelDigest:
+	default:
+		return false, fmt.Errorf("unknown notification channel %q", channel)
+	}
+
+	var enabled bool
+	err := q.QueryRow(
+		"SELECT "+channel+" FROM notification_preferences WHERE user_id = ? AND type = ?",
+		userID, notificationType,
+	).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	return enabled, err
+}
+
+// Muted reports whether the recipient muted the user, group or direct
+// conversation a notification came from. Notifications that ask the user to
+// act on something, such as follow requests and invitations, are never muted.
+func Muted(q Execer, n m.Notification) (bool, error) {
+	if m.IsActionableNotification(n.Type) {
+		return false, nil
+	}
+
+	if n.FromUserID != 0 {
+		muted, err := MutedTarget(q, n.ToUserID, m.MuteTargetUser, n.FromUserID)
+		if err != nil || muted {
+			return muted, err
+		}
+	}
+
+	var targetType string
+	var targetID int
+	switch {
+	case n.GroupID != 0:
+		targetType, targetID = m.MuteTargetGroup, n.GroupID
+	case n.Type == m.NotificationChatMention:
+		targetType, targetID = m.MuteTargetConversation, n.FromUserID
+	default:
+		return false, nil
+	}
+
+	return MutedTarget(q, n.ToUserID, targetType, targetID)
+}
+
+// MutedTarget reports whether a user has an unexpired mute of a group, a
+// direct conversation or another user
+func MutedTarget(q Execer, userID int, targetType string, targetID int) (bool, error) {
+	var muted bool
+	err := q.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM mutes WHERE user_id = ? AND target_type = ? AND target_id = ?
+			AND (expires_at IS NULL OR julianday(expires_at) > julianday('now'))
+		)`,
+		userID, targetType, targetID,
+	).Scan(&muted)
+	return muted, err
+}
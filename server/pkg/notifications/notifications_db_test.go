@@ -0,0 +1,256 @@
+//go:build sqlite_fts5
+
+package notifications
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	m "social-network/models"
+	"social-network/pkg/db/sqlite"
+	"social-network/pkg/db/sqlite/sqlitetest"
+)
+
+// recordFrames collects the frames published to each user until t ends
+func recordFrames(t *testing.T) map[int][]Frame {
+	frames := make(map[int][]Frame)
+	SetPublisher(func(userID int, frame Frame) {
+		frames[userID] = append(frames[userID], frame)
+	})
+	t.Cleanup(func() { SetPublisher(nil) })
+	return frames
+}
+
+// likeOf builds the notification user 1 gets when actorID likes postID
+func likeOf(actorID, postID int) m.Notification {
+	return m.Notification{
+		ToUserID:       1,
+		FromUserID:     actorID,
+		Content:        "liked your post",
+		Type:           m.NotificationPostLike,
+		CreatedAt:      time.Now(),
+		IdempotencyKey: Key(m.NotificationPostLike, postID, actorID),
+		TargetType:     m.SourcePost,
+		TargetID:       postID,
+	}
+}
+
+func count(t *testing.T, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := sqlite.DB.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSendSkipsEveryChannelWithoutInApp(t *testing.T) {
+	sqlitetest.Open(t)
+	frames := recordFrames(t)
+	var webPushed []m.Notification
+	SetWebPusher(func(n m.Notification) { webPushed = append(webPushed, n) })
+	defer SetWebPusher(nil)
+
+	_, err := sqlite.DB.Exec(
+		"INSERT INTO notification_preferences (user_id, type, in_app, push, digest) VALUES (1, ?, false, true, true)",
+		m.NotificationPostLike,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := likeOf(2, 10)
+	deliver, err := Persist(sqlite.DB, &n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deliver {
+		t.Error("Persist asked to deliver a notification it didn't store")
+	}
+	if got := count(t, "SELECT COUNT(*) FROM notifications WHERE type = ?", m.NotificationPostLike); got != 0 {
+		t.Errorf("stored %d notifications, want none", got)
+	}
+
+	n = likeOf(2, 11)
+	if err := Send(&n); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames[1]) != 0 || len(webPushed) != 0 {
+		t.Errorf("sent %d frames and %d web pushes, want none", len(frames[1]), len(webPushed))
+	}
+}
+
+func TestOnlyStoredNotificationsAreWebPushed(t *testing.T) {
+	sqlitetest.Open(t)
+	recordFrames(t)
+	var webPushed []m.Notification
+	SetWebPusher(func(n m.Notification) { webPushed = append(webPushed, n) })
+	defer SetWebPusher(nil)
+
+	Push(likeOf(2, 10))
+	if len(webPushed) != 0 {
+		t.Errorf("a notification that was never stored was web pushed: %+v", webPushed)
+	}
+
+	n := likeOf(2, 11)
+	if err := Send(&n); err != nil {
+		t.Fatal(err)
+	}
+	if len(webPushed) != 1 || webPushed[0].ID != n.ID || n.ID == 0 {
+		t.Errorf("web pushed %+v, want the stored notification %d", webPushed, n.ID)
+	}
+}
+
+func TestSendIsIdempotent(t *testing.T) {
+	sqlitetest.Open(t)
+	frames := recordFrames(t)
+
+	invite := func() m.Notification {
+		return m.Notification{
+			ToUserID:       2,
+			FromUserID:     1,
+			Content:        "invited you to a group",
+			Type:           m.NotificationGroupInvite,
+			CreatedAt:      time.Now(),
+			IdempotencyKey: Key(m.NotificationGroupInvite, 7, 2),
+		}
+	}
+	first := invite()
+	if err := Send(&first); err != nil {
+		t.Fatal(err)
+	}
+	retry := invite()
+	if err := Send(&retry); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := count(t, "SELECT COUNT(*) FROM notifications WHERE idempotency_key = ?", first.IdempotencyKey); got != 1 {
+		t.Errorf("stored %d notifications for one invitation, want 1", got)
+	}
+	if retry.ID != 0 {
+		t.Errorf("the retry was stored as notification %d", retry.ID)
+	}
+	var published int
+	for _, frame := range frames[2] {
+		if frame.Type == FrameNotification {
+			published++
+		}
+	}
+	if published != 1 {
+		t.Errorf("published %d notifications, want only the first invitation", published)
+	}
+
+	// A like that was already folded into a notification isn't counted twice
+	like := likeOf(2, 10)
+	if err := Send(&like); err != nil {
+		t.Fatal(err)
+	}
+	other := likeOf(3, 10)
+	if err := Send(&other); err != nil {
+		t.Fatal(err)
+	}
+	again := likeOf(3, 10)
+	if err := Send(&again); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, "SELECT actor_count FROM notifications WHERE id = ?", like.ID); got != 2 {
+		t.Errorf("actor count = %d after a repeated like, want 2", got)
+	}
+}
+
+func TestKeyJoinsItsParts(t *testing.T) {
+	if got, want := Key(m.NotificationTypeFollow, 12, "x"), "follow_request:12:x"; got != want {
+		t.Errorf("Key = %q, want %q", got, want)
+	}
+}
+
+func TestFollowRowsNoLongerCreateNotifications(t *testing.T) {
+	sqlitetest.Open(t)
+
+	before := count(t, "SELECT COUNT(*) FROM notifications")
+	if _, err := sqlite.DB.Exec("INSERT INTO followers (follower_id, followed_id, status) VALUES (3, 2, 'pending')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlite.DB.Exec("UPDATE followers SET status = 'accept' WHERE follower_id = 3 AND followed_id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, "SELECT COUNT(*) FROM notifications"); got != before {
+		t.Errorf("follow changes created %d notifications by trigger, want none", got-before)
+	}
+}
+
+// sendLike sends like and fails the test on error
+func sendLike(t *testing.T, like m.Notification) m.Notification {
+	t.Helper()
+	if err := Send(&like); err != nil {
+		t.Fatal(err)
+	}
+	return like
+}
+
+func TestLikesOfOnePostFoldIntoOneNotification(t *testing.T) {
+	sqlitetest.Open(t)
+	recordFrames(t)
+
+	first := sendLike(t, likeOf(2, 10))
+	folded := sendLike(t, likeOf(3, 10))
+	otherPost := sendLike(t, likeOf(3, 11))
+
+	if folded.ID != first.ID {
+		t.Fatalf("second like created notification %d, want it folded into %d", folded.ID, first.ID)
+	}
+	if otherPost.ID == first.ID {
+		t.Error("a like of another post was folded in")
+	}
+	if folded.ActorCount != 2 || !strings.HasPrefix(folded.Content, "bob_wilson and 1 other") {
+		t.Errorf("folded notification = %d actors, %q", folded.ActorCount, folded.Content)
+	}
+
+	actors, err := Actors([]int{first.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actors[first.ID]; len(got) != 2 || got[0].ID != 3 || got[1].ID != 2 {
+		t.Errorf("actors = %+v, want users 3 then 2", got)
+	}
+}
+
+func TestReadOrOldNotificationsAreNotFolded(t *testing.T) {
+	sqlitetest.Open(t)
+	recordFrames(t)
+
+	first := sendLike(t, likeOf(2, 10))
+	if _, err := sqlite.DB.Exec("UPDATE notifications SET read = true WHERE id = ?", first.ID); err != nil {
+		t.Fatal(err)
+	}
+	afterRead := sendLike(t, likeOf(3, 10))
+	if afterRead.ID == first.ID {
+		t.Error("a like was folded into a read notification")
+	}
+
+	late := likeOf(4, 10)
+	late.CreatedAt = time.Now().Add(AggregationWindow + time.Hour)
+	late = sendLike(t, late)
+	if late.ID == afterRead.ID {
+		t.Error("a like was folded into a notification older than the aggregation window")
+	}
+}
+
+func TestDeletingANotificationDropsItsActors(t *testing.T) {
+	sqlitetest.Open(t)
+	recordFrames(t)
+
+	n := sendLike(t, likeOf(2, 10))
+	sendLike(t, likeOf(3, 10))
+	if got := count(t, "SELECT COUNT(*) FROM notification_actors WHERE notification_id = ?", n.ID); got != 2 {
+		t.Fatalf("notification has %d actors, want 2", got)
+	}
+
+	if _, err := sqlite.DB.Exec("DELETE FROM notifications WHERE id = ?", n.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, "SELECT COUNT(*) FROM notification_actors WHERE notification_id = ?", n.ID); got != 0 {
+		t.Errorf("%d actors were left behind", got)
+	}
+}
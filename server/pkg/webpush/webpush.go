@@ -0,0 +1,276 @@
+// Package webpush sends Web Push messages: payloads are encrypted as described
+// in RFC 8291 (aes128gcm) and requests are signed with VAPID (RFC 8292).
+package webpush
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// recordSize is the record size announced in the aes128gcm header. Payloads
+// are sent as a single record, so they must fit in it.
+const recordSize = 4096
+
+// MaxPayloadSize is the largest payload Send accepts: a record minus the
+// padding delimiter and the AES-GCM tag
+const MaxPayloadSize = recordSize - 1 - 16
+
+// ErrGone is returned by Send when the push service no longer knows the
+// subscription. The subscription should be deleted.
+var ErrGone = errors.New("webpush: subscription expired")
+
+// Subscription is what the browser's PushManager.subscribe() returns
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// Keys is the application server's VAPID key pair
+type Keys struct {
+	private *ecdh.PrivateKey
+	signer  *ecdsa.PrivateKey
+}
+
+// GenerateKeys creates a new VAPID key pair
+func GenerateKeys() (*Keys, error) {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newKeys(private)
+}
+
+// ParseKeys loads a VAPID key pair from its base64url encoded private key,
+// as returned by Keys.PrivateKey
+func ParseKeys(privateKey string) (*Keys, error) {
+	raw, err := decode(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid private key: %w", err)
+	}
+	private, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid private key: %w", err)
+	}
+	return newKeys(private)
+}
+
+func newKeys(private *ecdh.PrivateKey) (*Keys, error) {
+	public := private.PublicKey().Bytes()
+	signer := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:65]),
+		},
+		D: new(big.Int).SetBytes(private.Bytes()),
+	}
+	return &Keys{private: private, signer: signer}, nil
+}
+
+// PublicKey is the base64url encoded public key browsers pass as
+// applicationServerKey when subscribing
+func (k *Keys) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.private.PublicKey().Bytes())
+}
+
+// PrivateKey is the base64url encoded private key, for storing the key pair
+func (k *Keys) PrivateKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.private.Bytes())
+}
+
+// Sender delivers push messages
+type Sender struct {
+	Keys *Keys
+	// Subject is a mailto: or https: URL push services can use to reach
+	// whoever runs the server
+	Subject string
+	// Client sends the requests. http.DefaultClient is used when it is nil.
+	Client *http.Client
+	// TTL is how long the push service keeps a message for an offline
+	// browser
+	TTL time.Duration
+}
+
+// Send encrypts payload for the subscription and posts it to its push
+// service. It returns ErrGone when the subscription has expired.
+func (s *Sender) Send(sub Subscription, payload []byte) error {
+	body, err := Encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return fmt.Errorf("webpush: invalid endpoint %q", sub.Endpoint)
+	}
+	token, err := s.vapidToken(endpoint.Scheme + "://" + endpoint.Host)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.Keys.PublicKey())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("webpush: push service responded %s", resp.Status)
+	}
+	return nil
+}
+
+// vapidToken signs the JWT that identifies this server to the push service
+// at audience (RFC 8292 section 2)
+func (s *Sender) vapidToken(audience string) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": audience,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": s.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, sig, err := ecdsa.Sign(rand.Reader, s.Keys.signer, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Encrypt encrypts payload for the subscription's browser as a single
+// aes128gcm record (RFC 8291 section 3 and RFC 8188)
+func Encrypt(sub Subscription, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("webpush: payload of %d bytes is too large", len(payload))
+	}
+
+	rawUAPublic, err := decode(sub.Keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid p256dh key: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(rawUAPublic)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid p256dh key: %w", err)
+	}
+	authSecret, err := decode(sub.Keys.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, errors.New("webpush: invalid auth secret")
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	// IKM = HKDF(auth_secret, ecdh_secret, "WebPush: info" || 0x00 || ua_public || as_public, 32)
+	keyInfo := append(append([]byte("WebPush: info\x00"), rawUAPublic...), asPublic...)
+	ikm, err := expand(sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := expand(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := expand(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// The 0x02 delimiter marks the last (and only) record
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	// Header: salt (16) || record size (4) || key id length (1) || key id
+	body := make([]byte, 0, 16+4+1+len(asPublic)+len(plaintext)+gcm.Overhead())
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+	return gcm.Seal(body, nonce, plaintext, nil), nil
+}
+
+// expand derives length bytes from secret with HKDF-SHA-256
+func expand(secret, salt, info []byte, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// decode accepts the base64url keys browsers produce, with or without padding
+func decode(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
@@ -0,0 +1,247 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// browser is the receiving end of a subscription
+type browser struct {
+	private *ecdh.PrivateKey
+	auth    []byte
+}
+
+func newBrowser(t *testing.T) *browser {
+	t.Helper()
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return &browser{private: private, auth: auth}
+}
+
+func (b *browser) subscription(endpoint string) Subscription {
+	var sub Subscription
+	sub.Endpoint = endpoint
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(b.private.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(b.auth)
+	return sub
+}
+
+// decrypt reverses Encrypt the way a browser does (RFC 8291 section 3)
+func (b *browser) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	if len(body) < 21 {
+		t.Fatalf("body of %d bytes is too short", len(body))
+	}
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != recordSize {
+		t.Errorf("record size = %d, want %d", rs, recordSize)
+	}
+	idLength := int(body[20])
+	asPublicBytes := body[21 : 21+idLength]
+	ciphertext := body[21+idLength:]
+
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	if err != nil {
+		t.Fatalf("key id is not a P-256 key: %v", err)
+	}
+	shared, err := b.private.ECDH(asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), b.private.PublicKey().Bytes()...), asPublicBytes...)
+	ikm, _ := expand(shared, b.auth, keyInfo, 32)
+	cek, _ := expand(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce, _ := expand(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("decrypting: %v", err)
+	}
+
+	end := bytes.LastIndexFunc(plaintext, func(r rune) bool { return r != 0 })
+	if end < 0 || plaintext[end] != 0x02 {
+		t.Fatal("last record is missing its 0x02 delimiter")
+	}
+	return plaintext[:end]
+}
+
+// checkVAPID verifies the Authorization header of a push request was signed
+// by keys for audience (RFC 8292 section 3)
+func checkVAPID(t *testing.T, header string, keys *Keys, audience, subject string) {
+	t.Helper()
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(header, "vapid "), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+	if !strings.HasPrefix(header, "vapid ") || token == "" {
+		t.Fatalf("Authorization = %q, want a vapid scheme with a token", header)
+	}
+	if key != keys.PublicKey() {
+		t.Errorf("k = %q, want the server's public key %q", key, keys.PublicKey())
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q is not a JWT", token)
+	}
+	rawKey, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil || len(rawKey) != 65 {
+		t.Fatalf("k is not an uncompressed P-256 key")
+	}
+	public := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(rawKey[1:33]),
+		Y:     new(big.Int).SetBytes(rawKey[33:]),
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		t.Fatalf("signature is not a raw ES256 signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(public, digest[:], r, s) {
+		t.Fatal("token signature does not verify with k")
+	}
+
+	rawClaims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		t.Fatalf("claims: %v", err)
+	}
+	if claims.Aud != audience {
+		t.Errorf("aud = %q, want %q", claims.Aud, audience)
+	}
+	if claims.Sub != subject {
+		t.Errorf("sub = %q, want %q", claims.Sub, subject)
+	}
+	if exp := time.Unix(claims.Exp, 0); exp.Before(time.Now()) || exp.After(time.Now().Add(24*time.Hour)) {
+		t.Errorf("exp = %v, want within the next 24 hours", exp)
+	}
+}
+
+func TestSendDeliversEncryptedSignedPayload(t *testing.T) {
+	keys, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBrowser(t)
+	payload := []byte(`{"type":"follow_request","title":"Social Network","body":"jane wants to follow you"}`)
+
+	var received []byte
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if got := r.Header.Get("Content-Encoding"); got != "aes128gcm" {
+			t.Errorf("Content-Encoding = %q, want aes128gcm", got)
+		}
+		if r.Header.Get("TTL") == "" {
+			t.Error("TTL header is missing")
+		}
+		checkVAPID(t, r.Header.Get("Authorization"), keys, server.URL, "mailto:admin@example.com")
+
+		body, _ := io.ReadAll(r.Body)
+		received = b.decrypt(t, body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sender := &Sender{Keys: keys, Subject: "mailto:admin@example.com", Client: server.Client()}
+	if err := sender.Send(b.subscription(server.URL+"/push/abc"), payload); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if !bytes.Equal(received, payload) {
+		t.Errorf("push service received %q, want %q", received, payload)
+	}
+}
+
+func TestSendReportsExpiredSubscriptions(t *testing.T) {
+	keys, _ := GenerateKeys()
+	b := newBrowser(t)
+
+	for _, status := range []int{http.StatusGone, http.StatusNotFound} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		sender := &Sender{Keys: keys, Subject: "mailto:admin@example.com", Client: server.Client()}
+		if err := sender.Send(b.subscription(server.URL), []byte("hi")); err != ErrGone {
+			t.Errorf("status %d: Send = %v, want ErrGone", status, err)
+		}
+		server.Close()
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	sender := &Sender{Keys: keys, Subject: "mailto:admin@example.com", Client: server.Client()}
+	if err := sender.Send(b.subscription(server.URL), []byte("hi")); err == nil || err == ErrGone {
+		t.Errorf("status 429: Send = %v, want another error", err)
+	}
+}
+
+func TestParseKeysRoundTrip(t *testing.T) {
+	keys, _ := GenerateKeys()
+	parsed, err := ParseKeys(keys.PrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.PublicKey() != keys.PublicKey() {
+		t.Error("parsed keys have a different public key")
+	}
+}
+
+func TestEncryptRejectsBadSubscriptions(t *testing.T) {
+	b := newBrowser(t)
+	sub := b.subscription("https://fcm.googleapis.com/fcm/send/abc")
+	if _, err := Encrypt(sub, make([]byte, MaxPayloadSize+1)); err == nil {
+		t.Error("payload over MaxPayloadSize was accepted")
+	}
+
+	short := sub
+	short.Keys.Auth = base64.RawURLEncoding.EncodeToString([]byte("short"))
+	if _, err := Encrypt(short, nil); err == nil {
+		t.Error("auth secret that isn't 16 bytes was accepted")
+	}
+
+	bad := sub
+	bad.Keys.P256dh = "not-a-key"
+	if _, err := Encrypt(bad, nil); err == nil {
+		t.Error("invalid p256dh key was accepted")
+	}
+}
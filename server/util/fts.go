@@ -0,0 +1,37 @@
+package util
+
+import "strings"
+
+// maxSearchTerms caps how many words of a search box end up in a MATCH expression
+const maxSearchTerms = 10
+
+// FTSQuery turns free text typed by a user into a safe FTS5 MATCH expression.
+// Every word is quoted so FTS operators and punctuation are matched literally,
+// and the last word is treated as a prefix so partial words still match.
+// An empty string is returned when there is nothing to search for.
+func FTSQuery(input string) string {
+	terms := strings.Fields(input)
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+
+	quoted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		quoted = append(quoted, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	if len(quoted) == 0 {
+		return ""
+	}
+
+	quoted[len(quoted)-1] += "*"
+	return strings.Join(quoted, " ")
+}
+
+// FTSColumns restricts a MATCH expression built by FTSQuery to the given
+// columns of the index
+func FTSColumns(match string, columns ...string) string {
+	if match == "" {
+		return ""
+	}
+	return "{" + strings.Join(columns, " ") + "} : (" + match + ")"
+}
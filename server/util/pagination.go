@@ -0,0 +1,104 @@
+package util
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// QueryID reads an optional positive id (such as a keyset cursor) from the
+// query string. A missing parameter yields 0.
+func QueryID(r *http.Request, name string) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New(name + " must be a positive integer")
+	}
+	return id, nil
+}
+
+// PageSize reads the optional `limit` query parameter, falling back to def
+// and capping the result at max.
+func PageSize(r *http.Request, def, max int) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return def, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit, nil
+}
+
+// TimeCursor encodes the position of a row in a list ordered by a time and
+// then by id: the time, as a Julian day, and the id. Carrying both means the
+// next page doesn't depend on the row still existing or keeping its time.
+func TimeCursor(day float64, id int64) string {
+	return strconv.FormatFloat(day, 'g', -1, 64) + "_" + strconv.FormatInt(id, 10)
+}
+
+// ParseTimeCursor reads a cursor made by TimeCursor from the optional `before`
+// query parameter. A missing one starts at the top of the list and yields an
+// id of 0.
+func ParseTimeCursor(r *http.Request) (float64, int64, error) {
+	dayValue, id, err := parseCursor(r)
+	if err != nil || id == 0 {
+		return 0, 0, err
+	}
+	day, err := strconv.ParseFloat(dayValue, 64)
+	if err != nil || math.IsNaN(day) || math.IsInf(day, 0) {
+		return 0, 0, errInvalidCursor
+	}
+	return day, id, nil
+}
+
+// RankCursor encodes the position of a row in a list ordered by a whole
+// number score and then by id, like TimeCursor does for times
+func RankCursor(rank int, id int64) string {
+	return strconv.Itoa(rank) + "_" + strconv.FormatInt(id, 10)
+}
+
+// ParseRankCursor reads a cursor made by RankCursor from the optional
+// `before` query parameter. A missing one yields an id of 0.
+func ParseRankCursor(r *http.Request) (int, int64, error) {
+	rankValue, id, err := parseCursor(r)
+	if err != nil || id == 0 {
+		return 0, 0, err
+	}
+	rank, err := strconv.Atoi(rankValue)
+	if err != nil {
+		return 0, 0, errInvalidCursor
+	}
+	return rank, id, nil
+}
+
+var errInvalidCursor = errors.New("before must be a cursor from X-Next-Cursor")
+
+// parseCursor splits the `before` query parameter into the value rows are
+// ordered by and the id
+func parseCursor(r *http.Request) (string, int64, error) {
+	value := r.URL.Query().Get("before")
+	if value == "" {
+		return "", 0, nil
+	}
+	orderValue, idValue, ok := strings.Cut(value, "_")
+	if !ok {
+		return "", 0, errInvalidCursor
+	}
+	id, err := strconv.ParseInt(idValue, 10, 64)
+	if err != nil || id < 1 {
+		return "", 0, errInvalidCursor
+	}
+	return orderValue, id, nil
+}
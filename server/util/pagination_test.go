@@ -0,0 +1,49 @@
+package util
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTimeCursorRoundTrip(t *testing.T) {
+	parse := func(value string) (float64, int64, error) {
+		return ParseTimeCursor(httptest.NewRequest("GET", "/?before="+url.QueryEscape(value), nil))
+	}
+
+	for _, day := range []float64{2461327.5, 2461327.912345678, 2440587.5000000116} {
+		cursor := TimeCursor(day, 42)
+		gotDay, gotID, err := parse(cursor)
+		if err != nil || gotDay != day || gotID != 42 {
+			t.Errorf("ParseTimeCursor(%q) = %v, %d, %v, want %v, 42", cursor, gotDay, gotID, err, day)
+		}
+	}
+	for _, invalid := range []string{"42", "abc_1", "2461327.5_0", "2461327.5_x", "NaN_1", "_1"} {
+		if _, _, err := parse(invalid); err == nil {
+			t.Errorf("ParseTimeCursor(%q) was accepted", invalid)
+		}
+	}
+
+	if day, id, err := ParseTimeCursor(httptest.NewRequest("GET", "/", nil)); day != 0 || id != 0 || err != nil {
+		t.Errorf("ParseTimeCursor without before = %v, %d, %v, want the top of the list", day, id, err)
+	}
+}
+
+func TestRankCursorRoundTrip(t *testing.T) {
+	parse := func(value string) (int, int64, error) {
+		return ParseRankCursor(httptest.NewRequest("GET", "/?before="+url.QueryEscape(value), nil))
+	}
+
+	for _, rank := range []int{0, 7, 125} {
+		cursor := RankCursor(rank, 42)
+		gotRank, gotID, err := parse(cursor)
+		if err != nil || gotRank != rank || gotID != 42 {
+			t.Errorf("ParseRankCursor(%q) = %d, %d, %v, want %d, 42", cursor, gotRank, gotID, err, rank)
+		}
+	}
+	for _, invalid := range []string{"42", "1.5_1", "3_0", "_1"} {
+		if _, _, err := parse(invalid); err == nil {
+			t.Errorf("ParseRankCursor(%q) was accepted", invalid)
+		}
+	}
+}
@@ -3,12 +3,18 @@ package util
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"net/http"
 	"social-network/pkg/db/sqlite"
+	"sync"
 )
 
-// UserSession stores the mapping of session tokens to user IDs
-var UserSession = make(map[string]uint)
+var (
+	// userSessions maps session tokens to user IDs. Every request uses it,
+	// so it is only accessed through the functions below.
+	userSessions   = make(map[string]uint)
+	userSessionsMu sync.RWMutex
+)
 
 // GenerateSessionToken creates a random session token
 func GenerateSessionToken() string {
@@ -17,6 +23,52 @@ func GenerateSessionToken() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
+// StartSession logs userID in, setting the session cookie on w
+func StartSession(w http.ResponseWriter, userID uint) {
+	sessionToken := GenerateSessionToken()
+	userSessionsMu.Lock()
+	userSessions[sessionToken] = userID
+	userSessionsMu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "AccessToken",
+		Value:    sessionToken,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   false, // Set to true in production with HTTPS
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// RevokeSessions logs userID out everywhere except the session keep. Pass an
+// empty keep to end every session.
+func RevokeSessions(userID uint, keep string) {
+	userSessionsMu.Lock()
+	defer userSessionsMu.Unlock()
+
+	for token, id := range userSessions {
+		if id == userID && token != keep {
+			delete(userSessions, token)
+		}
+	}
+}
+
+// SessionUser returns the user a session token belongs to, if it is valid
+func SessionUser(token string) (uint, bool) {
+	userSessionsMu.RLock()
+	defer userSessionsMu.RUnlock()
+
+	userID, ok := userSessions[token]
+	return userID, ok
+}
+
+// EndSession logs a single session out
+func EndSession(token string) {
+	userSessionsMu.Lock()
+	delete(userSessions, token)
+	userSessionsMu.Unlock()
+}
+
 // GetUsernameFromSession retrieves the username from the session
 func GetUsernameFromSession(r *http.Request) (string, error) {
 	cookie, err := r.Cookie("AccessToken")
@@ -24,7 +76,7 @@ func GetUsernameFromSession(r *http.Request) (string, error) {
 		return "", err
 	}
 
-	userID := UserSession[cookie.Value]
+	userID, _ := SessionUser(cookie.Value)
 	var username string
 	err = sqlite.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
 	if err != nil {
@@ -34,21 +86,32 @@ func GetUsernameFromSession(r *http.Request) (string, error) {
 	return username, nil
 }
 
-func GetUserID(r  *http.Request, w http.ResponseWriter) (uint64, error) {
-	username, err := GetUsernameFromSession(r)
-    if err != nil {
-        http.Error(w, "Unauthorized: no session cookie", http.StatusUnauthorized)
-        return 0, err
-    }
+// GetUserID returns the id of the user the request's session belongs to. It
+// writes a 401 response when there is no valid session.
+func GetUserID(r *http.Request, w http.ResponseWriter) (uint64, error) {
+	cookie, err := r.Cookie("AccessToken")
+	if err != nil {
+		http.Error(w, "Unauthorized: no session cookie", http.StatusUnauthorized)
+		return 0, err
+	}
 
-    var userID uint64
-    err = sqlite.DB.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID)
-    if err != nil {
-        http.Error(w, "Unauthorized: user not found", http.StatusUnauthorized)
-        return 0, err
-    }
+	userID, ok := SessionUser(cookie.Value)
+	if !ok {
+		http.Error(w, "Unauthorized: no session", http.StatusUnauthorized)
+		return 0, errors.New("session not found")
+	}
 
-	return userID, nil
+	// The session outlives a deleted user
+	var exists bool
+	err = sqlite.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists)
+	if err != nil || !exists {
+		http.Error(w, "Unauthorized: user not found", http.StatusUnauthorized)
+		if err == nil {
+			err = errors.New("user not found")
+		}
+		return 0, err
+	}
 
+	return uint64(userID), nil
 }
 
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSessionsAreSafeForConcurrentUse(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				StartSession(httptest.NewRecorder(), 1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				RevokeSessions(1, "")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SessionUser("missing")
+				EndSession("missing")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRevokeSessionsKeepsOneSession(t *testing.T) {
+	keep, other, stranger := httptest.NewRecorder(), httptest.NewRecorder(), httptest.NewRecorder()
+	StartSession(keep, 7)
+	StartSession(other, 7)
+	StartSession(stranger, 8)
+	token := func(rec *httptest.ResponseRecorder) string { return rec.Result().Cookies()[0].Value }
+
+	RevokeSessions(7, token(keep))
+
+	if userID, ok := SessionUser(token(keep)); !ok || userID != 7 {
+		t.Errorf("kept session = %d, %v, want user 7", userID, ok)
+	}
+	if _, ok := SessionUser(token(other)); ok {
+		t.Error("other session of the user is still valid")
+	}
+	if userID, ok := SessionUser(token(stranger)); !ok || userID != 8 {
+		t.Errorf("another user's session = %d, %v, want user 8", userID, ok)
+	}
+
+	EndSession(token(keep))
+	if _, ok := SessionUser(token(keep)); ok {
+		t.Error("session is still valid after EndSession")
+	}
+}
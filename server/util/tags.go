@@ -0,0 +1,64 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxTagsPerText caps how many hashtags or mentions are taken from one piece
+// of content so a single post can't flood the index or notify everyone.
+const maxTagsPerText = 20
+
+var (
+	// A hashtag or mention has to start the text or follow a character that
+	// can't be part of a word, so "a#b" and "me@example.com" are ignored.
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/])#([\p{L}\p{N}_]{1,50})`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@(` + usernameChars + `{1,50})`)
+	digitsPattern  = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// ExtractHashtags returns the distinct hashtags in text, lowercased and without
+// the leading '#'. Purely numeric tags such as "#1" are skipped.
+func ExtractHashtags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tag := strings.ToLower(match[1])
+		if seen[tag] || digitsPattern.MatchString(tag) {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxTagsPerText {
+			break
+		}
+	}
+	return tags
+}
+
+// ExtractMentions returns the distinct usernames mentioned in text without the
+// leading '@'. Usernames may end in a dot, so trailing dots are kept: whoever
+// resolves "thanks @jane." decides between "jane." and "jane" with
+// MentionWithoutDots.
+func ExtractMentions(text string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		username := match[1]
+		if MentionWithoutDots(username) == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+		if len(usernames) == maxTagsPerText {
+			break
+		}
+	}
+	return usernames
+}
+
+// MentionWithoutDots is the username a mention refers to when the dots it
+// ends with close the sentence instead of being part of the name
+func MentionWithoutDots(username string) string {
+	return strings.TrimRight(username, ".")
+}
@@ -0,0 +1,179 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	minPasswordLength = 8
+
+	// bcrypt ignores everything past 72 bytes
+	maxPasswordLength = 72
+
+	minUsernameLength = 3
+	maxUsernameLength = 30
+
+	// usernameChars is the character class of usernames, shared with the
+	// mention pattern so mentions find every valid username
+	usernameChars = `[A-Za-z0-9_.]`
+)
+
+// usernamePattern is the only definition of a valid username. Registration
+// and username changes both check it through Validator.Username.
+var usernamePattern = regexp.MustCompile(fmt.Sprintf(`^%s{%d,%d}$`, usernameChars, minUsernameLength, maxUsernameLength))
+
+// FieldError is the problem with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is the body of every response rejecting a request because
+// of its fields
+type ValidationError struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+// Validator collects the problems with the fields of a request. Only the
+// first problem of each field is kept.
+type Validator struct {
+	Errors []FieldError
+}
+
+// Add records a problem with field unless it already has one
+func (v *Validator) Add(field, message string) {
+	if !v.Has(field) {
+		v.Errors = append(v.Errors, FieldError{Field: field, Message: message})
+	}
+}
+
+// Check records message for field when ok is false
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.Add(field, message)
+	}
+}
+
+// Has reports whether field already has a problem
+func (v *Validator) Has(field string) bool {
+	for _, e := range v.Errors {
+		if e.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether no problem was found
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// Required checks that value isn't blank
+func (v *Validator) Required(field, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// Length checks that value has between min and max characters. A min of 0
+// allows an empty value.
+func (v *Validator) Length(field, value string, min, max int) {
+	n := utf8.RuneCountInString(value)
+	switch {
+	case n == 0 && min > 0:
+		v.Add(field, "is required")
+	case n < min:
+		v.Add(field, fmt.Sprintf("must be at least %d characters", min))
+	case n > max:
+		v.Add(field, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+// Email checks that value is a bare address such as name@example.com
+func (v *Validator) Email(field, value string) {
+	addr, err := mail.ParseAddress(value)
+	v.Check(err == nil && addr.Address == value, field, "must be a valid email address")
+}
+
+// NormalizeEmail is the form of an email that differently typed versions of
+// the same address share. Compare it with lower(email) in SQL.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Username checks that value is 3 to 30 letters, digits, dots or underscores
+func (v *Validator) Username(field, value string) {
+	v.Check(usernamePattern.MatchString(value), field, fmt.Sprintf(
+		"must be %d to %d letters, digits, dots or underscores", minUsernameLength, maxUsernameLength))
+}
+
+// Password checks that value is long enough and mixes letters with digits
+func (v *Validator) Password(field, value string) {
+	if len(value) < minPasswordLength || len(value) > maxPasswordLength {
+		v.Add(field, fmt.Sprintf("must be %d to %d characters", minPasswordLength, maxPasswordLength))
+		return
+	}
+	hasLetter := strings.IndexFunc(value, unicode.IsLetter) >= 0
+	hasDigit := strings.IndexFunc(value, unicode.IsDigit) >= 0
+	v.Check(hasLetter && hasDigit, field, "must contain both letters and digits")
+}
+
+// Date parses value as a YYYY-MM-DD date. The zero time is returned when it
+// isn't one.
+func (v *Validator) Date(field, value string) time.Time {
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		v.Add(field, "must be a date like 2006-01-02")
+		return time.Time{}
+	}
+	return date
+}
+
+// MinAge checks that someone born on dateOfBirth is at least years old
+func (v *Validator) MinAge(field string, dateOfBirth time.Time, years int) {
+	if dateOfBirth.IsZero() {
+		return
+	}
+	if !dateOfBirth.Before(time.Now()) {
+		v.Add(field, "must be in the past")
+		return
+	}
+	v.Check(!dateOfBirth.AddDate(years, 0, 0).After(time.Now()), field,
+		fmt.Sprintf("must be at least %d years ago", years))
+}
+
+// OneOf checks that value is one of allowed
+func (v *Validator) OneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Add(field, "must be one of "+strings.Join(allowed, ", "))
+}
+
+// Write sends the problems found as a ValidationError with status, usually
+// 400 for invalid fields or 409 for values already in use
+func (v *Validator) Write(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ValidationError{
+		Error:  "Validation failed",
+		Fields: v.Errors,
+	})
+}
+
+// WriteFieldError sends a ValidationError about a single field
+func WriteFieldError(w http.ResponseWriter, status int, field, message string) {
+	v := Validator{}
+	v.Add(field, message)
+	v.Write(w, status)
+}
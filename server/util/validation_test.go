@@ -0,0 +1,42 @@
+package util
+
+import "testing"
+
+func TestValidatorUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		valid    bool
+	}{
+		{"jane", true},
+		{"jane_smith.2", true},
+		{"abc", true},
+		{"a23456789012345678901234567890", true},
+		{"ab", false},
+		{"a234567890123456789012345678901", false},
+		{"jane smith", false},
+		{"jane-smith", false},
+		{"jané", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		v := Validator{}
+		v.Username("username", tt.username)
+		if v.Valid() != tt.valid {
+			t.Errorf("Username(%q) valid = %v, want %v (%v)", tt.username, v.Valid(), tt.valid, v.Errors)
+		}
+	}
+}
+
+func TestMentionsFindEveryValidUsername(t *testing.T) {
+	for _, username := range []string{"jane", "jane_smith.2", "jane.", "a23456789012345678901234567890"} {
+		v := Validator{}
+		v.Username("username", username)
+		if !v.Valid() {
+			t.Fatalf("%q should be a valid username", username)
+		}
+		mentions := ExtractMentions("hi @" + username + " there")
+		if len(mentions) != 1 || mentions[0] != username {
+			t.Errorf("ExtractMentions found %v, want [%s]", mentions, username)
+		}
+	}
+}